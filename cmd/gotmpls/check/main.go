@@ -0,0 +1,65 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/walteh/gotmpls/pkg/checker"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Handler struct {
+	debug        bool
+	functionSets []string
+}
+
+func NewCheckCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "check [patterns...]",
+		Short: "type check the templates of a module",
+		Long: `Type checks every template matched by the patterns, which work like the patterns of the go command
+(e.g. ./... for the current directory and its subdirectories).
+
+Problems are printed as file:line:col: message, and the command exits with a non-zero status
+if any errors are found.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.Flags().BoolVar(&me.debug, "debug", false, "enable debug logging")
+	cmd.Flags().StringSliceVar(&me.functionSets, "funcs", nil, "function sets (e.g. sprig) that can be called from every template")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return me.Run(cmd.Context(), cmd.OutOrStdout(), args)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, out io.Writer, patterns []string) error {
+	level := zerolog.WarnLevel
+	if me.debug {
+		level = zerolog.DebugLevel
+	}
+	ctx = zerolog.New(os.Stderr).With().Str("name", "gotmpls").Logger().Level(level).WithContext(ctx)
+
+	result, err := checker.Check(ctx, patterns, checker.Options{FunctionSets: me.functionSets})
+	if err != nil {
+		return errors.Errorf("checking templates: %w", err)
+	}
+
+	for _, problem := range result.Problems {
+		fmt.Fprintln(out, problem.String())
+	}
+
+	if count := result.Errors(); count > 0 {
+		return errors.Errorf("found %d errors in %d templates", count, len(result.Files))
+	}
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package format
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/walteh/gotmpls/pkg/finder"
+	"github.com/walteh/gotmpls/pkg/formatter"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Handler struct {
+	debug  bool
+	write  bool
+	diff   bool
+	indent string
+}
+
+func NewFormatCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "fmt [-w] [-d] [paths...]",
+		Short: "format templates",
+		Long: `Formats the templates at the paths, which are files or directories that are searched recursively
+for .tmpl and .gotmpl files. Without paths, the template is read from stdin.
+
+By default the formatted templates are printed to stdout. With -w they are written back to their
+files, and with -d a diff of the changes is printed instead.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.Flags().BoolVar(&me.debug, "debug", false, "enable debug logging")
+	cmd.Flags().BoolVarP(&me.write, "write", "w", false, "write the result to the template files instead of stdout")
+	cmd.Flags().BoolVarP(&me.diff, "diff", "d", false, "print a diff of the changes instead of the formatted templates")
+	cmd.Flags().StringVar(&me.indent, "indent", "\t", "one level of indentation of nested blocks")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return me.Run(cmd.Context(), cmd.InOrStdin(), cmd.OutOrStdout(), args)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, in io.Reader, out io.Writer, paths []string) error {
+	level := zerolog.WarnLevel
+	if me.debug {
+		level = zerolog.DebugLevel
+	}
+	ctx = zerolog.New(os.Stderr).With().Str("name", "gotmpls").Logger().Level(level).WithContext(ctx)
+
+	if len(paths) == 0 {
+		if me.write {
+			return errors.New("can not use -w with stdin")
+		}
+		content, err := io.ReadAll(in)
+		if err != nil {
+			return errors.Errorf("reading stdin: %w", err)
+		}
+		return me.output(ctx, out, "<standard input>", string(content))
+	}
+
+	for _, path := range paths {
+		files, err := templateFiles(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return errors.Errorf("reading template: %w", err)
+			}
+			if err := me.output(ctx, out, file, string(content)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// output formats a template and writes it, or the diff of the changes, according to the flags
+func (me *Handler) output(ctx context.Context, out io.Writer, file string, content string) error {
+	formatted, err := formatter.Format(ctx, file, content, formatter.Options{Indent: me.indent})
+	if err != nil {
+		return errors.Errorf("formatting %s: %w", file, err)
+	}
+
+	if me.diff {
+		if formatted == content {
+			return nil
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(content),
+			B:        difflib.SplitLines(formatted),
+			FromFile: file + ".orig",
+			ToFile:   file,
+			Context:  3,
+		})
+		if err != nil {
+			return errors.Errorf("computing diff of %s: %w", file, err)
+		}
+		fmt.Fprint(out, diff)
+		return nil
+	}
+
+	if me.write {
+		if formatted == content {
+			return nil
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return errors.Errorf("reading template: %w", err)
+		}
+		if err := os.WriteFile(file, []byte(formatted), info.Mode().Perm()); err != nil {
+			return errors.Errorf("writing template: %w", err)
+		}
+		return nil
+	}
+
+	fmt.Fprint(out, formatted)
+	return nil
+}
+
+// templateFiles returns the path itself if it is a file, or the templates inside of it if it is a directory
+func templateFiles(ctx context.Context, path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Errorf("reading path: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	found, err := finder.NewDefaultFinder().FindTemplates(ctx, path, nil)
+	if err != nil {
+		return nil, errors.Errorf("finding templates: %w", err)
+	}
+
+	files := make([]string, 0, len(found))
+	for _, file := range found {
+		files = append(files, file.Path)
+	}
+	return files, nil
+}
@@ -7,6 +7,9 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/walteh/gotmpls/cmd/gotmpls/check"
+	"github.com/walteh/gotmpls/cmd/gotmpls/format"
+	"github.com/walteh/gotmpls/cmd/gotmpls/report"
 	serve_lsp "github.com/walteh/gotmpls/cmd/gotmpls/serve-lsp"
 	"gitlab.com/tozd/go/errors"
 )
@@ -43,6 +46,12 @@ func run() error {
 
 	rootCmd.AddCommand(serve_lsp.NewServeLSPCommand())
 
+	rootCmd.AddCommand(check.NewCheckCommand())
+
+	rootCmd.AddCommand(report.NewReportCommand())
+
+	rootCmd.AddCommand(format.NewFormatCommand())
+
 	if err := rootCmd.ExecuteContext(context.Background()); err != nil {
 		return errors.Errorf("failed to execute command: %w", err)
 	}
@@ -0,0 +1,86 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/walteh/gotmpls/pkg/checker"
+	"github.com/walteh/gotmpls/pkg/reporter"
+	"gitlab.com/tozd/go/errors"
+)
+
+type Handler struct {
+	debug        bool
+	format       string
+	output       string
+	functionSets []string
+}
+
+func NewReportCommand() *cobra.Command {
+	me := &Handler{}
+
+	cmd := &cobra.Command{
+		Use:   "report [patterns...]",
+		Short: "report the problems of the templates of a module in a machine readable format",
+		Long: `Type checks every template matched by the patterns, like the check command, and writes the problems
+in a format that code scanning dashboards and test result viewers can ingest.
+
+Unlike check, the command succeeds when problems are found, so that the report can be uploaded.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	cmd.Flags().BoolVar(&me.debug, "debug", false, "enable debug logging")
+	cmd.Flags().StringVar(&me.format, "format", "sarif", fmt.Sprintf("the format of the report, one of: %s", strings.Join(reporter.Formats(), ", ")))
+	cmd.Flags().StringVarP(&me.output, "output", "o", "", "write the report to a file instead of stdout")
+	cmd.Flags().StringSliceVar(&me.functionSets, "funcs", nil, "function sets (e.g. sprig) that can be called from every template")
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return me.Run(cmd.Context(), cmd.OutOrStdout(), args)
+	}
+
+	return cmd
+}
+
+func (me *Handler) Run(ctx context.Context, out io.Writer, patterns []string) error {
+	level := zerolog.WarnLevel
+	if me.debug {
+		level = zerolog.DebugLevel
+	}
+	ctx = zerolog.New(os.Stderr).With().Str("name", "gotmpls").Logger().Level(level).WithContext(ctx)
+
+	rep, err := reporter.New(me.format)
+	if err != nil {
+		return err
+	}
+
+	result, err := checker.Check(ctx, patterns, checker.Options{FunctionSets: me.functionSets})
+	if err != nil {
+		return errors.Errorf("checking templates: %w", err)
+	}
+
+	if me.output != "" {
+		file, err := os.Create(me.output)
+		if err != nil {
+			return errors.Errorf("creating output file: %w", err)
+		}
+		if err := rep.Report(file, result); err != nil {
+			file.Close()
+			return errors.Errorf("writing report: %w", err)
+		}
+		if err := file.Close(); err != nil {
+			return errors.Errorf("closing output file: %w", err)
+		}
+		return nil
+	}
+
+	if err := rep.Report(out, result); err != nil {
+		return errors.Errorf("writing report: %w", err)
+	}
+
+	return nil
+}
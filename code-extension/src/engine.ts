@@ -101,6 +101,8 @@ export function createClientOptions(
 			trace: {
 				server: config.trace.server,
 			},
+			functionSets: config.functionSets,
+			inlayHints: config.inlayHints,
 		},
 	};
 }
@@ -141,6 +143,8 @@ export abstract class BaseGotmplsEngine implements GotmplsEngine {
 				trace: {
 					server: config.trace.server,
 				},
+				functionSets: config.functionSets,
+				inlayHints: config.inlayHints,
 			},
 		};
 	}
@@ -249,6 +253,14 @@ export interface GotmplsConfig {
 	trace: {
 		server: boolean;
 	};
+	functionSets: string[];
+	inlayHints: GotmplsInlayHintsConfig;
+}
+
+export interface GotmplsInlayHintsConfig {
+	variableTypes: boolean;
+	pipelineTypes: boolean;
+	rangeTypes: boolean;
 }
 
 // 📦 Helper to get configuration
@@ -261,5 +273,11 @@ export function getConfig(): GotmplsConfig {
 		trace: {
 			server: config.get<boolean>("trace.server") || false,
 		},
+		functionSets: config.get<string[]>("functionSets") || [],
+		inlayHints: {
+			variableTypes: config.get<boolean>("inlayHints.variableTypes") || false,
+			pipelineTypes: config.get<boolean>("inlayHints.pipelineTypes") || false,
+			rangeTypes: config.get<boolean>("inlayHints.rangeTypes") || false,
+		},
 	};
 }
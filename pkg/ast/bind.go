@@ -0,0 +1,192 @@
+package ast
+
+import (
+	"context"
+	goast "go/ast"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/tozd/go/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// BindDirective binds a template file of the package, or a define of it, to a type. The type is the
+// one named by the directive, or the type declaration the directive is the comment of. The file is
+// relative to the directory of the package.
+//
+// Example:
+//
+//	//gotmpls:bind "templates/invoice.tmpl"
+//	//gotmpls:bind "templates/invoice.tmpl" define="row" type=LineItem
+//	type Invoice struct {
+//		Items []LineItem
+//	}
+const BindDirective = "//gotmpls:bind"
+
+// Binding is a template bound to a type by a //gotmpls:bind directive. It is used as the type hint of
+// the template instead of a gotype comment, and wins over the type the template is executed with.
+type Binding struct {
+	// File is the path of the template file
+	File string
+	// Define is the name of the bound define or block, empty for the content of the file outside of any define
+	Define string
+	// TypePath is the bound type, e.g. "github.com/example/types.Invoice"
+	TypePath string
+	// Position is the position of the directive in the go code
+	Position token.Position
+}
+
+// LoadBindings returns the templates bound to types by the //gotmpls:bind directives of a package.
+// Directives without a file, or whose type can not be determined, are skipped.
+func LoadBindings(ctx context.Context, pkg *packages.Package) []*Binding {
+	bindings := []*Binding{}
+
+	if pkg == nil || pkg.Types == nil {
+		return bindings
+	}
+
+	dir := pkg.Dir
+	if len(pkg.GoFiles) > 0 {
+		dir = filepath.Dir(pkg.GoFiles[0])
+	}
+
+	for _, file := range pkg.Syntax {
+		// the types that comment groups are the documentation of
+		documented := map[*goast.CommentGroup]string{}
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*goast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*goast.TypeSpec)
+				for _, doc := range []*goast.CommentGroup{ts.Doc, ts.Comment} {
+					if doc != nil {
+						documented[doc] = ts.Name.Name
+					}
+				}
+				if gen.Doc != nil && len(gen.Specs) == 1 {
+					documented[gen.Doc] = ts.Name.Name
+				}
+			}
+		}
+
+		for _, group := range file.Comments {
+			for _, comment := range group.List {
+				rest, ok := strings.CutPrefix(comment.Text, BindDirective)
+				if !ok || (rest != "" && !strings.ContainsAny(rest[:1], " \t")) {
+					continue
+				}
+
+				pos := pkg.Fset.Position(comment.Pos())
+
+				binding, err := parseBindDirective(rest, documented[group])
+				if err != nil {
+					zerolog.Ctx(ctx).Warn().Err(err).Str("directive", pos.String()).Msg("skipping invalid bind directive")
+					continue
+				}
+
+				typePath, err := qualifyTypeHint(binding.TypePath, pkg.Types)
+				if err != nil {
+					zerolog.Ctx(ctx).Warn().Err(err).Str("type", binding.TypePath).Str("directive", pos.String()).Msg("skipping bind directive with an unknown type")
+					continue
+				}
+				binding.TypePath = typePath
+
+				if !filepath.IsAbs(binding.File) {
+					binding.File = filepath.Join(dir, binding.File)
+				}
+				binding.Position = pos
+
+				bindings = append(bindings, binding)
+			}
+		}
+	}
+
+	return bindings
+}
+
+// parseBindDirective parses the arguments of a bind directive: a quoted file, an optional type, e.g.
+// LineItem or []LineItem, and the optional define="name" and type=Name options. The type defaults to
+// the documented type.
+func parseBindDirective(args string, documented string) (*Binding, error) {
+	binding := &Binding{TypePath: documented}
+
+	for i := 0; ; i++ {
+		args = strings.TrimSpace(args)
+		if args == "" {
+			break
+		}
+
+		key := ""
+		if k, v, ok := strings.Cut(args, "="); ok && !strings.ContainsAny(k, " \t\"") {
+			key, args = k, v
+		}
+
+		value, rest, err := cutArgument(args)
+		if err != nil {
+			return nil, err
+		}
+		args = rest
+
+		switch {
+		case key == "" && i == 0:
+			binding.File = value
+		case key == "" && i == 1, key == "type":
+			binding.TypePath = value
+		case key == "define":
+			binding.Define = value
+		default:
+			return nil, errors.Errorf("unexpected argument %q", value)
+		}
+	}
+
+	if binding.File == "" {
+		return nil, errors.New("missing template file")
+	}
+	if binding.TypePath == "" {
+		return nil, errors.New("missing type, the directive is not the comment of a type declaration")
+	}
+
+	return binding, nil
+}
+
+// cutArgument returns the first argument of a directive, unquoted if it is quoted, and the arguments after it
+func cutArgument(args string) (string, string, error) {
+	if !strings.HasPrefix(args, `"`) {
+		end := strings.IndexAny(args, " \t")
+		if end == -1 {
+			return args, "", nil
+		}
+		return args[:end], args[end:], nil
+	}
+
+	quoted, err := strconv.QuotedPrefix(args)
+	if err != nil {
+		return "", "", errors.Errorf("invalid quoted argument %s: %w", args, err)
+	}
+	value, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", "", errors.Errorf("invalid quoted argument %s: %w", quoted, err)
+	}
+	return value, args[len(quoted):], nil
+}
+
+// Bindings returns the bindings of the templates of a file
+func (r *Registry) Bindings(file string) []*Binding {
+	bindings := []*Binding{}
+	if r == nil {
+		return bindings
+	}
+	for _, pkg := range r.Packages {
+		for _, binding := range pkg.Bindings {
+			if binding.File == file {
+				bindings = append(bindings, binding)
+			}
+		}
+	}
+	return bindings
+}
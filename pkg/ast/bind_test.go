@@ -0,0 +1,99 @@
+package ast_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+)
+
+func TestLoadBindings(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	err := os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte(`
+module example.com/test
+
+go 1.21
+`), 0644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(tmpDir, "types.go"), []byte(`
+package test
+
+//gotmpls:bind "templates/invoice.tmpl"
+//gotmpls:bind "templates/invoice.tmpl" define="row" type=LineItem
+type Invoice struct {
+	Items []LineItem
+}
+
+type (
+	// LineItem is a row of an invoice
+	//gotmpls:bind "templates/item.tmpl"
+	LineItem struct {
+		Title string
+	}
+
+	Customer struct{} //gotmpls:bind "templates/customer.tmpl"
+)
+
+//gotmpls:bind "templates/email.tmpl" Customer
+var _ = 0
+
+//gotmpls:bind "templates/cell.tmpl"	type=LineItem	define="cell"
+
+//gotmpls:bind "templates/other.tmpl" example.com/other.Type
+
+//gotmpls:bind	"templates/tab.tmpl" Invoice
+
+//gotmpls:bind "templates/items.tmpl" []LineItem
+
+//gotmpls:bind "templates/lookup.tmpl" type=map[string]*LineItem define="lookup"
+
+//gotmpls:bind "templates/status.tmpl" type="map[example.com/other.Key]struct{ Item LineItem; Count int }"
+
+//gotmpls:binding "templates/prefix.tmpl" Invoice
+
+//gotmpls:bind "templates/unknown.tmpl" Unknown
+
+//gotmpls:bind "templates/missing-type.tmpl"
+
+//gotmpls:bind "templates/bad.tmpl" Invoice color=red
+`), 0644)
+	require.NoError(t, err)
+
+	registry, err := ast.AnalyzePackage(ctx, tmpDir, nil)
+	require.NoError(t, err)
+	require.Len(t, registry.Packages, 1)
+
+	pkg := registry.Packages[0]
+	dir := filepath.Dir(pkg.Package.GoFiles[0])
+
+	// the bindings are described as "<file> <define> <type>"
+	got := []string{}
+	for _, binding := range pkg.Bindings {
+		rel, err := filepath.Rel(dir, binding.File)
+		require.NoError(t, err)
+		got = append(got, rel+" "+binding.Define+" "+binding.TypePath)
+		assert.Equal(t, "types.go", filepath.Base(binding.Position.Filename))
+	}
+
+	assert.Equal(t, []string{
+		"templates/invoice.tmpl  example.com/test.Invoice",
+		"templates/invoice.tmpl row example.com/test.LineItem",
+		"templates/item.tmpl  example.com/test.LineItem",
+		"templates/customer.tmpl  example.com/test.Customer",
+		"templates/email.tmpl  example.com/test.Customer",
+		"templates/cell.tmpl cell example.com/test.LineItem",
+		"templates/other.tmpl  example.com/other.Type",
+		"templates/tab.tmpl  example.com/test.Invoice",
+		"templates/items.tmpl  []example.com/test.LineItem",
+		"templates/lookup.tmpl lookup map[string]*example.com/test.LineItem",
+		"templates/status.tmpl  map[example.com/other.Key]struct{ Item example.com/test.LineItem; Count int }",
+	}, got)
+
+	assert.Len(t, registry.Bindings(filepath.Join(dir, "templates", "invoice.tmpl")), 2)
+	assert.Empty(t, registry.Bindings(filepath.Join(dir, "templates", "unknown.tmpl")))
+}
@@ -0,0 +1,417 @@
+package ast
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/tozd/go/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// RegistryCache keeps the packages loaded for each module of a workspace, so that packages.Load only
+// runs when Go code changes instead of on every request.
+//
+// Loads are scoped to what a file needs: the package in its directory and the packages of its type
+// hints. The load is widened to "./..." (first in the file's directory, then in its parent directory
+// within the module) only when a type hint can not be resolved, or when no loaded package embeds
+// the template.
+//
+// Edits to templates reuse the cached packages. The packages of a module are reloaded when the Go
+// file overlays change, and after Invalidate is called for one of its files.
+type RegistryCache struct {
+	mu      sync.Mutex
+	modules map[string]*moduleCache // keyed by the directory of the module's go.mod
+}
+
+type moduleCache struct {
+	mu       sync.Mutex
+	packages []*PackageWithTemplateFiles
+	loaded   map[string]bool   // the patterns that were loaded, relative patterns are keyed by their directory
+	overlay  map[string]string // the Go file overlays the packages were loaded with
+	// dependencies are the packages that the registries of the module loaded on demand
+	dependencies *dependencyCache
+}
+
+// loadStep is a set of patterns loaded from a directory
+type loadStep struct {
+	dir      string
+	patterns []string
+}
+
+// NewRegistryCache creates an empty RegistryCache
+func NewRegistryCache() *RegistryCache {
+	return &RegistryCache{
+		modules: make(map[string]*moduleCache),
+	}
+}
+
+// Registry returns the registry for a template or Go file, loading the packages it needs.
+//
+// The overlay holds the content of unsaved files: Go files are passed to packages.Load, templates
+// replace the embedded content of the packages. The hints are the type paths of the file's
+// gotype comments.
+func (c *RegistryCache) Registry(ctx context.Context, file string, overlay map[string][]byte, hints ...string) (*Registry, error) {
+	dir := file
+	if info, err := os.Stat(file); err != nil || !info.IsDir() {
+		dir = filepath.Dir(file)
+	}
+
+	root := findModuleRoot(dir)
+	mod := c.module(root)
+
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+
+	mod.useOverlay(ctx, dir, overlay)
+
+	steps := []loadStep{
+		{dir: dir, patterns: append([]string{"."}, hintPackagePaths(hints)...)},
+		{dir: dir, patterns: []string{"./..."}},
+	}
+	if dir != root {
+		// templates are often embedded by the package of the parent directory
+		steps = append(steps, loadStep{dir: filepath.Dir(dir), patterns: []string{"./..."}})
+	}
+	if hasPackageNames(hints) {
+		// a package name may match more than one package of the module
+		steps = append(steps, loadStep{dir: root, patterns: []string{"./..."}})
+	}
+
+	var loadErr error
+	for i, step := range steps {
+		if i > 0 && mod.satisfies(ctx, root, file, hints) {
+			break
+		}
+		if err := mod.load(ctx, step); err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Str("dir", step.dir).Strs("patterns", step.patterns).Msg("failed to load packages")
+			loadErr = err
+		}
+	}
+
+	if len(mod.packages) == 0 {
+		if loadErr != nil {
+			return nil, errors.Errorf("no packages found in directory %s: %w", dir, loadErr)
+		}
+		return nil, errors.Errorf("no packages found in directory: %s", dir)
+	}
+
+	return mod.registry(overlay), nil
+}
+
+// WorkspaceRegistry returns the registry of every package inside of dir, so that the templates of
+// a workspace folder can be checked even if no file of their package was requested yet. The packages
+// are shared with Registry, and only loaded once.
+func (c *RegistryCache) WorkspaceRegistry(ctx context.Context, dir string, overlay map[string][]byte) (*Registry, error) {
+	mod := c.module(findModuleRoot(dir))
+
+	mod.mu.Lock()
+	defer mod.mu.Unlock()
+
+	mod.useOverlay(ctx, dir, overlay)
+
+	if err := mod.load(ctx, loadStep{dir: dir, patterns: []string{"./..."}}); err != nil {
+		return nil, errors.Errorf("loading workspace packages in %s: %w", dir, err)
+	}
+
+	if len(mod.packages) == 0 {
+		return nil, errors.Errorf("no packages found in directory: %s", dir)
+	}
+
+	return mod.registry(overlay), nil
+}
+
+// Invalidate drops the packages of the module that contains path, e.g. after a Go file or go.mod
+// changed on disk, or of every module inside of path if it is a directory. They are reloaded by the
+// next call to Registry.
+func (c *RegistryCache) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for root := range c.modules {
+		if isWithin(root, path) || isWithin(path, root) {
+			delete(c.modules, root)
+		}
+	}
+}
+
+// InvalidateAll drops the packages of every module
+func (c *RegistryCache) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.modules = make(map[string]*moduleCache)
+}
+
+// ReloadTemplateFile reads an embedded template from disk again, without reloading the packages
+// that embed it. It reports whether any cached package embeds the template.
+func (c *RegistryCache) ReloadTemplateFile(path string) (bool, error) {
+	c.mu.Lock()
+	mods := make([]*moduleCache, 0, len(c.modules))
+	for _, mod := range c.modules {
+		mods = append(mods, mod)
+	}
+	c.mu.Unlock()
+
+	found := false
+	for _, mod := range mods {
+		mod.mu.Lock()
+		for i, pkg := range mod.packages {
+			if _, ok := pkg.TemplateFiles[path]; !ok {
+				continue
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				mod.mu.Unlock()
+				return false, errors.Errorf("reading template file: %w", err)
+			}
+			// registries returned earlier share the package, so it is replaced instead of modified
+			mod.packages[i] = withTemplateOverlay(pkg, map[string][]byte{path: content})
+			found = true
+		}
+		mod.mu.Unlock()
+	}
+
+	return found, nil
+}
+
+func (c *RegistryCache) module(root string) *moduleCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mod, ok := c.modules[root]
+	if !ok {
+		mod = &moduleCache{}
+		mod.reset(map[string]string{})
+		c.modules[root] = mod
+	}
+	return mod
+}
+
+func (m *moduleCache) reset(overlay map[string]string) {
+	m.packages = nil
+	m.loaded = make(map[string]bool)
+	m.overlay = overlay
+	m.dependencies = newDependencyCache()
+}
+
+// useOverlay drops the loaded packages if they were loaded with other Go file overlays
+func (m *moduleCache) useOverlay(ctx context.Context, dir string, overlay map[string][]byte) {
+	goOverlay := goFileOverlay(overlay)
+	if !maps.Equal(goOverlay, m.overlay) {
+		zerolog.Ctx(ctx).Debug().Str("dir", dir).Msg("go file overlays changed, reloading packages")
+		m.reset(goOverlay)
+	}
+}
+
+// registry returns the loaded packages, with the content of their templates replaced by the overlay
+func (m *moduleCache) registry(overlay map[string][]byte) *Registry {
+	pkgs := make([]*PackageWithTemplateFiles, 0, len(m.packages))
+	for _, pkg := range m.packages {
+		pkgs = append(pkgs, withTemplateOverlay(pkg, overlay))
+	}
+	registry := NewRegistry(pkgs)
+	registry.dependencies = m.dependencies
+	return registry
+}
+
+// load loads the patterns of a step that are not loaded yet, and adds the packages that contain Go files
+func (m *moduleCache) load(ctx context.Context, step loadStep) error {
+	patterns := []string{}
+	for _, pattern := range step.patterns {
+		key := patternKey(step.dir, pattern)
+		if m.covered(key) {
+			continue
+		}
+		m.loaded[key] = true
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	overlay := make(map[string][]byte, len(m.overlay))
+	for path, content := range m.overlay {
+		overlay[path] = []byte(content)
+	}
+
+	cfg := &packages.Config{
+		Mode:    loadMode,
+		Dir:     step.dir,
+		Env:     append(os.Environ(), "GO111MODULE=on"),
+		Overlay: overlay,
+	}
+
+	start := time.Now()
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return errors.Errorf("loading packages: %w", err)
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("dir", step.dir).Strs("patterns", patterns).Int("packages", len(pkgs)).Dur("duration", time.Since(start)).Msg("loaded packages")
+
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) == 0 || m.has(pkg.PkgPath) {
+			continue
+		}
+		pkgWithTemplateFiles, err := newPackageWithTemplateFiles(ctx, pkg)
+		if err != nil {
+			return err
+		}
+		m.packages = append(m.packages, pkgWithTemplateFiles)
+	}
+
+	return nil
+}
+
+// satisfies reports whether the loaded packages resolve every hint and embed the template. Hints that
+// name their packages instead of importing them are only resolved once every package of the module is
+// loaded, after which a package name that is ambiguous is reported as is.
+func (m *moduleCache) satisfies(ctx context.Context, root string, file string, hints []string) bool {
+	if len(m.packages) == 0 {
+		return false
+	}
+
+	if hasPackageNames(hints) && !m.covered(patternKey(root, "./...")) {
+		return false
+	}
+
+	registry := NewRegistry(m.packages)
+	registry.dependencies = m.dependencies
+
+	for _, hint := range hints {
+		for _, pkg := range HintPackages(hint) {
+			if _, err := registry.GetPackage(ctx, pkg); err != nil {
+				var ambiguous *AmbiguousPackageError
+				if errors.As(err, &ambiguous) {
+					continue
+				}
+				return false
+			}
+		}
+	}
+
+	if !isTemplateFile(file) {
+		return true
+	}
+
+	_, _, ok := registry.GetTemplateFile(file)
+	return ok
+}
+
+// covered reports whether the packages of a pattern key are already loaded, directly or by a "/..." pattern of a parent directory
+func (m *moduleCache) covered(key string) bool {
+	if m.loaded[key] {
+		return true
+	}
+	for loaded := range m.loaded {
+		if root, ok := strings.CutSuffix(loaded, string(filepath.Separator)+"..."); ok && filepath.IsAbs(key) && isWithin(root, strings.TrimSuffix(key, string(filepath.Separator)+"...")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *moduleCache) has(pkgPath string) bool {
+	for _, pkg := range m.packages {
+		if pkg.Package.PkgPath == pkgPath {
+			return true
+		}
+	}
+	return false
+}
+
+// patternKey returns the key of a load pattern: relative patterns are joined with the directory, import paths are kept as is
+func patternKey(dir, pattern string) string {
+	if strings.HasPrefix(pattern, ".") {
+		return filepath.Join(dir, pattern)
+	}
+	return pattern
+}
+
+// hasPackageNames reports whether a hint refers to a package by its name, e.g. "types.Person", rather
+// than by its import path
+func hasPackageNames(hints []string) bool {
+	for _, hint := range hints {
+		for _, pkg := range HintPackages(hint) {
+			if !strings.Contains(pkg, "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hintPackagePaths returns the packages of the hints that are import paths, which can be loaded directly.
+// Hints like "types.Person" only name the package and are resolved against the loaded packages.
+func hintPackagePaths(hints []string) []string {
+	paths := []string{}
+	for _, hint := range hints {
+		for _, pkg := range HintPackages(hint) {
+			if strings.Contains(pkg, "/") {
+				paths = append(paths, pkg)
+			}
+		}
+	}
+	return paths
+}
+
+// withTemplateOverlay returns the package with the content of its embedded templates replaced by the overlay
+func withTemplateOverlay(pkg *PackageWithTemplateFiles, overlay map[string][]byte) *PackageWithTemplateFiles {
+	var copied *PackageWithTemplateFiles
+	for path, content := range overlay {
+		if _, ok := pkg.TemplateFiles[path]; !ok {
+			continue
+		}
+		if copied == nil {
+			copied = &PackageWithTemplateFiles{
+				Package:       pkg.Package,
+				TemplateFiles: maps.Clone(pkg.TemplateFiles),
+				Functions:     pkg.Functions,
+				ExecuteHints:  pkg.ExecuteHints,
+				Bindings:      pkg.Bindings,
+			}
+		}
+		copied.TemplateFiles[path] = string(content)
+	}
+	if copied == nil {
+		return pkg
+	}
+	return copied
+}
+
+func goFileOverlay(overlay map[string][]byte) map[string]string {
+	goFiles := make(map[string]string)
+	for path, content := range overlay {
+		if strings.HasSuffix(path, ".go") {
+			goFiles[path] = string(content)
+		}
+	}
+	return goFiles
+}
+
+// findModuleRoot returns the closest directory containing a go.mod, or dir itself if there is none
+func findModuleRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, "go.mod")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// isWithin reports whether path is root or inside of it
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
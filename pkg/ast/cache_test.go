@@ -0,0 +1,287 @@
+package ast_test
+
+import (
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+)
+
+func TestRegistryCache(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	files := map[string]string{
+		"go.mod": `
+module example.com/test
+
+go 1.21
+`,
+		"web/web.go": `
+package web
+
+import _ "embed"
+
+//go:embed page.tmpl
+var Page string
+`,
+		"web/page.tmpl": `{{- /*gotype: example.com/test/types.Person*/ -}}{{ .Name }}`,
+		"types/types.go": `
+package types
+
+type Person struct {
+	Name string
+}
+`,
+		"unrelated/unrelated.go": `
+package unrelated
+
+type Other struct{}
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
+
+	page := filepath.Join(tmpDir, "web", "page.tmpl")
+	hint := "example.com/test/types.Person"
+
+	pkgPaths := func(registry *ast.Registry) []string {
+		paths := []string{}
+		for _, pkg := range registry.Packages {
+			paths = append(paths, pkg.Package.PkgPath)
+		}
+		return paths
+	}
+
+	personFields := func(registry *ast.Registry) int {
+		pkg, err := registry.GetPackage(ctx, "example.com/test/types")
+		require.NoError(t, err)
+		return pkg.Scope().Lookup("Person").Type().Underlying().(*types.Struct).NumFields()
+	}
+
+	cache := ast.NewRegistryCache()
+
+	first, err := cache.Registry(ctx, page, map[string][]byte{page: []byte("{{ .Name }}")}, hint)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"example.com/test/web", "example.com/test/types"}, pkgPaths(first), "only the embedding and hinted packages should be loaded")
+
+	content, _, ok := first.GetTemplateFile(page)
+	require.True(t, ok)
+	assert.Equal(t, "{{ .Name }}", content, "the template overlay should replace the embedded content")
+
+	second, err := cache.Registry(ctx, page, map[string][]byte{page: []byte("{{ .Name }}!")}, hint)
+	require.NoError(t, err)
+	firstTypes, err := first.GetPackage(ctx, "example.com/test/types")
+	require.NoError(t, err)
+	secondTypes, err := second.GetPackage(ctx, "example.com/test/types")
+	require.NoError(t, err)
+	assert.Same(t, firstTypes, secondTypes, "template edits should reuse the loaded packages")
+
+	content, _, _ = second.GetTemplateFile(page)
+	assert.Equal(t, "{{ .Name }}!", content)
+	content, _, _ = first.GetTemplateFile(page)
+	assert.Equal(t, "{{ .Name }}", content, "earlier registries should not be modified")
+
+	typesFile := filepath.Join(tmpDir, "types", "types.go")
+	edited := "package types\n\ntype Person struct {\n\tName string\n\tAge  int\n}\n"
+	third, err := cache.Registry(ctx, page, map[string][]byte{typesFile: []byte(edited)}, hint)
+	require.NoError(t, err)
+	thirdTypes, err := third.GetPackage(ctx, "example.com/test/types")
+	require.NoError(t, err)
+	assert.NotSame(t, secondTypes, thirdTypes, "go overlays should reload the packages")
+	assert.Equal(t, 2, personFields(third))
+
+	require.NoError(t, os.WriteFile(typesFile, []byte(edited), 0644))
+	cache.Invalidate(typesFile)
+	fourth, err := cache.Registry(ctx, page, nil, hint)
+	require.NoError(t, err)
+	fourthTypes, err := fourth.GetPackage(ctx, "example.com/test/types")
+	require.NoError(t, err)
+	assert.NotSame(t, thirdTypes, fourthTypes, "invalidated packages should be reloaded")
+	assert.Equal(t, 2, personFields(fourth))
+
+	require.NoError(t, os.WriteFile(page, []byte("{{ .Age }}"), 0644))
+	found, err := cache.ReloadTemplateFile(page)
+	require.NoError(t, err)
+	assert.True(t, found)
+	fifth, err := cache.Registry(ctx, page, nil, hint)
+	require.NoError(t, err)
+	content, _, _ = fifth.GetTemplateFile(page)
+	assert.Equal(t, "{{ .Age }}", content)
+	fifthTypes, err := fifth.GetPackage(ctx, "example.com/test/types")
+	require.NoError(t, err)
+	assert.Same(t, fourthTypes, fifthTypes, "reloading a template should not reload the packages")
+}
+
+func TestRegistryCacheWidensLoad(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	files := map[string]string{
+		"go.mod": `
+module example.com/test
+
+go 1.21
+`,
+		"embed.go": `
+package test
+
+import "embed"
+
+//go:embed templates/*.tmpl
+var Templates embed.FS
+
+type Person struct {
+	Name string
+}
+`,
+		"templates/page.tmpl": `{{- /*gotype: test.Person*/ -}}{{ .Name }}`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
+
+	page := filepath.Join(tmpDir, "templates", "page.tmpl")
+
+	registry, err := ast.NewRegistryCache().Registry(ctx, page, nil, "test.Person")
+	require.NoError(t, err)
+
+	_, pkg, ok := registry.GetTemplateFile(page)
+	require.True(t, ok, "the package of the parent directory should be loaded")
+	assert.Equal(t, "example.com/test", pkg.Package.PkgPath)
+
+	_, err = registry.GetPackage(ctx, "test")
+	require.NoError(t, err)
+}
+
+func TestRegistryCacheWorkspaceRegistry(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	files := map[string]string{
+		"go.mod": `
+module example.com/test
+
+go 1.21
+`,
+		"web/web.go": `
+package web
+
+import _ "embed"
+
+//go:embed page.tmpl
+var Page string
+`,
+		"web/page.tmpl": `{{ .Name }}`,
+		"mail/mail.go": `
+package mail
+
+import _ "embed"
+
+//go:embed mail.tmpl
+var Mail string
+`,
+		"mail/mail.tmpl": `{{ .Subject }}`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
+
+	page := filepath.Join(tmpDir, "web", "page.tmpl")
+	mail := filepath.Join(tmpDir, "mail", "mail.tmpl")
+
+	cache := ast.NewRegistryCache()
+
+	registry, err := cache.Registry(ctx, page, nil)
+	require.NoError(t, err)
+	_, _, ok := registry.GetTemplateFile(mail)
+	require.False(t, ok, "only the package of the file should be loaded")
+
+	workspace, err := cache.WorkspaceRegistry(ctx, tmpDir, map[string][]byte{page: []byte("{{ .Title }}")})
+	require.NoError(t, err)
+
+	content, _, ok := workspace.GetTemplateFile(mail)
+	require.True(t, ok, "every package of the workspace should be loaded")
+	assert.Equal(t, "{{ .Subject }}", content)
+
+	content, _, ok = workspace.GetTemplateFile(page)
+	require.True(t, ok)
+	assert.Equal(t, "{{ .Title }}", content, "the template overlay should replace the embedded content")
+
+	webTypes, err := registry.GetPackage(ctx, "example.com/test/web")
+	require.NoError(t, err)
+	workspaceTypes, err := workspace.GetPackage(ctx, "example.com/test/web")
+	require.NoError(t, err)
+	assert.Same(t, webTypes, workspaceTypes, "the packages should be shared with Registry")
+}
+
+func TestRegistryCacheAmbiguousHint(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	files := map[string]string{
+		"go.mod": `
+module example.com/test
+
+go 1.21
+`,
+		"web/web.go": `
+package web
+
+import (
+	"embed"
+
+	"example.com/test/web/models"
+)
+
+//go:embed templates/*.tmpl
+var Templates embed.FS
+
+var _ models.User
+`,
+		"web/templates/page.tmpl": `{{- /*gotype: models.User*/ -}}{{ .Name }}`,
+		"web/models/models.go": `
+package models
+
+type User struct {
+	Name string
+}
+`,
+		"accounts/models/models.go": `
+package models
+
+type User struct {
+	Name string
+}
+`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
+
+	page := filepath.Join(tmpDir, "web", "templates", "page.tmpl")
+
+	// the package name is resolved against every package of the module, like gotmpls check does
+	registry, err := ast.NewRegistryCache().Registry(ctx, page, nil, "models.User")
+	require.NoError(t, err)
+
+	var ambiguous *ast.AmbiguousPackageError
+	_, err = registry.ResolveTypeHint(ctx, "models.User")
+	require.ErrorAs(t, err, &ambiguous)
+	assert.Equal(t, []string{"example.com/test/accounts/models", "example.com/test/web/models"}, ambiguous.Paths)
+
+	// an import path is resolved without loading the rest of the module
+	registry, err = ast.NewRegistryCache().Registry(ctx, page, nil, "example.com/test/web/models.User")
+	require.NoError(t, err)
+
+	_, err = registry.ResolveTypeHint(ctx, "example.com/test/web/models.User")
+	require.NoError(t, err)
+	for _, pkg := range registry.Packages {
+		assert.NotEqual(t, "example.com/test/accounts/models", pkg.Package.PkgPath)
+	}
+}
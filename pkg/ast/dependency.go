@@ -0,0 +1,218 @@
+package ast
+
+import (
+	"context"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/tozd/go/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// dependencyLoadMode only loads the types of a dependency, its templates are never checked
+const dependencyLoadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedImports |
+	packages.NeedDeps |
+	packages.NeedTypes
+
+// dependencyCache keeps the packages that were loaded on demand by their import path, e.g. "net/http"
+// or a package of another module, so that they are only loaded once for the registries of a module
+type dependencyCache struct {
+	mu       sync.Mutex
+	packages map[string]*packages.Package
+	errs     map[string]error
+	// functionSets are the method tables of the function sets, with the named types of the module
+	functionSets map[string]map[string]*TemplateMethodInfo
+}
+
+func newDependencyCache() *dependencyCache {
+	return &dependencyCache{
+		packages: make(map[string]*packages.Package),
+		errs:     make(map[string]error),
+	}
+}
+
+// load loads the package of an import path, resolved from the module of dir
+func (d *dependencyCache) load(ctx context.Context, dir string, importPath string) (*packages.Package, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if pkg, ok := d.packages[importPath]; ok {
+		return pkg, nil
+	}
+	if err, ok := d.errs[importPath]; ok {
+		return nil, err
+	}
+
+	pkg, err := loadDependency(ctx, dir, importPath)
+	if err != nil {
+		d.errs[importPath] = err
+		return nil, err
+	}
+
+	d.packages[importPath] = pkg
+	return pkg, nil
+}
+
+func (d *dependencyCache) list() []*packages.Package {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pkgs := make([]*packages.Package, 0, len(d.packages))
+	for _, pkg := range d.packages {
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+func loadDependency(ctx context.Context, dir string, importPath string) (*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode: dependencyLoadMode,
+		Dir:  dir,
+		Env:  append(os.Environ(), "GO111MODULE=on"),
+	}
+
+	start := time.Now()
+	pkgs, err := packages.Load(cfg, importPath)
+	if err != nil {
+		return nil, errors.Errorf("loading package %s: %w", importPath, err)
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("dir", dir).Str("package", importPath).Dur("duration", time.Since(start)).Msg("loaded dependency")
+
+	if len(pkgs) != 1 || pkgs[0].Types == nil || pkgs[0].Name == "" {
+		if len(pkgs) == 1 && len(pkgs[0].Errors) > 0 {
+			return nil, errors.Errorf("loading package %s: %s", importPath, pkgs[0].Errors[0].Msg)
+		}
+		return nil, errors.Errorf("loading package %s: no package found", importPath)
+	}
+
+	return pkgs[0], nil
+}
+
+// importPackage returns the package of an import path among the dependencies of the loaded packages,
+// e.g. "time" or "net/http", or loads it, e.g. from another module
+func (r *Registry) importPackage(ctx context.Context, importPath string) (*types.Package, error) {
+	if pkg := r.findImport(importPath); pkg != nil {
+		zerolog.Ctx(ctx).Trace().Str("package", importPath).Msg("found dependency")
+		return pkg.Types, nil
+	}
+
+	dir := r.dependencyDir()
+	if dir == "" || !isImportPath(importPath) {
+		zerolog.Ctx(ctx).Trace().Str("packageName", importPath).Msg("not found")
+		return nil, errors.Errorf("package %s not found", importPath)
+	}
+
+	if r.dependencies == nil {
+		r.dependencies = newDependencyCache()
+	}
+	pkg, err := r.dependencies.load(ctx, dir, importPath)
+	if err != nil {
+		zerolog.Ctx(ctx).Trace().Err(err).Str("packageName", importPath).Msg("not found")
+		return nil, errors.Errorf("package %s not found: %w", importPath, err)
+	}
+
+	return pkg.Types, nil
+}
+
+// functionSets returns the method tables of the function sets, with the named types of the standard
+// library resolved from the loaded packages, so that e.g. the time.Time returned by sprig's now is
+// identical to the time.Time of a field
+func (r *Registry) functionSets(ctx context.Context) map[string]map[string]*TemplateMethodInfo {
+	if r.dependencies == nil || r.dependencyDir() == "" {
+		return FunctionSets
+	}
+
+	r.dependencies.mu.Lock()
+	sets := r.dependencies.functionSets
+	r.dependencies.mu.Unlock()
+	if sets != nil {
+		return sets
+	}
+
+	// the lock is not held while resolving, as the named types may be loaded on demand
+	sets = generateFunctionSets(func(pkgPath string, name string) types.Type {
+		if !isStandardPackage(pkgPath) {
+			return nil
+		}
+		pkg, err := r.importPackage(ctx, pkgPath)
+		if err != nil {
+			return nil
+		}
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil
+		}
+		return obj.Type()
+	})
+
+	r.dependencies.mu.Lock()
+	r.dependencies.functionSets = sets
+	r.dependencies.mu.Unlock()
+
+	return sets
+}
+
+// isStandardPackage reports whether an import path is a package of the standard library
+func isStandardPackage(importPath string) bool {
+	first, _, _ := strings.Cut(importPath, "/")
+	return !strings.Contains(first, ".")
+}
+
+// isImportPath reports whether a package of a type hint can be loaded as an import path, rather than
+// being a pattern or a directory
+func isImportPath(name string) bool {
+	return name != "" &&
+		!strings.HasPrefix(name, ".") &&
+		!strings.Contains(name, "...") &&
+		!filepath.IsAbs(name) &&
+		!strings.ContainsAny(name, " \t\\")
+}
+
+// dependencyDir returns the directory dependencies are resolved from: the module of the loaded
+// packages. It is empty if no package was loaded from disk.
+func (r *Registry) dependencyDir() string {
+	for _, pkg := range r.Packages {
+		if pkg.Package.Module != nil && pkg.Package.Module.Dir != "" {
+			return pkg.Package.Module.Dir
+		}
+		if len(pkg.Package.GoFiles) > 0 {
+			return filepath.Dir(pkg.Package.GoFiles[0])
+		}
+	}
+	return ""
+}
+
+// findImport returns the package of an import path among the loaded packages and their dependencies
+func (r *Registry) findImport(importPath string) *packages.Package {
+	seen := map[*packages.Package]bool{}
+	stack := []*packages.Package{}
+	for _, pkg := range r.Packages {
+		stack = append(stack, pkg.Package)
+	}
+
+	for len(stack) > 0 {
+		pkg := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if pkg == nil || seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+
+		if pkg.PkgPath == importPath && pkg.Types != nil {
+			return pkg
+		}
+		for _, imp := range pkg.Imports {
+			stack = append(stack, imp)
+		}
+	}
+
+	return nil
+}
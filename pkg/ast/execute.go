@@ -0,0 +1,472 @@
+package ast
+
+import (
+	"context"
+	goast "go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/packages"
+)
+
+// ExecuteHint is the static type of the data a template is executed with by a call to Execute or
+// ExecuteTemplate in the go code of a package. It is used as the type hint of templates that do not
+// have a gotype comment.
+//
+// Example:
+//
+//	//go:embed templates
+//	var files embed.FS
+//
+//	var tmpl = template.Must(template.ParseFS(files, "templates/*.tmpl"))
+//
+//	tmpl.ExecuteTemplate(w, "invoice.tmpl", &Invoice{}) // invoice.tmpl is executed with an Invoice
+type ExecuteHint struct {
+	// Name is the name of the executed template, a define or the content of a file
+	Name string
+	// Files are the template files parsed into the executed template, with the name their content is
+	// defined as (the base name of the file, or the name of the template it is parsed into by Parse)
+	Files map[string]string
+	// TypePath is the type of the data, e.g. "github.com/example/types.Invoice" or "[]github.com/example/types.Row"
+	TypePath string
+	// Position is the position of the call in the go code
+	Position token.Position
+}
+
+// LoadExecuteHints returns the types of the data that the templates of a package are executed with.
+//
+// The receiver of every call to Execute or ExecuteTemplate of text/template and html/template is
+// followed back through variables, fields and calls like Must, New, Funcs and Lookup, to the
+// ParseFS, ParseFiles, ParseGlob and Parse calls that read its templates. Calls whose receiver, name
+// or files can not be determined statically, or whose data is an interface, are skipped.
+func LoadExecuteHints(ctx context.Context, pkg *packages.Package) []*ExecuteHint {
+	hints := []*ExecuteHint{}
+
+	if pkg == nil || pkg.TypesInfo == nil {
+		return hints
+	}
+
+	r := &templateResolver{
+		pkg:         pkg,
+		assignments: map[types.Object][]goast.Expr{},
+		embeds:      map[types.Object][]string{},
+		resolving:   map[types.Object]bool{},
+	}
+	r.collect()
+
+	for _, file := range pkg.Syntax {
+		goast.Inspect(file, func(n goast.Node) bool {
+			call, ok := n.(*goast.CallExpr)
+			if !ok {
+				return true
+			}
+			if hint := r.executeHint(ctx, call); hint != nil {
+				hints = append(hints, hint)
+			}
+			return true
+		})
+	}
+
+	return hints
+}
+
+// parsedTemplate is what is known statically about a *template.Template value
+type parsedTemplate struct {
+	name  string            // the name of the template, empty if unknown
+	files map[string]string // the name the content of each parsed file is defined as, by file path
+}
+
+// templateResolver follows *template.Template values back to the calls that create them
+type templateResolver struct {
+	pkg *packages.Package
+	// assignments are the values assigned to the variables and fields of the package
+	assignments map[types.Object][]goast.Expr
+	// embeds are the //go:embed patterns of the variables of the package
+	embeds    map[types.Object][]string
+	resolving map[types.Object]bool
+}
+
+// collect records the values assigned to variables and fields, and the go:embed patterns of variables
+func (r *templateResolver) collect() {
+	info := r.pkg.TypesInfo
+
+	assign := func(lhs goast.Expr, value goast.Expr) {
+		var obj types.Object
+		switch x := lhs.(type) {
+		case *goast.Ident:
+			obj = info.ObjectOf(x)
+		case *goast.SelectorExpr:
+			obj = info.ObjectOf(x.Sel)
+		}
+		if obj != nil && value != nil {
+			r.assignments[obj] = append(r.assignments[obj], value)
+		}
+	}
+
+	for _, file := range r.pkg.Syntax {
+		goast.Inspect(file, func(n goast.Node) bool {
+			switch x := n.(type) {
+			case *goast.GenDecl:
+				for _, spec := range x.Specs {
+					vs, ok := spec.(*goast.ValueSpec)
+					if !ok {
+						continue
+					}
+					patterns := append(embedPatterns(x.Doc), embedPatterns(vs.Doc)...)
+					for i, name := range vs.Names {
+						if obj := info.Defs[name]; obj != nil && len(patterns) > 0 {
+							r.embeds[obj] = patterns
+						}
+						if value := assignedValue(len(vs.Names), vs.Values, i); value != nil {
+							assign(name, value)
+						}
+					}
+				}
+			case *goast.AssignStmt:
+				for i, lhs := range x.Lhs {
+					if value := assignedValue(len(x.Lhs), x.Rhs, i); value != nil {
+						assign(lhs, value)
+					}
+				}
+			case *goast.KeyValueExpr:
+				// fields set in a composite literal
+				if key, ok := x.Key.(*goast.Ident); ok {
+					assign(key, x.Value)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// assignedValue returns the value assigned to the i-th of n names, which is the first result of
+// a call for `t, err := template.ParseFS(...)`
+func assignedValue(n int, values []goast.Expr, i int) goast.Expr {
+	switch {
+	case len(values) == n:
+		return values[i]
+	case len(values) == 1 && i == 0:
+		return values[0]
+	}
+	return nil
+}
+
+// executeHint returns the hint of a call to Execute or ExecuteTemplate, nil if it is another call
+// or can not be determined statically
+func (r *templateResolver) executeHint(ctx context.Context, call *goast.CallExpr) *ExecuteHint {
+	sel, ok := call.Fun.(*goast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	method, recv := r.templateFunc(sel)
+	if !recv {
+		return nil
+	}
+
+	var name string
+	var data goast.Expr
+	switch method {
+	case "Execute":
+		if len(call.Args) != 2 {
+			return nil
+		}
+		data = call.Args[1]
+	case "ExecuteTemplate":
+		if len(call.Args) != 3 {
+			return nil
+		}
+		var ok bool
+		if name, ok = r.constantString(call.Args[1]); !ok {
+			return nil
+		}
+		data = call.Args[2]
+	default:
+		return nil
+	}
+
+	tmpl := r.resolve(sel.X)
+	if tmpl == nil || len(tmpl.files) == 0 {
+		return nil
+	}
+	if method == "Execute" {
+		name = tmpl.name
+	}
+	if name == "" {
+		return nil
+	}
+
+	pos := r.pkg.Fset.Position(call.Pos())
+
+	typePath := dataTypePath(r.pkg.TypesInfo.TypeOf(data))
+	if typePath == "" {
+		zerolog.Ctx(ctx).Debug().Str("call", pos.String()).Msg("skipping template execution with data of an interface type")
+		return nil
+	}
+
+	return &ExecuteHint{Name: name, Files: tmpl.files, TypePath: typePath, Position: pos}
+}
+
+// resolve returns the template an expression of type *template.Template evaluates to, nil if it
+// can not be determined statically
+func (r *templateResolver) resolve(expr goast.Expr) *parsedTemplate {
+	switch x := expr.(type) {
+	case *goast.ParenExpr:
+		return r.resolve(x.X)
+	case *goast.Ident:
+		return r.resolveObject(r.pkg.TypesInfo.ObjectOf(x))
+	case *goast.SelectorExpr:
+		// a field of a struct, or a variable of another package
+		return r.resolveObject(r.pkg.TypesInfo.ObjectOf(x.Sel))
+	case *goast.CallExpr:
+		return r.resolveCall(x)
+	}
+	return nil
+}
+
+// resolveObject resolves a variable or field by the values assigned to it, the first that resolves wins
+func (r *templateResolver) resolveObject(obj types.Object) *parsedTemplate {
+	if obj == nil || r.resolving[obj] {
+		return nil
+	}
+	r.resolving[obj] = true
+	defer delete(r.resolving, obj)
+
+	for _, value := range r.assignments[obj] {
+		if tmpl := r.resolve(value); tmpl != nil {
+			return tmpl
+		}
+	}
+	return nil
+}
+
+// resolveCall resolves the calls of text/template and html/template that return a template
+func (r *templateResolver) resolveCall(call *goast.CallExpr) *parsedTemplate {
+	sel, ok := call.Fun.(*goast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	name, method := r.templateFunc(sel)
+
+	// the template the call is made on, an empty one for the functions of the package
+	base := &parsedTemplate{files: map[string]string{}}
+	if method {
+		if base = r.resolve(sel.X); base == nil {
+			return nil
+		}
+	}
+
+	switch name {
+	case "Must":
+		// the arguments are usually the results of a single call, e.g. Must(ParseFS(...))
+		if method || len(call.Args) == 0 {
+			return nil
+		}
+		return r.resolve(call.Args[0])
+	case "New", "Lookup":
+		if len(call.Args) != 1 {
+			return nil
+		}
+		tmplName, ok := r.constantString(call.Args[0])
+		if !ok {
+			return nil
+		}
+		return &parsedTemplate{name: tmplName, files: base.files}
+	case "Funcs", "Option", "Delims", "Clone":
+		if !method {
+			return nil
+		}
+		return base
+	case "Parse":
+		if !method || len(call.Args) != 1 || base.name == "" {
+			return nil
+		}
+		files := r.embeddedTemplates(call.Args[0])
+		if len(files) != 1 {
+			return nil
+		}
+		return base.with(base.name, map[string]string{files[0]: base.name})
+	case "ParseFS", "ParseFiles", "ParseGlob":
+		files := r.parsedFiles(name, call.Args)
+		if len(files) == 0 {
+			return nil
+		}
+		parsed := map[string]string{}
+		for _, file := range files {
+			parsed[file] = filepath.Base(file)
+		}
+		tmplName := base.name
+		if !method {
+			// the functions of the package name the template after the first file
+			tmplName = filepath.Base(files[0])
+		}
+		return base.with(tmplName, parsed)
+	}
+
+	return nil
+}
+
+// with returns the template with more files parsed into it
+func (t *parsedTemplate) with(name string, files map[string]string) *parsedTemplate {
+	merged := map[string]string{}
+	for file, n := range t.files {
+		merged[file] = n
+	}
+	for file, n := range files {
+		merged[file] = n
+	}
+	return &parsedTemplate{name: name, files: merged}
+}
+
+// templateFunc returns the name of the function or method of text/template or html/template that
+// a selector refers to, and whether it is a method of *template.Template
+func (r *templateResolver) templateFunc(sel *goast.SelectorExpr) (string, bool) {
+	fn, ok := r.pkg.TypesInfo.ObjectOf(sel.Sel).(*types.Func)
+	if !ok || fn.Pkg() == nil || !isTemplatePackage(fn.Pkg().Path()) {
+		return "", false
+	}
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok {
+		return "", false
+	}
+	return fn.Name(), sig.Recv() != nil
+}
+
+// parsedFiles returns the files read by a call to ParseFS, ParseFiles or ParseGlob, in the order they
+// are parsed. The files are matched against the files embedded by the package for ParseFS, and
+// against the files on disk relative to the package directory for ParseFiles and ParseGlob.
+func (r *templateResolver) parsedFiles(fn string, args []goast.Expr) []string {
+	if fn == "ParseFS" {
+		if len(args) == 0 {
+			return nil
+		}
+		args = args[1:]
+	}
+
+	dir := r.packageDir()
+	files := []string{}
+
+	for _, arg := range args {
+		value, ok := r.constantString(arg)
+		if !ok {
+			return nil
+		}
+
+		switch fn {
+		case "ParseFS":
+			files = append(files, r.matchEmbedFiles(value)...)
+		case "ParseFiles":
+			if !filepath.IsAbs(value) {
+				value = filepath.Join(dir, value)
+			}
+			files = append(files, value)
+		case "ParseGlob":
+			matches, err := filepath.Glob(filepath.Join(dir, value))
+			if err != nil {
+				return nil
+			}
+			files = append(files, matches...)
+		}
+	}
+
+	return files
+}
+
+// embeddedTemplates returns the embedded file a string variable is initialized with by a go:embed directive
+func (r *templateResolver) embeddedTemplates(expr goast.Expr) []string {
+	ident, ok := expr.(*goast.Ident)
+	if !ok {
+		return nil
+	}
+	files := []string{}
+	for _, pattern := range r.embeds[r.pkg.TypesInfo.ObjectOf(ident)] {
+		files = append(files, r.matchEmbedFiles(pattern)...)
+	}
+	return files
+}
+
+// matchEmbedFiles returns the embedded files of the package that match a pattern relative to the
+// package directory, in the order of fs.Glob
+func (r *templateResolver) matchEmbedFiles(pattern string) []string {
+	dir := r.packageDir()
+	files := []string{}
+	for _, file := range r.pkg.EmbedFiles {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			continue
+		}
+		if ok, err := path.Match(pattern, filepath.ToSlash(rel)); err == nil && ok {
+			files = append(files, file)
+		}
+	}
+	slices.Sort(files)
+	return files
+}
+
+func (r *templateResolver) packageDir() string {
+	if len(r.pkg.GoFiles) > 0 {
+		return filepath.Dir(r.pkg.GoFiles[0])
+	}
+	return r.pkg.Dir
+}
+
+func (r *templateResolver) constantString(expr goast.Expr) (string, bool) {
+	tv, ok := r.pkg.TypesInfo.Types[expr]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
+
+// embedPatterns returns the patterns of the //go:embed directives of a comment group
+func embedPatterns(doc *goast.CommentGroup) []string {
+	if doc == nil {
+		return nil
+	}
+	patterns := []string{}
+	for _, c := range doc.List {
+		if rest, ok := strings.CutPrefix(c.Text, "//go:embed "); ok {
+			patterns = append(patterns, strings.Fields(rest)...)
+		}
+	}
+	return patterns
+}
+
+// dataTypePath returns the type hint of the static type of the data a template is executed with,
+// e.g. "*github.com/example/types.Invoice" or "[]github.com/example/types.Row". Pointers are kept,
+// as they decide which methods can be called. An empty string is returned for interfaces, whose
+// dynamic type is only known at execution time.
+func dataTypePath(typ types.Type) string {
+	if typ == nil || types.IsInterface(typ) {
+		return ""
+	}
+	return types.TypeString(typ, func(pkg *types.Package) string {
+		return pkg.Path()
+	})
+}
+
+// isTemplatePackage reports whether a package path is text/template or html/template
+func isTemplatePackage(path string) bool {
+	return path == "text/template" || path == "html/template" || strings.HasSuffix(path, "/text/template")
+}
+
+// ExecuteHints returns the hints of the calls that execute a template of a file
+func (r *Registry) ExecuteHints(file string) []*ExecuteHint {
+	hints := []*ExecuteHint{}
+	if r == nil {
+		return hints
+	}
+	for _, pkg := range r.Packages {
+		for _, hint := range pkg.ExecuteHints {
+			if _, ok := hint.Files[file]; ok {
+				hints = append(hints, hint)
+			}
+		}
+	}
+	return hints
+}
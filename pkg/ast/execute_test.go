@@ -0,0 +1,147 @@
+package ast_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+)
+
+func TestLoadExecuteHints(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	files := map[string]string{
+		"go.mod": `
+module example.com/test
+
+go 1.21
+`,
+		"templates/invoice.tmpl": `{{ .Number }}{{ define "row" }}{{ .Title }}{{ end }}`,
+		"templates/email.tmpl":   `{{ .Address }}`,
+		"report.tmpl":            `{{ .Total }}`,
+		"page.tmpl":              `{{ .Title }}`,
+		"main.go": `
+package test
+
+import (
+	"embed"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+type Invoice struct{ Number string }
+type LineItem struct{ Title string }
+type Email struct{ Address string }
+type Report struct{ Total int }
+type Page struct{ Title string }
+
+//go:embed templates
+var files embed.FS
+
+//go:embed report.tmpl
+var reportTemplate string
+
+//go:embed page.tmpl
+var pageFS embed.FS
+
+var invoices = template.Must(template.ParseFS(files, "templates/*.tmpl"))
+
+type server struct {
+	report *template.Template
+}
+
+func newServer() *server {
+	return &server{report: template.Must(template.New("report").Parse(reportTemplate))}
+}
+
+func (s *server) render(w io.Writer) error {
+	if err := invoices.ExecuteTemplate(w, "invoice.tmpl", &Invoice{}); err != nil {
+		return err
+	}
+	if err := invoices.ExecuteTemplate(w, "row", LineItem{}); err != nil {
+		return err
+	}
+	if err := invoices.Lookup("email.tmpl").Execute(w, Email{}); err != nil {
+		return err
+	}
+
+	page, err := htmltemplate.New("page.tmpl").ParseFS(pageFS, "page.tmpl")
+	if err != nil {
+		return err
+	}
+	if err := page.Execute(w, &Page{}); err != nil {
+		return err
+	}
+
+	// data of an interface type is only known at execution time
+	var data any = Invoice{}
+	if err := invoices.ExecuteTemplate(w, "invoice.tmpl", data); err != nil {
+		return err
+	}
+
+	if err := invoices.ExecuteTemplate(w, "rows", []LineItem{}); err != nil {
+		return err
+	}
+
+	// names that are not constant are not known statically
+	name := "row"
+	if err := invoices.ExecuteTemplate(w, name, LineItem{}); err != nil {
+		return err
+	}
+
+	return s.report.Execute(w, Report{})
+}
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	registry, err := ast.AnalyzePackage(ctx, tmpDir, nil)
+	require.NoError(t, err)
+	require.Len(t, registry.Packages, 1)
+
+	pkg := registry.Packages[0]
+	dir := filepath.Dir(pkg.Package.GoFiles[0])
+	invoice := filepath.Join(dir, "templates", "invoice.tmpl")
+	email := filepath.Join(dir, "templates", "email.tmpl")
+
+	// the hints are described as "<name> <type> <files>"
+	got := []string{}
+	for _, hint := range pkg.ExecuteHints {
+		described := hint.Name + " " + hint.TypePath
+		parsed := []string{}
+		for file, name := range hint.Files {
+			rel, err := filepath.Rel(dir, file)
+			require.NoError(t, err)
+			parsed = append(parsed, rel+"="+name)
+		}
+		sort.Strings(parsed)
+		for _, file := range parsed {
+			described += " " + file
+		}
+		got = append(got, described)
+		assert.Equal(t, "main.go", filepath.Base(hint.Position.Filename))
+	}
+
+	assert.ElementsMatch(t, []string{
+		"invoice.tmpl *example.com/test.Invoice templates/email.tmpl=email.tmpl templates/invoice.tmpl=invoice.tmpl",
+		"row example.com/test.LineItem templates/email.tmpl=email.tmpl templates/invoice.tmpl=invoice.tmpl",
+		"rows []example.com/test.LineItem templates/email.tmpl=email.tmpl templates/invoice.tmpl=invoice.tmpl",
+		"email.tmpl example.com/test.Email templates/email.tmpl=email.tmpl templates/invoice.tmpl=invoice.tmpl",
+		"page.tmpl *example.com/test.Page page.tmpl=page.tmpl",
+		"report example.com/test.Report report.tmpl=report",
+	}, got)
+
+	assert.Len(t, registry.ExecuteHints(invoice), 4)
+	assert.Len(t, registry.ExecuteHints(email), 4)
+	assert.Empty(t, registry.ExecuteHints(filepath.Join(dir, "unknown.tmpl")))
+}
@@ -0,0 +1,194 @@
+package ast
+
+import (
+	"context"
+	goast "go/ast"
+	"go/constant"
+	"go/types"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/tools/go/packages"
+)
+
+// FuncMapDirective marks a template.FuncMap variable, or a function returning one, whose entries
+// can be called from the package's templates.
+//
+// Example:
+//
+//	//gotmpls:funcmap
+//	var Funcs = template.FuncMap{
+//		"title": strings.Title,
+//		"add":   func(a, b int) int { return a + b },
+//	}
+const FuncMapDirective = "//gotmpls:funcmap"
+
+// LoadFuncMaps returns the functions declared in the annotated FuncMaps of a package, keyed by their
+// template name. The signature of each entry is read from the package's type information.
+//
+// Entries are read from FuncMap composite literals, and from assignments like `funcs["name"] = fn`
+// in annotated functions. Entries whose key is not a constant string, or whose value is not a
+// function, are skipped.
+func LoadFuncMaps(ctx context.Context, pkg *packages.Package) map[string]*TemplateMethodInfo {
+	methods := make(map[string]*TemplateMethodInfo)
+
+	if pkg == nil || pkg.TypesInfo == nil {
+		return methods
+	}
+
+	for _, file := range pkg.Syntax {
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *goast.GenDecl:
+				for _, spec := range d.Specs {
+					vs, ok := spec.(*goast.ValueSpec)
+					if !ok || !(hasFuncMapDirective(d.Doc) || hasFuncMapDirective(vs.Doc)) {
+						continue
+					}
+					for _, value := range vs.Values {
+						collectFuncMapEntries(ctx, pkg.TypesInfo, value, methods)
+					}
+				}
+			case *goast.FuncDecl:
+				if d.Body == nil || !hasFuncMapDirective(d.Doc) {
+					continue
+				}
+				collectFuncMapEntries(ctx, pkg.TypesInfo, d.Body, methods)
+			}
+		}
+	}
+
+	return methods
+}
+
+// TemplateMethods returns the functions that can be called from a template file: the builtins merged
+// with the enabled function sets and the FuncMaps of the package that embeds it. Templates that are not
+// embedded by a package in the registry (e.g. unsaved or loose files) can call the FuncMaps of every package.
+//
+// The sets are enabled in addition to the registry's FunctionSets, e.g. from a comment directive in
+// the template. Unknown sets are ignored.
+func (r *Registry) TemplateMethods(file string, sets ...string) map[string]*TemplateMethodInfo {
+	methods := make(map[string]*TemplateMethodInfo, len(BuiltinTemplateMethods))
+	for name, method := range BuiltinTemplateMethods {
+		methods[name] = method
+	}
+
+	if r == nil {
+		return methods
+	}
+
+	enabled := append(append([]string{}, r.FunctionSets...), sets...)
+	if len(enabled) > 0 {
+		functionSets := r.functionSets(context.Background())
+		for _, set := range enabled {
+			for name, method := range functionSets[set] {
+				methods[name] = method
+			}
+		}
+	}
+
+	pkgs := r.Packages
+	for _, pkg := range r.Packages {
+		if _, ok := pkg.TemplateFiles[file]; ok {
+			pkgs = []*PackageWithTemplateFiles{pkg}
+			break
+		}
+	}
+
+	for _, pkg := range pkgs {
+		for name, method := range pkg.Functions {
+			methods[name] = method
+		}
+	}
+
+	return methods
+}
+
+// AddFunction registers a template function for the package, as if it was declared in an annotated FuncMap
+func (r *PackageWithTemplateFiles) AddFunction(name string, signature *types.Signature) {
+	if r.Functions == nil {
+		r.Functions = make(map[string]*TemplateMethodInfo)
+	}
+	r.Functions[name] = newTemplateMethodInfoFromSignature(name, signature)
+}
+
+func collectFuncMapEntries(ctx context.Context, info *types.Info, node goast.Node, methods map[string]*TemplateMethodInfo) {
+	goast.Inspect(node, func(n goast.Node) bool {
+		switch x := n.(type) {
+		case *goast.FuncLit:
+			// the bodies of function values are not part of the FuncMap
+			return false
+		case *goast.CompositeLit:
+			if !isFuncMap(info.TypeOf(x)) {
+				return true
+			}
+			for _, elt := range x.Elts {
+				if kv, ok := elt.(*goast.KeyValueExpr); ok {
+					addFuncMapEntry(ctx, info, kv.Key, kv.Value, methods)
+				}
+			}
+			return false
+		case *goast.AssignStmt:
+			for i, lhs := range x.Lhs {
+				idx, ok := lhs.(*goast.IndexExpr)
+				if !ok || i >= len(x.Rhs) || !isFuncMap(info.TypeOf(idx.X)) {
+					continue
+				}
+				addFuncMapEntry(ctx, info, idx.Index, x.Rhs[i], methods)
+			}
+		}
+		return true
+	})
+}
+
+func addFuncMapEntry(ctx context.Context, info *types.Info, key, value goast.Expr, methods map[string]*TemplateMethodInfo) {
+	tv, ok := info.Types[key]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		zerolog.Ctx(ctx).Debug().Msg("skipping FuncMap entry without a constant string key")
+		return
+	}
+	name := constant.StringVal(tv.Value)
+
+	sig, ok := info.TypeOf(value).(*types.Signature)
+	if !ok {
+		zerolog.Ctx(ctx).Debug().Str("name", name).Msg("skipping FuncMap entry that is not a function")
+		return
+	}
+
+	methods[name] = newTemplateMethodInfoFromSignature(name, sig)
+}
+
+// isFuncMap reports whether typ is a template.FuncMap from text/template or html/template
+func isFuncMap(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Name() != "FuncMap" {
+		return false
+	}
+	return isTemplatePackage(named.Obj().Pkg().Path())
+}
+
+func hasFuncMapDirective(doc *goast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == FuncMapDirective {
+			return true
+		}
+	}
+	return false
+}
+
+func newTemplateMethodInfoFromSignature(name string, sig *types.Signature) *TemplateMethodInfo {
+	info := &TemplateMethodInfo{
+		Name:     name,
+		Variadic: sig.Variadic(),
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		info.Parameters = append(info.Parameters, sig.Params().At(i).Type())
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		info.Results = append(info.Results, sig.Results().At(i).Type())
+	}
+	return info
+}
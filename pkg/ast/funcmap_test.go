@@ -0,0 +1,118 @@
+package ast_test
+
+import (
+	"go/types"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+)
+
+func TestLoadFuncMaps(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	err := os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte(`
+module example.com/test
+
+go 1.21
+`), 0644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(tmpDir, "funcs.go"), []byte(`
+package test
+
+import (
+	"strings"
+	"text/template"
+)
+
+const greetName = "greet"
+
+//gotmpls:funcmap
+var Funcs = template.FuncMap{
+	"title":   strings.Title,
+	greetName: func(name string) (string, error) { return "hi " + name, nil },
+	"sum": func(nums ...int) int {
+		inner := template.FuncMap{"hidden": strings.ToLower}
+		_ = inner
+		return 0
+	},
+	"notAFunc": 42,
+}
+
+//gotmpls:funcmap
+func MoreFuncs() template.FuncMap {
+	funcs := template.FuncMap{"lower": strings.ToLower}
+	funcs["repeat"] = strings.Repeat
+	return funcs
+}
+
+var NotAnnotated = template.FuncMap{
+	"ignored": strings.ToUpper,
+}
+`), 0644)
+	require.NoError(t, err)
+
+	registry, err := ast.AnalyzePackage(ctx, tmpDir, nil)
+	require.NoError(t, err)
+	require.Len(t, registry.Packages, 1)
+
+	functions := registry.Packages[0].Functions
+
+	names := []string{}
+	for name := range functions {
+		names = append(names, name)
+	}
+	assert.ElementsMatch(t, []string{"title", "greet", "sum", "lower", "repeat"}, names)
+
+	assert.Equal(t, "func(string) string", functions["title"].Signature())
+	assert.Equal(t, "func(string) (string, error)", functions["greet"].Signature())
+	assert.Equal(t, "func(...int) int", functions["sum"].Signature())
+	assert.True(t, functions["sum"].Variadic)
+	assert.Equal(t, "func(string, int) string", functions["repeat"].Signature())
+
+	methods := registry.TemplateMethods("unknown.tmpl")
+	assert.Contains(t, methods, "printf", "builtins should be included")
+	assert.Contains(t, methods, "repeat", "funcmap functions should be included")
+	assert.NotContains(t, ast.BuiltinTemplateMethods, "repeat", "builtins should not be modified")
+}
+
+func TestTemplateMethodsStandardTypes(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	err := os.WriteFile(filepath.Join(tmpDir, "go.mod"), []byte(`
+module example.com/test
+
+go 1.21
+`), 0644)
+	require.NoError(t, err)
+
+	err = os.WriteFile(filepath.Join(tmpDir, "mail.go"), []byte(`
+package test
+
+import "time"
+
+type Email struct {
+	Sent time.Time
+}
+`), 0644)
+	require.NoError(t, err)
+
+	registry, err := ast.AnalyzePackage(ctx, tmpDir, nil)
+	require.NoError(t, err)
+
+	pkg, err := registry.GetPackage(ctx, "example.com/test")
+	require.NoError(t, err)
+	email := pkg.Scope().Lookup("Email").Type().Underlying().(*types.Struct)
+	sent := email.Field(0).Type()
+
+	methods := registry.TemplateMethods("unknown.tmpl", "sprig")
+	assert.True(t, types.Identical(sent, methods["now"].Results[0]), "now should return the time.Time of the module, got %s", methods["now"].Results[0])
+	assert.True(t, types.Identical(sent, methods["unixEpoch"].Parameters[0]), "unixEpoch should accept the time.Time of the module")
+
+	_, hasNow := ast.NewEmptyRegistry().TemplateMethods("unknown.tmpl", "sprig")["now"]
+	assert.True(t, hasNow, "registries without packages should use the function sets as they are")
+}
@@ -0,0 +1,172 @@
+package ast
+
+import (
+	"context"
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"go/types"
+	"regexp"
+	"strings"
+
+	"gitlab.com/tozd/go/errors"
+)
+
+// qualifiedIdentRegex matches the package qualified identifiers of a type hint, e.g.
+// "github.com/example/types.Person" or "types.Person". The package is everything before the last dot.
+var qualifiedIdentRegex = regexp.MustCompile(`([\w\-~./]*[\w\-~])\.([\pL_][\pL\pN_]*)`)
+
+// plainTypeHintRegex matches a hint that is a single qualified identifier, e.g. "github.com/example/types.Person"
+var plainTypeHintRegex = regexp.MustCompile(`^` + qualifiedIdentRegex.String() + `$`)
+
+// HintPackages returns the packages that a type hint refers to, e.g. "github.com/example/types" and
+// "time" for "map[string]*github.com/example/types.Person[time.Time]"
+func HintPackages(hint string) []string {
+	pkgs := []string{}
+	seen := map[string]bool{}
+	for _, match := range qualifiedIdentRegex.FindAllStringSubmatch(hint, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			pkgs = append(pkgs, match[1])
+		}
+	}
+	return pkgs
+}
+
+// qualifyTypeHint qualifies the identifiers of a type hint that are declared in a package, e.g.
+// "map[string]*LineItem" becomes "map[string]*example.com/test.LineItem", so that the hint resolves
+// outside of the package. Identifiers that are already qualified are kept as they are.
+func qualifyTypeHint(hint string, pkg *types.Package) (string, error) {
+	aliases := map[string]string{}
+	expr := qualifiedIdentRegex.ReplaceAllStringFunc(hint, func(qualified string) string {
+		match := qualifiedIdentRegex.FindStringSubmatch(qualified)
+		alias := fmt.Sprintf("_pkg%d", len(aliases))
+		aliases[alias] = match[1]
+		return alias + "." + match[2]
+	})
+
+	node, err := goparser.ParseExpr(expr)
+	if err != nil {
+		return "", errors.Errorf("invalid type hint %s: %w", hint, err)
+	}
+
+	// the names of fields, parameters and methods, and the selected identifiers, are not types
+	names := map[*goast.Ident]bool{}
+	goast.Inspect(node, func(n goast.Node) bool {
+		switch n := n.(type) {
+		case *goast.SelectorExpr:
+			names[n.Sel] = true
+			if x, ok := n.X.(*goast.Ident); ok {
+				names[x] = true
+			}
+		case *goast.Field:
+			for _, name := range n.Names {
+				names[name] = true
+			}
+		}
+		return true
+	})
+
+	// the offsets of the identifiers declared in the package, in order
+	offsets := []int{}
+	var unknown error
+	goast.Inspect(node, func(n goast.Node) bool {
+		ident, ok := n.(*goast.Ident)
+		if !ok || names[ident] {
+			return true
+		}
+		switch {
+		case pkg.Scope().Lookup(ident.Name) != nil:
+			// ParseExpr positions start at 1
+			offsets = append(offsets, int(ident.Pos())-1)
+		case types.Universe.Lookup(ident.Name) == nil && unknown == nil:
+			unknown = errors.Errorf("type %s not found in package %s", ident.Name, pkg.Path())
+		}
+		return true
+	})
+	if unknown != nil {
+		return "", unknown
+	}
+
+	for i := len(offsets) - 1; i >= 0; i-- {
+		expr = expr[:offsets[i]] + pkg.Path() + "." + expr[offsets[i]:]
+	}
+
+	replacements := []string{}
+	for alias, path := range aliases {
+		replacements = append(replacements, alias+".", path+".")
+	}
+	return strings.NewReplacer(replacements...).Replace(expr), nil
+}
+
+// ResolveTypeHint returns the type of a type hint, which is a go type expression whose package
+// qualifiers are import paths or package names of the registry, e.g.
+//
+//	github.com/example/types.Person
+//	[]*types.Row
+//	map[string]types.User
+//	types.Page[types.User]
+//	struct{ Title string; Rows []types.Row }
+//
+// The packages are replaced by identifiers bound to them, and the expression is parsed with go/parser
+// and evaluated with types.Eval, which instantiates generic types with their type arguments.
+func (r *Registry) ResolveTypeHint(ctx context.Context, hint string) (types.Type, error) {
+	// a single named type is looked up directly, which also resolves unexported types
+	if match := plainTypeHintRegex.FindStringSubmatch(hint); match != nil {
+		pkg, err := r.GetPackage(ctx, match[1])
+		if err != nil {
+			return nil, errors.Errorf("resolving type hint %s: %w", hint, err)
+		}
+		obj, ok := pkg.Scope().Lookup(match[2]).(*types.TypeName)
+		if !ok {
+			return nil, errors.Errorf("type %s not found in package %s", match[2], match[1])
+		}
+		if named, ok := obj.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+			return nil, errors.Errorf("generic type %s needs type arguments, e.g. %s[...]", hint, hint)
+		}
+		return obj.Type(), nil
+	}
+
+	scope := types.NewPackage("gotmpls/hint", "hint")
+	aliases := map[string]string{}
+
+	var lookupErr error
+	expr := qualifiedIdentRegex.ReplaceAllStringFunc(hint, func(qualified string) string {
+		match := qualifiedIdentRegex.FindStringSubmatch(qualified)
+		alias, ok := aliases[match[1]]
+		if !ok {
+			pkg, err := r.GetPackage(ctx, match[1])
+			if err != nil {
+				lookupErr = errors.Errorf("resolving type hint %s: %w", hint, err)
+				return qualified
+			}
+			alias = fmt.Sprintf("_pkg%d", len(aliases))
+			aliases[match[1]] = alias
+			scope.Scope().Insert(types.NewPkgName(token.NoPos, scope, alias, pkg))
+		}
+		return alias + "." + match[2]
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+
+	if _, err := goparser.ParseExpr(expr); err != nil {
+		return nil, errors.Errorf("invalid type hint %s: %w", hint, err)
+	}
+
+	tv, err := types.Eval(token.NewFileSet(), scope, token.NoPos, expr)
+	if err != nil {
+		// the errors mention the packages by their path rather than by their alias
+		replacements := []string{}
+		for path, alias := range aliases {
+			replacements = append(replacements, alias, path)
+		}
+		return nil, errors.Errorf("evaluating type hint %s: %s", hint, strings.NewReplacer(replacements...).Replace(err.Error()))
+	}
+	if !tv.IsType() {
+		return nil, errors.Errorf("type hint %s is not a type", hint)
+	}
+
+	return tv.Type, nil
+}
@@ -0,0 +1,135 @@
+package ast_test
+
+import (
+	"context"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+)
+
+func TestResolveTypeHint(t *testing.T) {
+	ctx := context.Background()
+
+	registry := createMockRegistry(t)
+	pkg := registry.Packages[0].Package.Types
+
+	// type Page[T any] struct { Title string; Items []T }
+	param := types.NewTypeParam(types.NewTypeName(0, pkg, "T", nil), types.Universe.Lookup("any").Type())
+	page := types.NewNamed(types.NewTypeName(0, pkg, "Page", nil), nil, nil)
+	page.SetTypeParams([]*types.TypeParam{param})
+	page.SetUnderlying(types.NewStruct([]*types.Var{
+		types.NewField(0, pkg, "Title", types.Typ[types.String], false),
+		types.NewField(0, pkg, "Items", types.NewSlice(param), false),
+	}, nil))
+	pkg.Scope().Insert(page.Obj())
+
+	// type Named interface { GetName() string }
+	named := types.NewNamed(types.NewTypeName(0, pkg, "Named", nil), nil, nil)
+	named.SetUnderlying(types.NewInterfaceType([]*types.Func{
+		types.NewFunc(0, pkg, "GetName", types.NewSignatureType(nil, nil, nil, nil, types.NewTuple(types.NewVar(0, pkg, "", types.Typ[types.String])), false)),
+	}, nil).Complete())
+	pkg.Scope().Insert(named.Obj())
+
+	tests := []struct {
+		name string
+		hint string
+		// want is the type, written with the package names only
+		want string
+		// fields are some of the fields and methods of the type definition of the hint
+		fields  []string
+		wantErr string
+	}{
+		{
+			name:   "named type",
+			hint:   "github.com/example/types.Person",
+			want:   "types.Person",
+			fields: []string{"Name", "GetName"},
+		},
+		{
+			name:   "package name",
+			hint:   "types.Person",
+			want:   "types.Person",
+			fields: []string{"Name"},
+		},
+		{
+			name:   "pointer",
+			hint:   "*github.com/example/types.Person",
+			want:   "*types.Person",
+			fields: []string{"Name", "GetName"},
+		},
+		{
+			name: "slice",
+			hint: "[]github.com/example/types.Person",
+			want: "[]types.Person",
+		},
+		{
+			name: "map of pointers",
+			hint: "map[string]*github.com/example/types.Person",
+			want: "map[string]*types.Person",
+		},
+		{
+			name:   "generic type",
+			hint:   "github.com/example/types.Page[github.com/example/types.Person]",
+			want:   "types.Page[types.Person]",
+			fields: []string{"Title", "Items"},
+		},
+		{
+			name:   "unnamed struct",
+			hint:   "struct{ Title string; People []types.Person }",
+			want:   "struct{Title string; People []types.Person}",
+			fields: []string{"Title", "People"},
+		},
+		{
+			name:   "named interface",
+			hint:   "types.Named",
+			want:   "types.Named",
+			fields: []string{"GetName"},
+		},
+		{
+			name:   "unnamed interface",
+			hint:   "interface{ GetName() string }",
+			want:   "interface{GetName() string}",
+			fields: []string{"GetName"},
+		},
+		{
+			name:    "generic type without type arguments",
+			hint:    "types.Page",
+			wantErr: "needs type arguments",
+		},
+		{
+			name:    "unknown package",
+			hint:    "[]invalid/package.Type",
+			wantErr: "package not found",
+		},
+		{
+			name:    "invalid expression",
+			hint:    "[]types.Person]",
+			wantErr: "invalid type hint",
+		},
+		{
+			name:    "not a type",
+			hint:    "len",
+			wantErr: "not a type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, tt.hint, registry)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, types.TypeString(info.Type, func(p *types.Package) string { return p.Name() }))
+			for _, field := range tt.fields {
+				assert.Contains(t, info.Fields, field)
+			}
+		})
+	}
+}
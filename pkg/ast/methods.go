@@ -26,19 +26,56 @@ type TemplateMethodInfo struct {
 	Name       string
 	Parameters []types.Type
 	Results    []types.Type
+	Variadic   bool // whether the last parameter is variadic, in which case it is a slice
+}
+
+// Signature returns the Go style signature of the method, e.g. "func(string, string) string"
+func (me *TemplateMethodInfo) Signature() string {
+	params := make([]string, len(me.Parameters))
+	for i, param := range me.Parameters {
+		params[i] = param.String()
+		if me.Variadic && i == len(me.Parameters)-1 {
+			if slice, ok := param.(*types.Slice); ok {
+				params[i] = "..." + slice.Elem().String()
+			}
+		}
+	}
+
+	sig := "func(" + strings.Join(params, ", ") + ")"
+
+	results := make([]string, len(me.Results))
+	for i, result := range me.Results {
+		results[i] = result.String()
+	}
+
+	switch len(results) {
+	case 0:
+	case 1:
+		sig += " " + results[0]
+	default:
+		sig += " (" + strings.Join(results, ", ") + ")"
+	}
+
+	return sig
 }
 
 // generateBuiltinTemplateMethods generates the BuiltinTemplateMethods map using reflection
 func generateBuiltinTemplateMethods() map[string]*TemplateMethodInfo {
-	methods := make(map[string]*TemplateMethodInfo)
-
 	// Combine both builtin and extra functions
 	allFuncs := template.BuiltinsExported()
 	for name, fn := range Extras() {
 		allFuncs[name] = fn
 	}
 
-	for name, fn := range allFuncs {
+	return generateTemplateMethods(allFuncs, nil)
+}
+
+// generateTemplateMethods converts the signatures of the functions in a FuncMap using reflection,
+// looking up named types with resolve
+func generateTemplateMethods(funcs template.FuncMap, resolve astreflect.NamedTypeResolver) map[string]*TemplateMethodInfo {
+	methods := make(map[string]*TemplateMethodInfo)
+
+	for name, fn := range funcs {
 		fnType := reflect.TypeOf(fn)
 		if fnType == nil {
 			continue
@@ -48,16 +85,17 @@ func generateBuiltinTemplateMethods() map[string]*TemplateMethodInfo {
 			Name:       name,
 			Parameters: make([]types.Type, fnType.NumIn()),
 			Results:    make([]types.Type, fnType.NumOut()),
+			Variadic:   fnType.IsVariadic(),
 		}
 
 		// Convert parameter types
 		for i := 0; i < fnType.NumIn(); i++ {
-			info.Parameters[i] = astreflect.Reflect2AST(fnType.In(i))
+			info.Parameters[i] = astreflect.Reflect2ASTWithResolver(fnType.In(i), resolve)
 		}
 
 		// Convert result types
 		for i := 0; i < fnType.NumOut(); i++ {
-			info.Results[i] = astreflect.Reflect2AST(fnType.Out(i))
+			info.Results[i] = astreflect.Reflect2ASTWithResolver(fnType.Out(i), resolve)
 		}
 
 		methods[name] = info
@@ -39,6 +39,12 @@ const loadMode = packages.NeedName |
 type PackageWithTemplateFiles struct {
 	Package       *packages.Package
 	TemplateFiles map[string]string
+	// Functions are the template functions declared in the package's //gotmpls:funcmap FuncMaps
+	Functions map[string]*TemplateMethodInfo
+	// ExecuteHints are the types of the data the package executes templates with
+	ExecuteHints []*ExecuteHint
+	// Bindings are the templates bound to types by the package's //gotmpls:bind directives
+	Bindings []*Binding
 }
 
 // var supportedTemplateExtensions = []string{"tmpl", "go"}
@@ -127,22 +133,9 @@ func LoadPackageTypesFromFs(ctx context.Context, dir string, overlay map[string]
 	pkgWithTemplateFilesList := []*PackageWithTemplateFiles{}
 
 	for _, pkg := range pkgs {
-
-		pkgWithTemplateFiles := &PackageWithTemplateFiles{
-			Package:       pkg,
-			TemplateFiles: make(map[string]string),
-		}
-		for _, file := range pkg.EmbedFiles {
-			ext := filepath.Ext(file)
-			// == tmpl, contains .tmpl., starts with tmpl., ends with .tmpl
-			if ext != ".tmpl" && !strings.Contains(file, ".tmpl.") && !strings.HasSuffix(file, ".tmpl") && !strings.HasPrefix(file, "tmpl.") {
-				continue
-			}
-			content, err := os.ReadFile(file)
-			if err != nil {
-				return nil, errors.Errorf("failed to read file: %w", err)
-			}
-			pkgWithTemplateFiles.TemplateFiles[file] = string(content)
+		pkgWithTemplateFiles, err := newPackageWithTemplateFiles(ctx, pkg)
+		if err != nil {
+			return nil, err
 		}
 
 		pkgWithTemplateFilesList = append(pkgWithTemplateFilesList, pkgWithTemplateFiles)
@@ -151,6 +144,35 @@ func LoadPackageTypesFromFs(ctx context.Context, dir string, overlay map[string]
 	return pkgWithTemplateFilesList, nil
 }
 
+// newPackageWithTemplateFiles reads the templates embedded by a loaded package and the functions of its FuncMaps
+func newPackageWithTemplateFiles(ctx context.Context, pkg *packages.Package) (*PackageWithTemplateFiles, error) {
+	pkgWithTemplateFiles := &PackageWithTemplateFiles{
+		Package:       pkg,
+		TemplateFiles: make(map[string]string),
+		Functions:     LoadFuncMaps(ctx, pkg),
+		ExecuteHints:  LoadExecuteHints(ctx, pkg),
+		Bindings:      LoadBindings(ctx, pkg),
+	}
+	for _, file := range pkg.EmbedFiles {
+		if !isTemplateFile(file) {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Errorf("failed to read file: %w", err)
+		}
+		pkgWithTemplateFiles.TemplateFiles[file] = string(content)
+	}
+
+	return pkgWithTemplateFiles, nil
+}
+
+func isTemplateFile(file string) bool {
+	ext := filepath.Ext(file)
+	// == tmpl, contains .tmpl., starts with tmpl., ends with .tmpl
+	return ext == ".tmpl" || strings.Contains(file, ".tmpl.") || strings.HasSuffix(file, ".tmpl") || strings.HasPrefix(file, "tmpl.")
+}
+
 func (me *PackageWithTemplateFiles) LoadTypeByPath(ctx context.Context, path string) (types.Object, error) {
 	final := filepath.Base(path)
 	pkg := me.Package.Types.Scope().Lookup(final)
@@ -2,9 +2,13 @@ package ast
 
 import (
 	"context"
+	"fmt"
+	"go/token"
 	"go/types"
 	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/rs/zerolog"
@@ -18,18 +22,25 @@ type Registry struct {
 	Packages []*PackageWithTemplateFiles
 	// Error encountered during type resolution, if any
 	Err error
+	// FunctionSets are the names of the function sets (e.g. "sprig") enabled for every template
+	FunctionSets []string
+
+	// dependencies are the packages loaded on demand by GetPackage
+	dependencies *dependencyCache
 }
 
 // NewRegistry creates a new Registry
 func NewRegistry(pkgWithTemplateFilesList []*PackageWithTemplateFiles) *Registry {
 	return &Registry{
-		Packages: pkgWithTemplateFilesList,
+		Packages:     pkgWithTemplateFilesList,
+		dependencies: newDependencyCache(),
 	}
 }
 
 func NewEmptyRegistry() *Registry {
 	return &Registry{
-		Packages: []*PackageWithTemplateFiles{},
+		Packages:     []*PackageWithTemplateFiles{},
+		dependencies: newDependencyCache(),
 	}
 }
 
@@ -120,10 +131,24 @@ func (r *Registry) AddInMemoryPackageForTesting(ctx context.Context, path string
 	return pkgWithTemplateFiles
 }
 
-// GetPackage returns a package by name
-func (r *Registry) GetPackage(ctx context.Context, packageName string) (*types.Package, error) {
-	// zerolog.Ctx(ctx).Trace().Str("packageName", packageName).Interface("packages", r.Packages).Msg("looking for package")
+// AmbiguousPackageError is returned when a package name matches more than one loaded package
+type AmbiguousPackageError struct {
+	Name string
+	// Paths are the import paths of the matching packages
+	Paths []string
+}
 
+func (e *AmbiguousPackageError) Error() string {
+	return fmt.Sprintf("package name %s is ambiguous, it matches %s; use the import path instead", e.Name, strings.Join(e.Paths, ", "))
+}
+
+// GetPackage returns a package by its import path, e.g. "github.com/example/types" or "net/http", or
+// by its name or the end of its import path, e.g. "types", if that matches a single loaded package.
+//
+// Import paths are looked up in the loaded packages and then in their dependencies. Packages that
+// are not a dependency of the loaded packages, e.g. of another module of the workspace, are loaded
+// on demand. A name that matches more than one loaded package is an AmbiguousPackageError.
+func (r *Registry) GetPackage(ctx context.Context, packageName string) (*types.Package, error) {
 	// First, try to find an exact match
 	for _, pkg := range r.Packages {
 		if pkg.Package.PkgPath == packageName {
@@ -132,24 +157,29 @@ func (r *Registry) GetPackage(ctx context.Context, packageName string) (*types.P
 		}
 	}
 
-	// Try to find by package name
+	// Try to find by package name or path suffix
+	matches := []string{}
+	var match *types.Package
 	for _, pkg := range r.Packages {
-		if path.Base(pkg.Package.PkgPath) == packageName {
-			zerolog.Ctx(ctx).Trace().Str("packageName", packageName).Str("path", pkg.Package.PkgPath).Msg("found by name")
-			return pkg.Package.Types, nil
+		pkgPath := pkg.Package.PkgPath
+		if slices.Contains(matches, pkgPath) {
+			continue
 		}
-	}
-
-	// Try to find by path suffix
-	for _, pkg := range r.Packages {
-		if strings.HasSuffix(pkg.Package.PkgPath, "/"+packageName) {
-			zerolog.Ctx(ctx).Trace().Str("packageName", packageName).Str("path", pkg.Package.PkgPath).Msg("found by suffix")
-			return pkg.Package.Types, nil
+		if pkg.Package.Name == packageName || path.Base(pkgPath) == packageName || strings.HasSuffix(pkgPath, "/"+packageName) {
+			matches = append(matches, pkgPath)
+			match = pkg.Package.Types
 		}
 	}
+	switch {
+	case len(matches) == 1:
+		zerolog.Ctx(ctx).Trace().Str("packageName", packageName).Str("path", matches[0]).Msg("found by name")
+		return match, nil
+	case len(matches) > 1:
+		sort.Strings(matches)
+		return nil, errors.WithStack(&AmbiguousPackageError{Name: packageName, Paths: matches})
+	}
 
-	zerolog.Ctx(ctx).Trace().Str("packageName", packageName).Msg("not found")
-	return nil, errors.Errorf("package %s not found", packageName)
+	return r.importPackage(ctx, packageName)
 }
 
 // GetTypes retrieves all types from a package
@@ -192,3 +222,32 @@ func (r *Registry) GetFieldType(structType *types.Struct, fieldName string) (typ
 	}
 	return nil, errors.Errorf("field %s not found", fieldName)
 }
+
+// GetObjectPosition returns the source position of the declaration of a go object
+func (r *Registry) GetObjectPosition(obj types.Object) (token.Position, error) {
+	if obj == nil || !obj.Pos().IsValid() {
+		return token.Position{}, errors.Errorf("object has no position")
+	}
+
+	for _, pkg := range r.Packages {
+		if pkg.Package.Fset == nil {
+			continue
+		}
+		if file := pkg.Package.Fset.File(obj.Pos()); file != nil {
+			return pkg.Package.Fset.Position(obj.Pos()), nil
+		}
+	}
+
+	if r.dependencies != nil {
+		for _, pkg := range r.dependencies.list() {
+			if pkg.Fset == nil {
+				continue
+			}
+			if file := pkg.Fset.File(obj.Pos()); file != nil {
+				return pkg.Fset.Position(obj.Pos()), nil
+			}
+		}
+	}
+
+	return token.Position{}, errors.Errorf("position of %s not found", obj.Name())
+}
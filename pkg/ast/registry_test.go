@@ -3,9 +3,12 @@ package ast_test
 import (
 	"context"
 	"go/types"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/walteh/gotmpls/pkg/ast"
 )
 
@@ -170,3 +173,98 @@ func TestRegistry_TypeExists(t *testing.T) {
 		})
 	}
 }
+
+func TestRegistry_GetPackageDependencies(t *testing.T) {
+	tmpDir, ctx := setupTestModule(t)
+
+	files := map[string]string{
+		"app/go.mod": `
+module example.com/app
+
+go 1.21
+
+require example.com/shared v0.0.0
+
+replace example.com/shared => ../shared
+`,
+		"app/main.go": `
+package app
+
+import "time"
+
+type Email struct {
+	Sent time.Time
+}
+`,
+		"app/billing/types/types.go": `
+package types
+
+type Invoice struct{ Number string }
+`,
+		"app/users/types/types.go": `
+package types
+
+type User struct{ Name string }
+`,
+		"shared/go.mod": `
+module example.com/shared
+
+go 1.21
+`,
+		"shared/mail/mail.go": `
+package mail
+
+type Message struct{ Subject string }
+`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	registry, err := ast.AnalyzePackage(ctx, filepath.Join(tmpDir, "app"), nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		packageName string
+		wantPath    string
+		wantErr     string
+	}{
+		{name: "import path", packageName: "example.com/app/billing/types", wantPath: "example.com/app/billing/types"},
+		{name: "unique suffix", packageName: "users/types", wantPath: "example.com/app/users/types"},
+		{name: "dependency", packageName: "time", wantPath: "time"},
+		{name: "standard library package that is not imported", packageName: "net/http", wantPath: "net/http"},
+		{name: "package of another module", packageName: "example.com/shared/mail", wantPath: "example.com/shared/mail"},
+		{
+			name:        "ambiguous name",
+			packageName: "types",
+			wantErr:     "package name types is ambiguous, it matches example.com/app/billing/types, example.com/app/users/types; use the import path instead",
+		},
+		{name: "unknown import path", packageName: "example.com/missing", wantErr: "package example.com/missing not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkg, err := registry.GetPackage(ctx, tt.packageName)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPath, pkg.Path())
+		})
+	}
+
+	var ambiguous *ast.AmbiguousPackageError
+	_, err = registry.GetPackage(ctx, "types")
+	require.ErrorAs(t, err, &ambiguous)
+	assert.Equal(t, []string{"example.com/app/billing/types", "example.com/app/users/types"}, ambiguous.Paths)
+
+	typ, err := registry.ResolveTypeHint(ctx, "map[string]*net/http.Request")
+	require.NoError(t, err)
+	assert.Equal(t, "map[string]*net/http.Request", typ.String())
+}
@@ -0,0 +1,314 @@
+package ast
+
+import (
+	"sort"
+	"time"
+
+	"github.com/walteh/gotmpls/pkg/astreflect"
+	"github.com/walteh/gotmpls/pkg/std/text/template"
+)
+
+// The function sets are catalogs of well known template function libraries. They only describe
+// the signatures of the functions, which are declared as typed nil functions so that they can be
+// converted with reflection like the builtins, without depending on the libraries themselves.
+//
+// A set is enabled for a workspace through the LSP configuration, or for a single template with
+// a comment directive:
+//
+//	{{/* gotmpls:funcs sprig */}}
+
+// Sprig returns the signatures of the sprig (github.com/Masterminds/sprig/v3) template functions,
+// along with the yaml functions that sprout and most sprig based tools provide.
+func Sprig() template.FuncMap {
+	type dict = map[string]interface{}
+
+	return template.FuncMap{
+		// date functions
+		"ago":            (func(date interface{}) string)(nil),
+		"date":           (func(fmt string, date interface{}) string)(nil),
+		"date_in_zone":   (func(fmt string, date interface{}, zone string) string)(nil),
+		"date_modify":    (func(fmt string, date time.Time) time.Time)(nil),
+		"dateInZone":     (func(fmt string, date interface{}, zone string) string)(nil),
+		"dateModify":     (func(fmt string, date time.Time) time.Time)(nil),
+		"duration":       (func(sec interface{}) string)(nil),
+		"durationRound":  (func(duration interface{}) string)(nil),
+		"htmlDate":       (func(date interface{}) string)(nil),
+		"htmlDateInZone": (func(date interface{}, zone string) string)(nil),
+		"mustDateModify": (func(fmt string, date time.Time) (time.Time, error))(nil),
+		"mustToDate":     (func(fmt, str string) (time.Time, error))(nil),
+		"now":            (func() time.Time)(nil),
+		"toDate":         (func(fmt, str string) time.Time)(nil),
+		"unixEpoch":      (func(date time.Time) string)(nil),
+
+		// string functions
+		"abbrev":       (func(width int, s string) string)(nil),
+		"abbrevboth":   (func(left, right int, s string) string)(nil),
+		"camelcase":    (func(s string) string)(nil),
+		"cat":          (func(v ...interface{}) string)(nil),
+		"contains":     (func(substr string, str string) bool)(nil),
+		"hasPrefix":    (func(substr string, str string) bool)(nil),
+		"hasSuffix":    (func(substr string, str string) bool)(nil),
+		"hello":        (func() string)(nil),
+		"indent":       (func(spaces int, v string) string)(nil),
+		"initials":     (func(s string) string)(nil),
+		"kebabcase":    (func(s string) string)(nil),
+		"lower":        (func(s string) string)(nil),
+		"nindent":      (func(spaces int, v string) string)(nil),
+		"nospace":      (func(s string) string)(nil),
+		"plural":       (func(one, many string, count int) string)(nil),
+		"quote":        (func(str ...interface{}) string)(nil),
+		"randAlpha":    (func(count int) string)(nil),
+		"randAlphaNum": (func(count int) string)(nil),
+		"randAscii":    (func(count int) string)(nil),
+		"randNumeric":  (func(count int) string)(nil),
+		"repeat":       (func(count int, str string) string)(nil),
+		"replace":      (func(old, new, src string) string)(nil),
+		"shuffle":      (func(s string) string)(nil),
+		"snakecase":    (func(s string) string)(nil),
+		"squote":       (func(str ...interface{}) string)(nil),
+		"substr":       (func(start, end int, s string) string)(nil),
+		"swapcase":     (func(s string) string)(nil),
+		"title":        (func(s string) string)(nil),
+		"trim":         (func(s string) string)(nil),
+		"trimAll":      (func(cutset, s string) string)(nil),
+		"trimall":      (func(cutset, s string) string)(nil),
+		"trimPrefix":   (func(prefix, s string) string)(nil),
+		"trimSuffix":   (func(suffix, s string) string)(nil),
+		"trunc":        (func(c int, s string) string)(nil),
+		"untitle":      (func(s string) string)(nil),
+		"upper":        (func(s string) string)(nil),
+		"wrap":         (func(l int, s string) string)(nil),
+		"wrapWith":     (func(l int, sep, str string) string)(nil),
+
+		// string slice functions
+		"join":      (func(sep string, v interface{}) string)(nil),
+		"sortAlpha": (func(list interface{}) []string)(nil),
+		"split":     (func(sep, orig string) map[string]string)(nil),
+		"splitList": (func(sep, orig string) []string)(nil),
+		"splitn":    (func(sep string, n int, orig string) map[string]string)(nil),
+		"toStrings": (func(v interface{}) []string)(nil),
+
+		// conversion functions
+		"atoi":      (func(a string) int)(nil),
+		"float64":   (func(v interface{}) float64)(nil),
+		"int":       (func(v interface{}) int)(nil),
+		"int64":     (func(v interface{}) int64)(nil),
+		"toDecimal": (func(v interface{}) int64)(nil),
+		"toString":  (func(v interface{}) string)(nil),
+
+		// integer math functions
+		"add":       (func(i ...interface{}) int64)(nil),
+		"add1":      (func(i interface{}) int64)(nil),
+		"biggest":   (func(a interface{}, i ...interface{}) int64)(nil),
+		"div":       (func(a, b interface{}) int64)(nil),
+		"max":       (func(a interface{}, i ...interface{}) int64)(nil),
+		"min":       (func(a interface{}, i ...interface{}) int64)(nil),
+		"mod":       (func(a, b interface{}) int64)(nil),
+		"mul":       (func(a interface{}, v ...interface{}) int64)(nil),
+		"randInt":   (func(min, max int) int)(nil),
+		"seq":       (func(params ...int) string)(nil),
+		"sub":       (func(a, b interface{}) int64)(nil),
+		"until":     (func(count int) []int)(nil),
+		"untilStep": (func(start, stop, step int) []int)(nil),
+
+		// float math functions
+		"add1f": (func(i interface{}) float64)(nil),
+		"addf":  (func(i ...interface{}) float64)(nil),
+		"ceil":  (func(a interface{}) float64)(nil),
+		"divf":  (func(a interface{}, v ...interface{}) float64)(nil),
+		"floor": (func(a interface{}) float64)(nil),
+		"maxf":  (func(a interface{}, i ...interface{}) float64)(nil),
+		"minf":  (func(a interface{}, i ...interface{}) float64)(nil),
+		"mulf":  (func(a interface{}, v ...interface{}) float64)(nil),
+		"round": (func(a interface{}, p int, rOpt ...float64) float64)(nil),
+		"subf":  (func(a interface{}, v ...interface{}) float64)(nil),
+
+		// defaults functions
+		"all":              (func(v ...interface{}) bool)(nil),
+		"any":              (func(v ...interface{}) bool)(nil),
+		"coalesce":         (func(v ...interface{}) interface{})(nil),
+		"compact":          (func(list interface{}) []interface{})(nil),
+		"deepCopy":         (func(i interface{}) interface{})(nil),
+		"default":          (func(d interface{}, given ...interface{}) interface{})(nil),
+		"empty":            (func(given interface{}) bool)(nil),
+		"fromJson":         (func(v string) interface{})(nil),
+		"mustCompact":      (func(list interface{}) ([]interface{}, error))(nil),
+		"mustDeepCopy":     (func(i interface{}) (interface{}, error))(nil),
+		"mustFromJson":     (func(v string) (interface{}, error))(nil),
+		"mustToJson":       (func(v interface{}) (string, error))(nil),
+		"mustToPrettyJson": (func(v interface{}) (string, error))(nil),
+		"mustToRawJson":    (func(v interface{}) (string, error))(nil),
+		"ternary":          (func(vt interface{}, vf interface{}, v bool) interface{})(nil),
+		"toJson":           (func(v interface{}) string)(nil),
+		"toPrettyJson":     (func(v interface{}) string)(nil),
+		"toRawJson":        (func(v interface{}) string)(nil),
+
+		// yaml functions, provided by sprout and by most tools built on sprig
+		"fromYaml": (func(str string) dict)(nil),
+		"toYaml":   (func(v interface{}) string)(nil),
+
+		// reflection functions
+		"deepEqual":  (func(x, y interface{}) bool)(nil),
+		"kindIs":     (func(target string, src interface{}) bool)(nil),
+		"kindOf":     (func(src interface{}) string)(nil),
+		"typeIs":     (func(target string, src interface{}) bool)(nil),
+		"typeIsLike": (func(target string, src interface{}) bool)(nil),
+		"typeOf":     (func(src interface{}) string)(nil),
+
+		// os and path functions
+		"base":      (func(path string) string)(nil),
+		"clean":     (func(path string) string)(nil),
+		"dir":       (func(path string) string)(nil),
+		"env":       (func(key string) string)(nil),
+		"expandenv": (func(s string) string)(nil),
+		"ext":       (func(path string) string)(nil),
+		"isAbs":     (func(path string) bool)(nil),
+		"osBase":    (func(path string) string)(nil),
+		"osClean":   (func(path string) string)(nil),
+		"osDir":     (func(path string) string)(nil),
+		"osExt":     (func(path string) string)(nil),
+		"osIsAbs":   (func(path string) bool)(nil),
+
+		// encoding and crypto functions
+		"adler32sum":     (func(input string) string)(nil),
+		"b32dec":         (func(v string) string)(nil),
+		"b32enc":         (func(v string) string)(nil),
+		"b64dec":         (func(v string) string)(nil),
+		"b64enc":         (func(v string) string)(nil),
+		"bcrypt":         (func(input string) string)(nil),
+		"decryptAES":     (func(password string, crypt64 string) (string, error))(nil),
+		"derivePassword": (func(counter uint32, passwordType, password, user, site string) string)(nil),
+		"encryptAES":     (func(password string, plaintext string) (string, error))(nil),
+		"genPrivateKey":  (func(typ string) string)(nil),
+		"htpasswd":       (func(username string, password string) string)(nil),
+		"randBytes":      (func(count int) (string, error))(nil),
+		"sha1sum":        (func(input string) string)(nil),
+		"sha256sum":      (func(input string) string)(nil),
+		"uuidv4":         (func() string)(nil),
+
+		// network and url functions
+		"getHostByName": (func(name string) string)(nil),
+		"urlJoin":       (func(d dict) string)(nil),
+		"urlParse":      (func(v string) dict)(nil),
+
+		// list functions
+		"append":      (func(list interface{}, v interface{}) []interface{})(nil),
+		"chunk":       (func(size int, list interface{}) [][]interface{})(nil),
+		"concat":      (func(lists ...interface{}) interface{})(nil),
+		"first":       (func(list interface{}) interface{})(nil),
+		"has":         (func(needle interface{}, haystack interface{}) bool)(nil),
+		"initial":     (func(list interface{}) []interface{})(nil),
+		"last":        (func(list interface{}) interface{})(nil),
+		"list":        (func(v ...interface{}) []interface{})(nil),
+		"mustAppend":  (func(list interface{}, v interface{}) ([]interface{}, error))(nil),
+		"mustChunk":   (func(size int, list interface{}) ([][]interface{}, error))(nil),
+		"mustFirst":   (func(list interface{}) (interface{}, error))(nil),
+		"mustHas":     (func(needle interface{}, haystack interface{}) (bool, error))(nil),
+		"mustInitial": (func(list interface{}) ([]interface{}, error))(nil),
+		"mustLast":    (func(list interface{}) (interface{}, error))(nil),
+		"mustPrepend": (func(list interface{}, v interface{}) ([]interface{}, error))(nil),
+		"mustPush":    (func(list interface{}, v interface{}) ([]interface{}, error))(nil),
+		"mustRest":    (func(list interface{}) ([]interface{}, error))(nil),
+		"mustReverse": (func(v interface{}) ([]interface{}, error))(nil),
+		"mustSlice":   (func(list interface{}, indices ...interface{}) (interface{}, error))(nil),
+		"mustUniq":    (func(list interface{}) ([]interface{}, error))(nil),
+		"mustWithout": (func(list interface{}, omit ...interface{}) ([]interface{}, error))(nil),
+		"prepend":     (func(list interface{}, v interface{}) []interface{})(nil),
+		"push":        (func(list interface{}, v interface{}) []interface{})(nil),
+		"rest":        (func(list interface{}) []interface{})(nil),
+		"reverse":     (func(v interface{}) []interface{})(nil),
+		"slice":       (func(list interface{}, indices ...interface{}) interface{})(nil),
+		"tuple":       (func(v ...interface{}) []interface{})(nil),
+		"uniq":        (func(list interface{}) []interface{})(nil),
+		"without":     (func(list interface{}, omit ...interface{}) []interface{})(nil),
+
+		// dict functions
+		"dict":               (func(v ...interface{}) dict)(nil),
+		"dig":                (func(ps ...interface{}) (interface{}, error))(nil),
+		"get":                (func(d dict, key string) interface{})(nil),
+		"hasKey":             (func(d dict, key string) bool)(nil),
+		"keys":               (func(dicts ...dict) []string)(nil),
+		"merge":              (func(dst dict, srcs ...dict) interface{})(nil),
+		"mergeOverwrite":     (func(dst dict, srcs ...dict) interface{})(nil),
+		"mustMerge":          (func(dst dict, srcs ...dict) (interface{}, error))(nil),
+		"mustMergeOverwrite": (func(dst dict, srcs ...dict) (interface{}, error))(nil),
+		"omit":               (func(d dict, keys ...string) dict)(nil),
+		"pick":               (func(d dict, keys ...string) dict)(nil),
+		"pluck":              (func(name string, d ...dict) []interface{})(nil),
+		"set":                (func(d dict, key string, value interface{}) dict)(nil),
+		"unset":              (func(d dict, key string) dict)(nil),
+		"values":             (func(d dict) []interface{})(nil),
+
+		// regex functions
+		"mustRegexFind":              (func(regex string, s string) (string, error))(nil),
+		"mustRegexFindAll":           (func(regex string, s string, n int) ([]string, error))(nil),
+		"mustRegexMatch":             (func(regex string, s string) (bool, error))(nil),
+		"mustRegexReplaceAll":        (func(regex string, s string, repl string) (string, error))(nil),
+		"mustRegexReplaceAllLiteral": (func(regex string, s string, repl string) (string, error))(nil),
+		"mustRegexSplit":             (func(regex string, s string, n int) ([]string, error))(nil),
+		"regexFind":                  (func(regex string, s string) string)(nil),
+		"regexFindAll":               (func(regex string, s string, n int) []string)(nil),
+		"regexMatch":                 (func(regex string, s string) bool)(nil),
+		"regexQuoteMeta":             (func(s string) string)(nil),
+		"regexReplaceAll":            (func(regex string, s string, repl string) string)(nil),
+		"regexReplaceAllLiteral":     (func(regex string, s string, repl string) string)(nil),
+		"regexSplit":                 (func(regex string, s string, n int) []string)(nil),
+
+		// semver functions, the *semver.Version result is only known at execution time
+		"semver":        (func(version string) (interface{}, error))(nil),
+		"semverCompare": (func(constraint, version string) (bool, error))(nil),
+
+		// flow control functions
+		"fail": (func(msg string) (string, error))(nil),
+	}
+}
+
+// Helm returns the signatures of the functions that helm (helm.sh/helm/v3) adds on top of sprig.
+func Helm() template.FuncMap {
+	type dict = map[string]interface{}
+
+	funcs := Sprig()
+	for name, fn := range (template.FuncMap{
+		"fromJsonArray": (func(str string) []interface{})(nil),
+		"fromToml":      (func(str string) dict)(nil),
+		"fromYamlArray": (func(str string) []interface{})(nil),
+		"include":       (func(name string, data interface{}) (string, error))(nil),
+		"lookup":        (func(apiversion, resource, namespace, name string) (dict, error))(nil),
+		"required":      (func(warn string, val interface{}) (interface{}, error))(nil),
+		"toToml":        (func(v interface{}) string)(nil),
+		"tpl":           (func(tpl string, vals interface{}) (string, error))(nil),
+	}) {
+		funcs[name] = fn
+	}
+
+	return funcs
+}
+
+// functionSetFuncs returns the functions of the function sets that can be enabled, keyed by name
+var functionSetFuncs = map[string]func() template.FuncMap{
+	"sprig": Sprig,
+	"helm":  Helm,
+}
+
+// FunctionSets contains the method tables of the function sets that can be enabled, keyed by name.
+// Named types of the standard library, e.g. time.Time, are only identical to the ones of loaded
+// packages in the method tables of a registry (see Registry.TemplateMethods).
+var FunctionSets = generateFunctionSets(nil)
+
+func generateFunctionSets(resolve astreflect.NamedTypeResolver) map[string]map[string]*TemplateMethodInfo {
+	sets := make(map[string]map[string]*TemplateMethodInfo, len(functionSetFuncs))
+	for name, funcs := range functionSetFuncs {
+		sets[name] = generateTemplateMethods(funcs(), resolve)
+	}
+	return sets
+}
+
+// FunctionSetNames returns the names of the function sets that can be enabled, in alphabetical order
+func FunctionSetNames() []string {
+	names := make([]string, 0, len(FunctionSets))
+	for name := range FunctionSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,6 +2,8 @@ package ast
 
 import (
 	"context"
+	"fmt"
+	"go/token"
 	"go/types"
 	"strings"
 
@@ -16,7 +18,34 @@ type TypeHintDefinition struct {
 	// Reflect reflect.Type
 	Fields      map[string]*FieldInfo
 	MyFieldInfo FieldInfo
-	MyType      *types.Named
+	MyType      *types.Named // the named type, nil for other types
+	// Type is the type the definition is built from, e.g. []Row for a hint of a slice of rows
+	Type types.Type
+	// Addressable is set when the value is addressable at execution time, so that the methods with a
+	// pointer receiver can be selected: when it is a pointer, or a field of an addressable struct.
+	Addressable bool
+}
+
+// TypeName returns the named type the definition refers to, looking through pointers and the elements of
+// slices, arrays and maps. It returns nil for other types, e.g. struct literals.
+func (t *TypeHintDefinition) TypeName() *types.TypeName {
+	typ := t.Type
+	for {
+		switch u := typ.(type) {
+		case *types.Named:
+			return u.Obj()
+		case *types.Pointer:
+			typ = u.Elem()
+		case *types.Slice:
+			typ = u.Elem()
+		case *types.Array:
+			typ = u.Elem()
+		case *types.Map:
+			typ = u.Elem()
+		default:
+			return nil
+		}
+	}
 }
 
 // FieldInfo represents information about a struct field
@@ -26,6 +55,9 @@ type FieldInfo struct {
 	// Reflect  reflect.Type
 	FormattedTypeString string
 	Parent              *TypeHintDefinition
+	// Owner is the named type that declares the field or method, which differs from the parent type for
+	// promoted fields. It is nil for the fields of unnamed structs and for map keys.
+	Owner *types.TypeName
 }
 
 func (f *FieldInfo) TypeName() string {
@@ -100,15 +132,17 @@ func createFieldInfo(ctx context.Context, obj FieldVarOrFunc, parent *TypeHintDe
 }
 
 // createTypeInfoFromStruct creates a TypeInfo from a types.Struct
-func createTypeInfoFromStruct(ctx context.Context, name string, obj types.Type, strict bool, parent *TypeHintDefinition) (*TypeHintDefinition, error) {
+func createTypeInfoFromStruct(ctx context.Context, name string, obj types.Type, strict bool, addressable bool, parent *TypeHintDefinition) (*TypeHintDefinition, error) {
 	zerolog.Ctx(ctx).Trace().
 		Str("name", name).
 		Str("type", obj.String()).
 		Bool("strict", strict).
+		Bool("addressable", addressable).
 		Msg("creating type info")
 
 	typeInfo := &TypeHintDefinition{
-		Fields: make(map[string]*FieldInfo),
+		Fields:      make(map[string]*FieldInfo),
+		Addressable: addressable,
 	}
 
 	// Create a FieldInfo for the type itself
@@ -118,96 +152,299 @@ func createTypeInfoFromStruct(ctx context.Context, name string, obj types.Type,
 		Parent: parent,
 	}
 
-	var namedType *types.Named
-	var structType *types.Struct
+	if named, ok := obj.(*types.Named); ok {
+		typeInfo.MyType = named
+	}
+
+	if _, ok := obj.Underlying().(*types.Struct); !ok && strict {
+		return nil, errors.Errorf("type %s is not a struct type", name)
+	}
 
-	switch t := obj.(type) {
-	case *types.Named:
-		namedType = t
-		if s, ok := t.Underlying().(*types.Struct); ok {
-			structType = s
+	// fields and methods are selected the way text/template selects them when executing: the ones
+	// promoted from embedded fields are included, and unexported fields can not be selected. The
+	// methods with a pointer receiver are only selected on addressable values.
+	for _, name := range selectorNames(obj) {
+		sel, index, _ := types.LookupFieldOrMethod(obj, addressable, nil, name)
+		var field FieldVarOrFunc
+		var owner *types.TypeName
+		switch sel := sel.(type) {
+		case *types.Var:
+			field.Var = sel
+			owner = declaringType(obj, index)
+		case *types.Func:
+			field.Func = sel
+			if recv := sel.Type().(*types.Signature).Recv(); recv != nil {
+				if named, ok := deref(recv.Type()).(*types.Named); ok {
+					owner = named.Obj()
+				}
+			}
+		default:
+			// ambiguous selectors of embedded fields at the same depth are not found at execution time either
+			continue
 		}
-	case *types.Struct:
-		structType = t
+		fieldInfo, err := createFieldInfo(ctx, field, typeInfo)
+		if err != nil {
+			return nil, errors.Errorf("failed to create field info for %s: %w", name, err)
+		}
+		fieldInfo.Owner = owner
+		typeInfo.Fields[name] = fieldInfo
 	}
 
-	if structType == nil && strict {
-		return nil, errors.Errorf("type %s is not a struct type", name)
+	typeInfo.Type = obj
+
+	return typeInfo, nil
+}
+
+// declaringType follows the embedded fields of a selection's index path to the named type that
+// declares the selected field
+func declaringType(typ types.Type, index []int) *types.TypeName {
+	for _, i := range index[:len(index)-1] {
+		st, ok := deref(typ).Underlying().(*types.Struct)
+		if !ok {
+			return nil
+		}
+		typ = st.Field(i).Type()
 	}
 
-	if structType != nil {
-		for i := 0; i < structType.NumFields(); i++ {
-			field := structType.Field(i)
-			fieldInfo, err := createFieldInfo(ctx, FieldVarOrFunc{Var: field}, typeInfo)
-			if err != nil {
-				return nil, errors.Errorf("failed to create field info for %s: %w", field.Name(), err)
+	if named, ok := deref(typ).(*types.Named); ok {
+		return named.Obj()
+	}
+	return nil
+}
+
+func deref(typ types.Type) types.Type {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return typ
+}
+
+// selectorNames returns the exported names of the fields and methods of a type, including the ones of
+// its embedded fields
+func selectorNames(typ types.Type) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	add := func(name string) {
+		if token.IsExported(name) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	visited := map[types.Type]bool{}
+	var walk func(typ types.Type)
+	walk = func(typ types.Type) {
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		if visited[typ] {
+			return
+		}
+		visited[typ] = true
+
+		if named, ok := typ.(*types.Named); ok {
+			for i := 0; i < named.NumMethods(); i++ {
+				add(named.Method(i).Name())
+			}
+		}
+
+		switch t := typ.Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				field := t.Field(i)
+				add(field.Name())
+				if field.Embedded() {
+					walk(field.Type())
+				}
 			}
-			if _, ok := typeInfo.Fields[field.Name()]; ok {
-				return nil, errors.Errorf("name conflict: %s already exists in type %s", field.Name(), name)
+		case *types.Interface:
+			// includes the methods of embedded interfaces
+			for i := 0; i < t.NumMethods(); i++ {
+				add(t.Method(i).Name())
 			}
-			typeInfo.Fields[field.Name()] = fieldInfo
 		}
 	}
+	walk(typ)
 
-	if namedType != nil {
-		// Add methods
-		for i := 0; i < namedType.NumMethods(); i++ {
-			method := namedType.Method(i)
-			methodInfo, err := createFieldInfo(ctx, FieldVarOrFunc{Func: method}, typeInfo)
-			if err != nil {
-				return nil, errors.Errorf("failed to create method info for %s: %w", method.Name(), err)
-			}
-			if _, ok := typeInfo.Fields[method.Name()]; ok {
-				return nil, errors.Errorf("name conflict: %s already exists in type %s", method.Name(), name)
+	return names
+}
+
+// hasUnexportedField reports whether a struct type, or one of its embedded fields, has an unexported field of a name
+func hasUnexportedField(typ types.Type, name string) bool {
+	if token.IsExported(name) {
+		return false
+	}
+
+	visited := map[types.Type]bool{}
+	var walk func(typ types.Type) bool
+	walk = func(typ types.Type) bool {
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		if visited[typ] {
+			return false
+		}
+		visited[typ] = true
+
+		st, ok := typ.Underlying().(*types.Struct)
+		if !ok {
+			return false
+		}
+		for i := 0; i < st.NumFields(); i++ {
+			field := st.Field(i)
+			if field.Name() == name || (field.Embedded() && walk(field.Type())) {
+				return true
 			}
-			typeInfo.Fields[method.Name()] = methodInfo
 		}
+		return false
 	}
 
-	return typeInfo, nil
+	return walk(typ)
+}
+
+// dynamicField returns the field that a name selects on a value whose fields are only known at
+// execution time: the value of a key of a map with string keys, or a field of the dynamic value of
+// an empty interface.
+func (t *TypeHintDefinition) dynamicField(name string) *FieldInfo {
+	if t.Type == nil {
+		return nil
+	}
+
+	typ := t.Type
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	var elem types.Type
+	switch u := typ.Underlying().(type) {
+	case *types.Map:
+		if types.AssignableTo(types.Typ[types.String], u.Key()) {
+			elem = u.Elem()
+		}
+	case *types.Interface:
+		if u.NumMethods() == 0 {
+			elem = typ
+		}
+	}
+	if elem == nil {
+		return nil
+	}
+
+	return &FieldInfo{
+		Name:   name,
+		Type:   FieldVarOrFunc{Var: types.NewField(token.NoPos, nil, name, elem, false)},
+		Parent: t,
+	}
+}
+
+// FieldNotFoundError is returned when a part of a field path does not exist on its type
+type FieldNotFoundError struct {
+	Field string
+	// Offset is the offset of the field in the text of the field path
+	Offset int
+	// Type is the type the field was looked up in
+	Type *TypeHintDefinition
+	// Unexported is set when the field exists but is unexported, so it can not be used by templates
+	Unexported bool
 }
 
-// ValidateField validates a field access on a type
+func (e *FieldNotFoundError) Error() string {
+	if e.Unexported {
+		return fmt.Sprintf("%s is an unexported field of struct type %s", e.Field, e.Type.MyFieldInfo.Name)
+	}
+	return fmt.Sprintf("field not found [ %s ] in type [ %s ]", e.Field, e.Type.MyFieldInfo.Name)
+}
+
+// GenerateFieldInfoFromPosition returns the field or method that a field path like ".Address.City"
+// selects on a type, see GenerateFieldInfosFromPosition
 func GenerateFieldInfoFromPosition(ctx context.Context, typeInfo *TypeHintDefinition, pos position.RawPosition) (*FieldInfo, error) {
+	fields, err := GenerateFieldInfosFromPosition(ctx, typeInfo, pos)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return fields[len(fields)-1], nil
+}
+
+// GenerateFieldInfosFromPosition returns the field or method that each part of a field path like
+// ".Address.City" selects, in order. Methods in the middle of the path are called and their first
+// result is selected from. If a part can not be selected, the fields before it are returned with the error.
+func GenerateFieldInfosFromPosition(ctx context.Context, typeInfo *TypeHintDefinition, pos position.RawPosition) ([]*FieldInfo, error) {
 	parts := strings.Split(pos.Text, ".")
 	currentType := typeInfo
-	var currentField *FieldInfo
+	fields := []*FieldInfo{}
 
-	for _, part := range parts {
+	offset := 0
+	for i, part := range parts {
+		start := offset
+		offset += len(part) + len(".")
 		if part == "" {
 			continue
 		}
 		zerolog.Ctx(ctx).Trace().Str("part", part).Msgf("generating field '%s' in type '%s' using position '%s'", part, currentType.MyFieldInfo.Name, pos.ID())
 		field, ok := currentType.Fields[part]
 		if !ok {
-			// "field not found" is relied on downstream in hover.go
-			return nil, errors.Errorf("field not found [ %s ] in type [ %s ]", part, currentType.MyFieldInfo.Name)
+			field = currentType.dynamicField(part)
+		}
+		if field == nil {
+			notFound := &FieldNotFoundError{Field: part, Offset: start, Type: currentType}
+			if currentType.Type != nil {
+				notFound.Unexported = hasUnexportedField(currentType.Type, part)
+			}
+			return fields, errors.WithStack(notFound)
 		}
 
-		currentField = field
+		fields = append(fields, field)
 
-		if part != parts[len(parts)-1] {
-			var err error
-			// Get the underlying type if it's a named type
+		if i < len(parts)-1 {
+			// methods are called, and the fields of their first result are selected
 			fieldType := field.Type.Type()
-			if named, ok := fieldType.(*types.Named); ok {
-				fieldType = named.Underlying()
-			}
-
-			// Check if it's a struct type
-			structType, ok := fieldType.(*types.Struct)
-			if !ok {
-				return nil, errors.Errorf("field %s is not a struct type", part)
+			if sig, ok := fieldType.(*types.Signature); ok {
+				if sig.Results().Len() == 0 {
+					return fields, errors.Errorf("method %s has no results", part)
+				}
+				fieldType = sig.Results().At(0).Type()
 			}
 
-			currentType, err = createTypeInfoFromStruct(ctx, part, structType, false, currentType)
+			var err error
+			currentType, err = newTypeHintDefinition(ctx, part, fieldType, currentType, field.addressable())
 			if err != nil {
-				return nil, errors.Errorf("failed to create type info for %s: %w", part, err)
+				return fields, errors.Errorf("failed to create type info for %s: %w", part, err)
 			}
 		}
 	}
 
-	return currentField, nil
+	return fields, nil
+}
+
+// GenerateTypeHintDefinitionFromFieldInfo builds the type definition of the value a field
+// resolves to, so that its own fields and methods can be listed (e.g. for completion).
+// Methods resolve to their first result and pointers are dereferenced.
+func GenerateTypeHintDefinitionFromFieldInfo(ctx context.Context, field *FieldInfo) (*TypeHintDefinition, error) {
+	if field == nil {
+		return nil, errors.New("field cannot be nil")
+	}
+
+	fieldType := field.Type.Type()
+	if sig, ok := fieldType.(*types.Signature); ok {
+		if sig.Results().Len() == 0 {
+			return nil, errors.Errorf("method %s has no results", field.Type.Obj().Name())
+		}
+		fieldType = sig.Results().At(0).Type()
+	}
+
+	return newTypeHintDefinition(ctx, field.Type.Obj().Name(), fieldType, field.Parent, field.addressable())
+}
+
+// addressable reports whether the value of a field is addressable: struct fields of addressable values
+// are, while the results of methods and the values of map keys are not
+func (f *FieldInfo) addressable() bool {
+	if f.Type.Var == nil || f.Parent == nil || !f.Parent.Addressable {
+		return false
+	}
+	return f.Parent.Fields[f.Type.Obj().Name()] == f
 }
 
 type FunctionCallInfo struct {
@@ -232,12 +469,19 @@ func GenerateFunctionCallInfoFromSignature(ctx context.Context, signature *types
 		Name:       signature.String(),
 		Parameters: input,
 		Results:    output,
+		Variadic:   signature.Variadic(),
 	}, nil
 }
 
 func GenerateFunctionCallInfoFromPosition(ctx context.Context, pos position.RawPosition) (*TemplateMethodInfo, error) {
+	return GenerateFunctionCallInfoFromMethods(ctx, BuiltinTemplateMethods, pos)
+}
+
+// GenerateFunctionCallInfoFromMethods looks up the function at the position in a method table,
+// such as the one returned by Registry.TemplateMethods.
+func GenerateFunctionCallInfoFromMethods(ctx context.Context, methods map[string]*TemplateMethodInfo, pos position.RawPosition) (*TemplateMethodInfo, error) {
 
-	method := BuiltinTemplateMethods[pos.Text]
+	method := methods[pos.Text]
 	if method == nil {
 		return nil, errors.Errorf("method %s not found", pos.Text)
 	}
@@ -271,28 +515,192 @@ func GenerateFunctionCallInfoFromPosition(ctx context.Context, pos position.RawP
 
 }
 
+// BuildTypeHintDefinitionFromRegistry builds the type definition of a type hint, see Registry.ResolveTypeHint.
+// The data passed to a template is only addressable if it is a pointer.
 func BuildTypeHintDefinitionFromRegistry(ctx context.Context, typePath string, r *Registry) (*TypeHintDefinition, error) {
-	lastDot := strings.LastIndex(typePath, ".")
-	if lastDot == -1 {
-		return nil, errors.Errorf("invalid type path: %s", typePath)
+	typ, err := r.ResolveTypeHint(ctx, typePath)
+	if err != nil {
+		return nil, err
 	}
 
-	pkgName, typeName := typePath[:lastDot], typePath[lastDot+1:]
-
-	pkg, err := r.GetPackage(ctx, pkgName)
+	typeInfo, err := newTypeHintDefinition(ctx, TypeDisplayName(deref(typ)), typ, nil, false)
 	if err != nil {
-		return nil, errors.Errorf("package not found in registry: %w", err)
+		return nil, errors.Errorf("failed to create type info: %w", err)
+	}
+
+	return typeInfo, nil
+}
+
+// GenerateTypeHintDefinitionFromType builds the type definition of an arbitrary go type, e.g. the
+// element type that `.` is bound to inside of a range. Pointers are dereferenced. Whether the value is
+// addressable depends on where it comes from, see RangeElementAddressable and FieldPathAddressable.
+func GenerateTypeHintDefinitionFromType(ctx context.Context, typ types.Type, addressable bool) (*TypeHintDefinition, error) {
+	if typ == nil {
+		return nil, errors.New("type cannot be nil")
+	}
+
+	elem := typ
+	if ptr, ok := typ.(*types.Pointer); ok {
+		elem = ptr.Elem()
 	}
 
-	obj := pkg.Scope().Lookup(typeName)
-	if obj == nil {
-		return nil, errors.Errorf("type %s not found in package %s", typeName, pkgName)
+	return newTypeHintDefinition(ctx, TypeDisplayName(elem), typ, nil, addressable)
+}
+
+// newTypeHintDefinition builds the type definition of a value, which is addressable if it is a pointer
+func newTypeHintDefinition(ctx context.Context, name string, typ types.Type, parent *TypeHintDefinition, addressable bool) (*TypeHintDefinition, error) {
+	elem := typ
+	if ptr, ok := typ.(*types.Pointer); ok {
+		elem = ptr.Elem()
+		addressable = true
 	}
 
-	typeInfo, err := createTypeInfoFromStruct(ctx, typeName, obj.Type(), true, nil)
+	typeInfo, err := createTypeInfoFromStruct(ctx, name, elem, false, addressable, parent)
 	if err != nil {
-		return nil, errors.Errorf("failed to create type info: %w", err)
+		return nil, err
 	}
+	typeInfo.Type = typ
 
 	return typeInfo, nil
 }
+
+// TypeDisplayName returns the short name of a type as it is shown in diagnostics,
+// e.g. "Person" for a named type or "[]string" for a slice.
+func TypeDisplayName(typ types.Type) string {
+	if named, ok := typ.(*types.Named); ok {
+		return named.Obj().Name()
+	}
+	return types.TypeString(typ, func(*types.Package) string { return "" })
+}
+
+// FieldPathType returns the type of the value that a field path like ".Address.City" resolves to,
+// starting from typ. Methods resolve to their first result. An empty path or "." resolves to typ itself.
+//
+// The methods with a pointer receiver are selected as if the value was addressable, since only its
+// type is resolved. Field paths are checked with GenerateFieldInfosFromPosition.
+func FieldPathType(ctx context.Context, typ types.Type, path string) (types.Type, error) {
+	if path == "" || path == "." {
+		return typ, nil
+	}
+
+	thd, err := GenerateTypeHintDefinitionFromType(ctx, typ, true)
+	if err != nil {
+		return nil, errors.Errorf("generating type definition: %w", err)
+	}
+
+	field, err := GenerateFieldInfoFromPosition(ctx, thd, position.NewBasicPosition(path, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	if field == nil {
+		return typ, nil
+	}
+
+	result := field.Type.Type()
+	if sig, ok := result.(*types.Signature); ok {
+		if sig.Results().Len() == 0 {
+			return nil, errors.Errorf("method %s has no results", field.Type.Obj().Name())
+		}
+		result = sig.Results().At(0).Type()
+	}
+
+	return result, nil
+}
+
+// FieldPathAddressable reports whether the value that a field path like ".Address.City" resolves to is
+// addressable, starting from a value of type typ. An empty path or "." resolves to the value itself.
+func FieldPathAddressable(ctx context.Context, typ types.Type, addressable bool, path string) bool {
+	thd, err := GenerateTypeHintDefinitionFromType(ctx, typ, addressable)
+	if err != nil {
+		return false
+	}
+
+	if path == "" || path == "." {
+		return thd.Addressable
+	}
+
+	fields, err := GenerateFieldInfosFromPosition(ctx, thd, position.NewBasicPosition(path, 0))
+	if err != nil || len(fields) == 0 {
+		return false
+	}
+
+	return fields[len(fields)-1].addressable()
+}
+
+// RangeElementType returns the type that `.` is bound to inside of {{ range }} over a value of type typ.
+//
+// Slices, arrays and channels yield their element, maps yield their value, integers yield
+// themselves and range-over-func iterators yield their last value (iter.Seq and iter.Seq2).
+func RangeElementType(typ types.Type) (types.Type, error) {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	switch t := typ.Underlying().(type) {
+	case *types.Slice:
+		return t.Elem(), nil
+	case *types.Array:
+		return t.Elem(), nil
+	case *types.Map:
+		return t.Elem(), nil
+	case *types.Chan:
+		return t.Elem(), nil
+	case *types.Basic:
+		if t.Info()&types.IsInteger != 0 {
+			return typ, nil
+		}
+	case *types.Signature:
+		if t.Params().Len() == 1 && t.Results().Len() == 0 {
+			if yield, ok := t.Params().At(0).Type().Underlying().(*types.Signature); ok && yield.Params().Len() > 0 {
+				return yield.Params().At(yield.Params().Len() - 1).Type(), nil
+			}
+		}
+	}
+
+	return nil, errors.Errorf("range can't iterate over %s", TypeDisplayName(typ))
+}
+
+// RangeElementAddressable reports whether the values that `.` is bound to inside of {{ range }} over a
+// value of type typ are addressable: the elements of slices are, and the elements of arrays if the array
+// is. The values of maps, channels and iterators are not.
+func RangeElementAddressable(typ types.Type, addressable bool) bool {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+		addressable = true
+	}
+
+	switch typ.Underlying().(type) {
+	case *types.Slice:
+		return true
+	case *types.Array:
+		return addressable
+	}
+
+	return false
+}
+
+// RangeKeyType returns the type of the first variable in {{ range $k, $v := ... }} over a value of type typ.
+//
+// Slices and arrays yield an int index, maps yield their key and range-over-func iterators
+// yield their first value (iter.Seq2).
+func RangeKeyType(typ types.Type) (types.Type, error) {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		typ = ptr.Elem()
+	}
+
+	switch t := typ.Underlying().(type) {
+	case *types.Slice, *types.Array:
+		return types.Typ[types.Int], nil
+	case *types.Map:
+		return t.Key(), nil
+	case *types.Signature:
+		if t.Params().Len() == 1 && t.Results().Len() == 0 {
+			if yield, ok := t.Params().At(0).Type().Underlying().(*types.Signature); ok && yield.Params().Len() == 2 {
+				return yield.Params().At(0).Type(), nil
+			}
+		}
+	}
+
+	return nil, errors.Errorf("range over %s permits only one iteration variable", TypeDisplayName(typ))
+}
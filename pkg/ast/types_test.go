@@ -2,6 +2,9 @@ package ast_test
 
 import (
 	"context"
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
 	"go/types"
 	"testing"
 
@@ -187,3 +190,174 @@ func TestGenerateTypeInfoFromRegistry(t *testing.T) {
 		})
 	}
 }
+
+func TestFieldPathType(t *testing.T) {
+	ctx := createTestContext(t)
+
+	src := `
+package test
+
+type Base struct {
+	ID   int
+	note string
+}
+
+func (b *Base) Label() string { return "" }
+
+type Audit struct{ By string }
+
+type Namer interface{ Name() string }
+
+type Page struct {
+	Base
+	*Audit
+	Author  *Person
+	Labels  map[string]string
+	Extra   map[string]any
+	Counts  map[int]int
+	Owner   Namer
+	private string
+}
+
+type Person struct{ Name string }
+
+func (p Page) Next() *Page { return nil }
+`
+	fset := token.NewFileSet()
+	file, err := goparser.ParseFile(fset, "test.go", src, 0)
+	require.NoError(t, err)
+	pkg, err := (&types.Config{}).Check("example.com/test", fset, []*goast.File{file}, nil)
+	require.NoError(t, err)
+	page := types.NewPointer(pkg.Scope().Lookup("Page").Type())
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: ".ID", want: "int"},
+		{path: ".Label", want: "string"},
+		{path: ".Base.ID", want: "int"},
+		{path: ".By", want: "string"},
+		{path: ".Author.Name", want: "string"},
+		{path: ".Next.Next.Author", want: "*example.com/test.Person"},
+		{path: ".Labels.anything", want: "string"},
+		{path: ".Extra.a.b", want: "any"},
+		{path: ".Owner.Name", want: "string"},
+		{path: ".Counts.x", wantErr: "field not found [ x ] in type [ Counts ]"},
+		{path: ".Owner.Email", wantErr: "field not found [ Email ] in type [ Owner ]"},
+		{path: ".private", wantErr: "private is an unexported field of struct type Page"},
+		{path: ".note", wantErr: "note is an unexported field of struct type Page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ast.FieldPathType(ctx, page, tt.path)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.String())
+		})
+	}
+}
+
+func TestRangeElementType(t *testing.T) {
+	pkg := types.NewPackage("test", "test")
+	item := types.NewNamed(types.NewTypeName(0, pkg, "Item", nil), types.NewStruct(nil, nil), nil)
+
+	yield := func(params ...types.Type) types.Type {
+		vars := make([]*types.Var, len(params))
+		for i, p := range params {
+			vars[i] = types.NewParam(0, pkg, "", p)
+		}
+		yieldSig := types.NewSignatureType(nil, nil, nil, types.NewTuple(vars...), types.NewTuple(types.NewParam(0, pkg, "", types.Typ[types.Bool])), false)
+		return types.NewSignatureType(nil, nil, nil, types.NewTuple(types.NewParam(0, pkg, "yield", yieldSig)), nil, false)
+	}
+
+	tests := []struct {
+		name    string
+		typ     types.Type
+		want    types.Type
+		wantErr string
+	}{
+		{name: "slice", typ: types.NewSlice(item), want: item},
+		{name: "pointer to slice", typ: types.NewPointer(types.NewSlice(item)), want: item},
+		{name: "array", typ: types.NewArray(item, 3), want: item},
+		{name: "map yields values", typ: types.NewMap(types.Typ[types.String], item), want: item},
+		{name: "channel", typ: types.NewChan(types.RecvOnly, item), want: item},
+		{name: "int", typ: types.Typ[types.Int], want: types.Typ[types.Int]},
+		{name: "iter.Seq", typ: yield(item), want: item},
+		{name: "iter.Seq2 yields values", typ: yield(types.Typ[types.Int], item), want: item},
+		{name: "string", typ: types.Typ[types.String], wantErr: "range can't iterate over string"},
+		{name: "struct", typ: item, wantErr: "range can't iterate over Item"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ast.RangeElementType(tt.typ)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPointerMethodsOfAddressableValues(t *testing.T) {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+	pkg := pkgd.Package.Types
+
+	counter := pkgd.AddStruct("Counter", map[string]types.Type{
+		"Count": types.Typ[types.Int],
+	})
+	inc := types.NewSignature(types.NewVar(0, pkg, "c", types.NewPointer(counter)), types.NewTuple(), types.NewTuple(types.NewVar(0, pkg, "", types.Typ[types.Int])), false)
+	counter.AddMethod(types.NewFunc(0, pkg, "Inc", inc))
+
+	report := pkgd.AddStruct("Report", map[string]types.Type{
+		"Counter":  counter,
+		"Counters": types.NewMap(types.Typ[types.String], counter),
+		"Pointer":  types.NewPointer(counter),
+	})
+	current := types.NewSignature(types.NewVar(0, pkg, "r", report), types.NewTuple(), types.NewTuple(types.NewVar(0, pkg, "", counter)), false)
+	report.AddMethod(types.NewFunc(0, pkg, "Current", current))
+
+	tests := []struct {
+		typePath string
+		path     string
+		wantErr  bool
+	}{
+		{typePath: "github.com/example/types.Counter", path: ".Inc", wantErr: true},
+		{typePath: "*github.com/example/types.Counter", path: ".Inc"},
+		{typePath: "github.com/example/types.Report", path: ".Counter.Inc", wantErr: true},
+		{typePath: "*github.com/example/types.Report", path: ".Counter.Inc"},
+		{typePath: "github.com/example/types.Report", path: ".Pointer.Inc"},
+		{typePath: "*github.com/example/types.Report", path: ".Counters.a.Inc", wantErr: true},
+		{typePath: "*github.com/example/types.Report", path: ".Current.Inc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.typePath+tt.path, func(t *testing.T) {
+			thd, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, tt.typePath, registry)
+			require.NoError(t, err)
+
+			field, err := ast.GenerateFieldInfoFromPosition(ctx, thd, position.NewBasicPosition(tt.path, 0))
+			if tt.wantErr {
+				var notFound *ast.FieldNotFoundError
+				require.ErrorAs(t, err, &notFound)
+				assert.Equal(t, "Inc", notFound.Field)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "Inc", field.Type.Obj().Name())
+		})
+	}
+}
@@ -6,11 +6,37 @@ import (
 	"reflect"
 )
 
+// NamedTypeResolver returns the type of a named type from the loaded packages, e.g. time.Time, or nil
+// if it is not loaded
+type NamedTypeResolver func(pkgPath string, name string) types.Type
+
 func Reflect2AST(t reflect.Type) types.Type {
+	return Reflect2ASTWithResolver(t, nil)
+}
+
+// Reflect2ASTWithResolver is like Reflect2AST, but named types are looked up with resolve first, so
+// that they are identical to the types of the loaded packages. Named types that resolve does not know
+// are converted from their underlying type.
+func Reflect2ASTWithResolver(t reflect.Type, resolve NamedTypeResolver) types.Type {
 	if t == nil {
 		return types.NewInterfaceType(nil, nil)
 	}
 
+	// builtins like index and slice use reflect.Value to accept and return values of any type
+	if t == reflect.TypeOf(reflect.Value{}) {
+		return types.NewInterfaceType(nil, nil)
+	}
+
+	if t == reflect.TypeOf((*error)(nil)).Elem() {
+		return types.Universe.Lookup("error").Type()
+	}
+
+	if resolve != nil && t.Name() != "" && t.PkgPath() != "" {
+		if typ := resolve(t.PkgPath(), t.Name()); typ != nil {
+			return typ
+		}
+	}
+
 	switch t.Kind() {
 	case reflect.Bool:
 		return types.Typ[types.Bool]
@@ -45,19 +71,19 @@ func Reflect2AST(t reflect.Type) types.Type {
 	case reflect.String:
 		return types.Typ[types.String]
 	case reflect.Array:
-		return types.NewArray(Reflect2AST(t.Elem()), int64(t.Len()))
+		return types.NewArray(Reflect2ASTWithResolver(t.Elem(), resolve), int64(t.Len()))
 	case reflect.Slice:
-		return types.NewSlice(Reflect2AST(t.Elem()))
+		return types.NewSlice(Reflect2ASTWithResolver(t.Elem(), resolve))
 	case reflect.Map:
-		return types.NewMap(Reflect2AST(t.Key()), Reflect2AST(t.Elem()))
+		return types.NewMap(Reflect2ASTWithResolver(t.Key(), resolve), Reflect2ASTWithResolver(t.Elem(), resolve))
 	case reflect.Ptr:
-		return types.NewPointer(Reflect2AST(t.Elem()))
+		return types.NewPointer(Reflect2ASTWithResolver(t.Elem(), resolve))
 	case reflect.Struct:
 		var fields []*types.Var
 		var tags []string
 		for i := 0; i < t.NumField(); i++ {
 			field := t.Field(i)
-			fields = append(fields, types.NewVar(0, nil, field.Name, Reflect2AST(field.Type)))
+			fields = append(fields, types.NewVar(0, nil, field.Name, Reflect2ASTWithResolver(field.Type, resolve)))
 			if tag := field.Tag; tag != "" {
 				tags = append(tags, fmt.Sprintf("`%s`", tag))
 			} else {
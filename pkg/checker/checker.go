@@ -0,0 +1,263 @@
+// Package checker type checks the templates of a module outside of an editor, e.g. in CI.
+package checker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"github.com/walteh/gotmpls/pkg/finder"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Problem is an error or warning found in a template, with 1-based lines and columns
+type Problem struct {
+	File      string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Message   string
+	Severity  int
+	Rule      string
+}
+
+// Rules of the problems that are not reported as diagnostics
+const (
+	RuleSyntax   = "syntax"   // the template can not be parsed
+	RuleAnalysis = "analysis" // the template can not be analyzed, e.g. because its type hint can not be loaded
+)
+
+// String formats the problem like the go toolchain does, as file:line:col: message
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+}
+
+// Result is the outcome of checking the templates matched by a set of patterns
+type Result struct {
+	// Files are all of the templates that were checked
+	Files []string
+	// Problems are sorted by file and position
+	Problems []Problem
+}
+
+// Errors returns the number of problems with error severity
+func (r *Result) Errors() int {
+	count := 0
+	for _, problem := range r.Problems {
+		if problem.Severity == diagnostic.SeverityError {
+			count++
+		}
+	}
+	return count
+}
+
+// Options configure a check
+type Options struct {
+	// FunctionSets are the bundled function sets (e.g. "sprig") that can be called from every template
+	FunctionSets []string
+}
+
+// Check type checks the templates matched by the patterns, which work like the patterns of the go
+// command: "./..." matches the templates of a directory and its subdirectories (skipping testdata,
+// vendor and hidden directories), a directory matches the templates directly in it, and a file
+// matches itself.
+//
+// Templates are the files embedded by the loaded packages and the .tmpl and .gotmpl files found on disk.
+// The paths of the problems are relative to the working directory when possible.
+func Check(ctx context.Context, patterns []string, opts Options) (*Result, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	result := &Result{}
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		files, registry, err := loadPattern(ctx, pattern)
+		if err != nil {
+			return nil, errors.Errorf("loading %s: %w", pattern, err)
+		}
+		registry.FunctionSets = opts.FunctionSets
+
+		for _, file := range sortedKeys(files) {
+			if seen[file] {
+				continue
+			}
+			seen[file] = true
+
+			result.Files = append(result.Files, displayPath(file))
+			result.Problems = append(result.Problems, checkFile(ctx, file, files[file], registry)...)
+		}
+	}
+
+	sort.SliceStable(result.Problems, func(i, j int) bool {
+		a, b := result.Problems[i], result.Problems[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return result, nil
+}
+
+// loadPattern loads the packages of a pattern and returns the content of the templates it matches, keyed by absolute path
+func loadPattern(ctx context.Context, pattern string) (map[string]string, *ast.Registry, error) {
+	root, recursive := strings.CutSuffix(filepath.ToSlash(pattern), "/...")
+	if root == "..." {
+		root, recursive = ".", true
+	}
+
+	root, err := filepath.Abs(filepath.FromSlash(root))
+	if err != nil {
+		return nil, nil, errors.Errorf("resolving path: %w", err)
+	}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, errors.Errorf("reading path: %w", err)
+	}
+
+	dir := root
+	if !info.IsDir() {
+		dir = filepath.Dir(root)
+	}
+
+	pkgs, err := ast.LoadPackageTypesFromFs(ctx, dir, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	registry := ast.NewRegistry(pkgs)
+
+	matches := func(file string) bool {
+		switch {
+		case !info.IsDir():
+			return file == root
+		case !recursive:
+			return filepath.Dir(file) == root
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return false
+		}
+		for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+			if part == "testdata" || part == "vendor" || (part != "." && (strings.HasPrefix(part, ".") || strings.HasPrefix(part, "_"))) {
+				return false
+			}
+		}
+		return true
+	}
+
+	files := map[string]string{}
+
+	for _, pkg := range registry.Packages {
+		for file, content := range pkg.TemplateFiles {
+			if matches(file) {
+				files[file] = content
+			}
+		}
+	}
+
+	found, err := finder.NewDefaultFinder().FindTemplates(ctx, dir, nil)
+	if err != nil {
+		return nil, nil, errors.Errorf("finding templates: %w", err)
+	}
+	for _, file := range found {
+		path, err := filepath.Abs(file.Path)
+		if err != nil {
+			continue
+		}
+		if _, ok := files[path]; !ok && matches(path) {
+			files[path] = string(file.Content)
+		}
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("pattern", pattern).Int("packages", len(registry.Packages)).Int("templates", len(files)).Msg("loaded pattern")
+
+	return files, registry, nil
+}
+
+// checkFile returns the errors and warnings of a template
+func checkFile(ctx context.Context, file string, content string, registry *ast.Registry) []Problem {
+	display := displayPath(file)
+
+	nodes, err := parser.ParseWithRegistry(ctx, file, []byte(content), registry)
+	if err != nil {
+		return []Problem{parseErrorProblem(display, content, err)}
+	}
+
+	diagnostics, err := diagnostic.GetDiagnosticsFromParsed(ctx, nodes, registry)
+	if err != nil {
+		return []Problem{{File: display, Line: 1, Column: 1, EndLine: 1, EndColumn: 1, Message: err.Error(), Severity: diagnostic.SeverityError, Rule: RuleAnalysis}}
+	}
+
+	problems := []Problem{}
+	for _, diag := range diagnostics {
+		if diag.Severity != diagnostic.SeverityError && diag.Severity != diagnostic.SeverityWarning {
+			continue
+		}
+		rng := diag.Location.ToRange(content)
+		problems = append(problems, Problem{
+			File:      display,
+			Line:      rng.Start.Line + 1,
+			Column:    rng.Start.Character + 1,
+			EndLine:   rng.End.Line + 1,
+			EndColumn: rng.End.Character + 1,
+			Message:   diag.Message,
+			Severity:  diag.Severity,
+			Rule:      diag.Rule,
+		})
+	}
+
+	return problems
+}
+
+// parseErrorProblem reports a template that can not be parsed at the token the parser stopped at
+func parseErrorProblem(file string, content string, err error) Problem {
+	problem := Problem{File: file, Line: 1, Column: 1, EndLine: 1, EndColumn: 1, Message: err.Error(), Severity: diagnostic.SeverityError, Rule: RuleSyntax}
+
+	var parseErr *parse.Error
+	if errors.As(err, &parseErr) {
+		place := position.OffsetToPlace(content, int(parseErr.Pos))
+		problem.Line, problem.EndLine = place.Line+1, place.Line+1
+		problem.Column, problem.EndColumn = place.Character+1, place.Character+1
+		problem.Message = parseErr.Message
+	}
+
+	return problem
+}
+
+// displayPath returns the path relative to the working directory, if it is inside of it
+func displayPath(file string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return file
+	}
+	rel, err := filepath.Rel(wd, file)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file
+	}
+	return rel
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,99 @@
+package checker_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/checker"
+)
+
+func TestCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	files := map[string]string{
+		"go.mod": "module example.com/test\n\ngo 1.21\n",
+		"embed.go": `package test
+
+import _ "embed"
+
+//go:embed page.tmpl
+var Page string
+
+type Person struct {
+	Name string
+	Age  int
+}
+`,
+		"page.tmpl":              "{{- /*gotype: example.com/test.Person*/ -}}\n{{ .Name }}\n{{ .Missing }}",
+		"loose/other.gotmpl":     "{{- /*gotype: example.com/test.Person*/ -}}\n{{ .Age | upper }}\n{{ .Name | b64enc }}",
+		"loose/valid.tmpl":       "{{- /*gotype: example.com/test.Person*/ -}}\n{{ .Name }}",
+		"testdata/ignored.tmpl":  "{{- /*gotype: example.com/test.Person*/ -}}\n{{ .Ignored }}",
+		".hidden/ignored.tmpl":   "{{- /*gotype: example.com/test.Person*/ -}}\n{{ .Ignored }}",
+		"loose/broken/bad.tmpl":  "\n{{ .Name }} {{ if }}",
+		"loose/broken/README.md": "not a template",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644))
+	}
+
+	t.Chdir(tmpDir)
+
+	tests := []struct {
+		name     string
+		patterns []string
+		opts     checker.Options
+		files    []string
+		want     []string
+	}{
+		{
+			name:     "recursive",
+			patterns: []string{"./..."},
+			files:    []string{"loose/broken/bad.tmpl", "loose/other.gotmpl", "loose/valid.tmpl", "page.tmpl"},
+			want: []string{
+				"loose/broken/bad.tmpl:2:19: missing value for if",
+				"loose/other.gotmpl:2:4: cannot use int as string argument to upper",
+				"loose/other.gotmpl:3:12: method b64enc not found",
+				"page.tmpl:3:4: field not found [ Missing ] in type [ Person ]",
+			},
+		},
+		{
+			name:     "directory",
+			patterns: []string{"./loose"},
+			files:    []string{"loose/other.gotmpl", "loose/valid.tmpl"},
+			want: []string{
+				"loose/other.gotmpl:2:4: cannot use int as string argument to upper",
+				"loose/other.gotmpl:3:12: method b64enc not found",
+			},
+		},
+		{
+			name:     "file with function sets",
+			patterns: []string{"loose/other.gotmpl"},
+			opts:     checker.Options{FunctionSets: []string{"sprig"}},
+			files:    []string{"loose/other.gotmpl"},
+			want: []string{
+				"loose/other.gotmpl:2:4: cannot use int as string argument to upper",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := checker.Check(context.Background(), tt.patterns, tt.opts)
+			require.NoError(t, err)
+
+			got := []string{}
+			for _, problem := range result.Problems {
+				got = append(got, problem.String())
+			}
+
+			assert.Equal(t, tt.files, result.Files)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, len(tt.want), result.Errors())
+		})
+	}
+}
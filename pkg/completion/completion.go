@@ -1,51 +1,329 @@
+// Package completion provides type-aware completion suggestions for go templates.
 package completion
 
-// // CompletionItem represents a single completion suggestion
-// type CompletionItem struct {
-// 	Label         string `json:"label"`
-// 	Kind          string `json:"kind"`
-// 	Detail        string `json:"detail,omitempty"`
-// 	Documentation string `json:"documentation,omitempty"`
-// }
-
-// // GetCompletions returns completion items for the given position
-// func GetCompletions(ctx context.Context, pos position.RawPosition, typeInfo *bridge.TypeInfo) []CompletionItem {
-// 	var items []CompletionItem
-
-// 	if position.IsDotCompletion(pos) {
-// 		// Get the expression before the dot to determine the type
-// 		expr := position.GetExpressionBeforeDot(pos)
-// 		if expr == "" {
-// 			// If no expression before dot, we're at the root
-// 			// Add all fields from the root type
-// 			for name, field := range typeInfo.Fields {
-// 				items = append(items, CompletionItem{
-// 					Label:         name,
-// 					Kind:          "field",
-// 					Detail:        field.Type.String(),
-// 					Documentation: "Field of type: " + field.Type.String(),
-// 				})
-// 			}
-// 		} else {
-// 			// Get field completions for the type of the expression
-// 			field, err := bridge.ValidateField(ctx, typeInfo, pos)
-// 			if err == nil && field != nil {
-// 				// Get the underlying struct type if this is a struct field
-// 				if structType, ok := field.Type.Underlying().(*types.Struct); ok {
-// 					// Add all fields from the struct
-// 					for i := 0; i < structType.NumFields(); i++ {
-// 						f := structType.Field(i)
-// 						items = append(items, CompletionItem{
-// 							Label:         f.Name(),
-// 							Kind:          "field",
-// 							Detail:        f.Type().String(),
-// 							Documentation: "Field of type: " + f.Type().String(),
-// 						})
-// 					}
-// 				}
-// 			}
-// 		}
-// 	}
-
-// 	return items
-// }
+import (
+	"context"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Kinds of completion items
+const (
+	KindField    = "field"
+	KindMethod   = "method"
+	KindFunction = "function"
+)
+
+// CompletionItem represents a single completion suggestion
+type CompletionItem struct {
+	Label         string
+	Kind          string
+	Detail        string
+	Documentation string
+}
+
+// keywords after which a command (and so a function) is expected
+var commandKeywords = map[string]bool{
+	"if":        true,
+	"with":      true,
+	"range":     true,
+	"else if":   true,
+	"else with": true,
+}
+
+// GetCompletions returns completion items for the given cursor position.
+//
+// After a "." the fields and methods of the type at that path are returned, resolved
+// against the gotype hint of the enclosing block. After a "$var." they are resolved
+// against the type of the variable. In function position the builtin
+// template methods and the functions of the package's FuncMaps are returned.
+func GetCompletions(ctx context.Context, fileName string, content string, cursor position.RawPosition, registry *ast.Registry) ([]CompletionItem, error) {
+	if cursor.Offset < 0 || cursor.Offset > len(content) {
+		return nil, errors.Errorf("cursor offset %d out of range", cursor.Offset)
+	}
+
+	before := content[:cursor.Offset]
+
+	actionStart := strings.LastIndex(before, "{{")
+	if actionStart == -1 || strings.Contains(before[actionStart:], "}}") {
+		// not inside of an action
+		return nil, nil
+	}
+
+	action := before[actionStart+2:]
+	action = strings.TrimPrefix(action, "-")
+	if strings.HasPrefix(strings.TrimSpace(action), "/*") {
+		// inside of a comment
+		return nil, nil
+	}
+
+	word := wordBeforeCursor(action)
+	wordStart := len(action) - len(word)
+
+	zerolog.Ctx(ctx).Trace().Str("word", word).Str("action", action).Msg("completing")
+
+	if wordStart > 0 && action[wordStart-1] == '$' {
+		if !strings.Contains(word, ".") {
+			return nil, nil
+		}
+		return getVariableFieldCompletions(ctx, fileName, content, actionStart, cursor, "$"+word, registry)
+	}
+
+	if strings.HasPrefix(word, ".") {
+		return getFieldCompletions(ctx, fileName, content, actionStart, cursor, word, registry)
+	}
+
+	if strings.Contains(word, ".") || !isFunctionPosition(action[:wordStart]) {
+		return nil, nil
+	}
+
+	// function sets enabled by a directive are only known if the rest of the template parses
+	sets := []string{}
+	if info, err := parseIncomplete(ctx, fileName, content, actionStart, cursor.Offset, registry); err == nil {
+		sets = info.FunctionSets()
+	}
+
+	return getFunctionCompletions(word, registry.TemplateMethods(fileName, sets...)), nil
+}
+
+// wordBeforeCursor returns the identifier or field path that ends at the cursor
+func wordBeforeCursor(text string) string {
+	i := len(text)
+	for i > 0 {
+		c := text[i-1]
+		if c == '.' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') {
+			i--
+			continue
+		}
+		break
+	}
+	return text[i:]
+}
+
+// isFunctionPosition reports whether the text before a word indicates the start of a command
+func isFunctionPosition(text string) bool {
+	if idx := strings.LastIndexAny(text, "|("); idx != -1 {
+		text = text[idx+1:]
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || commandKeywords[strings.Join(strings.Fields(text), " ")] {
+		return true
+	}
+	return strings.HasSuffix(text, ":=") || strings.HasSuffix(text, "=")
+}
+
+func getFunctionCompletions(prefix string, methods map[string]*ast.TemplateMethodInfo) []CompletionItem {
+	items := []CompletionItem{}
+	for name, method := range methods {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		items = append(items, CompletionItem{
+			Label:         name,
+			Kind:          KindFunction,
+			Detail:        method.Signature(),
+			Documentation: "func " + name + strings.TrimPrefix(method.Signature(), "func"),
+		})
+	}
+
+	sortItems(items)
+	return items
+}
+
+func getFieldCompletions(ctx context.Context, fileName string, content string, actionStart int, cursor position.RawPosition, word string, registry *ast.Registry) ([]CompletionItem, error) {
+	info, err := parseIncomplete(ctx, fileName, content, actionStart, cursor.Offset, registry)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for completion: %w", err)
+	}
+
+	lastDot := strings.LastIndex(word, ".")
+	path, prefix := word[:lastDot], word[lastDot+1:]
+
+	typeInfo, err := resolveDotPath(ctx, info, cursor, path, cursor.Offset-len(word), registry)
+	if err != nil {
+		return nil, err
+	}
+	if typeInfo == nil {
+		return nil, nil
+	}
+
+	return fieldCompletions(typeInfo, prefix), nil
+}
+
+// getVariableFieldCompletions completes the field path of a variable, e.g. "$u.Address.Ci"
+func getVariableFieldCompletions(ctx context.Context, fileName string, content string, actionStart int, cursor position.RawPosition, word string, registry *ast.Registry) ([]CompletionItem, error) {
+	info, err := parseIncomplete(ctx, fileName, content, actionStart, cursor.Offset, registry)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for completion: %w", err)
+	}
+
+	name, rest, _ := strings.Cut(word, ".")
+	lastDot := strings.LastIndex(rest, ".")
+	path, prefix := "", rest
+	if lastDot != -1 {
+		path, prefix = "."+rest[:lastDot], rest[lastDot+1:]
+	}
+
+	typeInfo, err := resolveVariablePath(ctx, info, cursor, name, path, registry)
+	if err != nil {
+		return nil, err
+	}
+	if typeInfo == nil {
+		return nil, nil
+	}
+
+	return fieldCompletions(typeInfo, prefix), nil
+}
+
+// fieldCompletions returns the fields and methods of a type that start with prefix
+func fieldCompletions(typeInfo *ast.TypeHintDefinition, prefix string) []CompletionItem {
+	items := []CompletionItem{}
+	for name, field := range typeInfo.Fields {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		kind := KindField
+		documentation := "Field of type: " + field.Type.String()
+		if field.Type.Func != nil {
+			kind = KindMethod
+			documentation = methodDeclaration(field.Type.Func)
+		}
+		items = append(items, CompletionItem{
+			Label:         name,
+			Kind:          kind,
+			Detail:        field.Type.String(),
+			Documentation: documentation,
+		})
+	}
+
+	sortItems(items)
+	return items
+}
+
+// methodDeclaration returns the declaration of a method, e.g. "func (types.Person) GetJob() string"
+func methodDeclaration(method *types.Func) string {
+	sig := method.Type().(*types.Signature)
+	recv := ""
+	if sig.Recv() != nil {
+		recv = "(" + types.TypeString(sig.Recv().Type(), qualifier) + ") "
+	}
+	return "func " + recv + method.Name() + strings.TrimPrefix(types.TypeString(sig, qualifier), "func")
+}
+
+// resolveDotPath returns the type definition of the value at a field path (e.g. ".Address")
+// relative to the type hint of the block at the cursor. The empty path is the hinted type
+// itself. Nil is returned if there is no type hint or the path can not be resolved.
+func resolveDotPath(ctx context.Context, info *parser.ParsedTemplateFile, cursor position.RawPosition, path string, offset int, registry *ast.Registry) (*ast.TypeHintDefinition, error) {
+	block := info.GetBlockFromPosition(cursor)
+	if block == nil || block.TypeHint == nil {
+		return nil, nil
+	}
+
+	typeInfo, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+	if err != nil {
+		return nil, errors.Errorf("building type hint definition: %w", err)
+	}
+
+	if path == "" {
+		return typeInfo, nil
+	}
+
+	field, err := ast.GenerateFieldInfoFromPosition(ctx, typeInfo, position.NewBasicPosition(path, offset))
+	if err != nil {
+		// an unresolvable path simply has nothing to offer
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", path).Msg("unable to resolve path")
+		return nil, nil
+	}
+
+	typeInfo, err = ast.GenerateTypeHintDefinitionFromFieldInfo(ctx, field)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", path).Msg("unable to resolve type of path")
+		return nil, nil
+	}
+
+	return typeInfo, nil
+}
+
+// resolveVariablePath returns the type definition of the value at a field path (e.g. ".Address")
+// of a variable, which is resolved through the scope of the block at the cursor. Nil is returned
+// if the variable or the path can not be resolved.
+func resolveVariablePath(ctx context.Context, info *parser.ParsedTemplateFile, cursor position.RawPosition, name string, path string, registry *ast.Registry) (*ast.TypeHintDefinition, error) {
+	block := info.GetBlockFromPosition(cursor)
+	if block == nil || block.TypeHint == nil {
+		return nil, nil
+	}
+
+	root, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+	if err != nil {
+		return nil, errors.Errorf("building type hint definition: %w", err)
+	}
+
+	typ := root.Type
+	addressable := root.Addressable
+	if name != "$" {
+		variable := block.LookupVariable(name, cursor.Offset)
+		if variable == nil {
+			return nil, nil
+		}
+		methods := registry.TemplateMethods(info.Filename, info.FunctionSets()...)
+		typ, err = variable.ResolveType(ctx, root.Type, methods)
+		if err != nil || typ == nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Str("variable", name).Msg("unable to resolve type of variable")
+			return nil, nil
+		}
+		addressable = variable.Addressable(ctx, root, methods)
+	}
+
+	addressable = ast.FieldPathAddressable(ctx, typ, addressable, path)
+	typ, err = ast.FieldPathType(ctx, typ, path)
+	if err != nil {
+		// an unresolvable path simply has nothing to offer
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", name+path).Msg("unable to resolve path")
+		return nil, nil
+	}
+
+	typeInfo, err := ast.GenerateTypeHintDefinitionFromType(ctx, typ, addressable)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", name+path).Msg("unable to resolve type of path")
+		return nil, nil
+	}
+
+	return typeInfo, nil
+}
+
+// parseIncomplete parses the template, and if that fails (which is expected while typing)
+// parses it again with the action being edited blanked out. Blanking with spaces keeps
+// all of the offsets intact. The blocks get the type hints implied by the go code.
+func parseIncomplete(ctx context.Context, fileName string, content string, actionStart int, cursor int, registry *ast.Registry) (*parser.ParsedTemplateFile, error) {
+	info, err := parser.ParseWithRegistry(ctx, fileName, []byte(content), registry)
+	if err == nil {
+		return info, nil
+	}
+
+	actionEnd := len(content)
+	if idx := strings.Index(content[cursor:], "}}"); idx != -1 {
+		actionEnd = cursor + idx + 2
+	}
+
+	blanked := content[:actionStart] + strings.Repeat(" ", actionEnd-actionStart) + content[actionEnd:]
+
+	info, err2 := parser.ParseWithRegistry(ctx, fileName, []byte(blanked), registry)
+	if err2 != nil {
+		return nil, errors.Errorf("parsing template: %w", err)
+	}
+
+	return info, nil
+}
+
+func sortItems(items []CompletionItem) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Label < items[j].Label
+	})
+}
@@ -1,77 +1,214 @@
-package completion
-
-// func TestGetCompletions(t *testing.T) {
-// 	tests := []struct {
-// 		name     string
-// 		content  string
-// 		offset   int
-// 		typeInfo *bridge.TypeInfo
-// 		want     []CompletionItem
-// 	}{
-// 		{
-// 			name:    "empty content",
-// 			content: "",
-// 			offset:  0,
-// 			typeInfo: &bridge.TypeInfo{
-// 				Name: "User",
-// 				Fields: map[string]*bridge.FieldInfo{
-// 					"Name": {
-// 						Name: "Name",
-// 						Type: types.Typ[types.String],
-// 					},
-// 					"Age": {
-// 						Name: "Age",
-// 						Type: types.Typ[types.Int],
-// 					},
-// 				},
-// 			},
-// 			want: nil,
-// 		},
-// 		{
-// 			name:    "field completion",
-// 			content: "{{ . }}",
-// 			offset:  5,
-// 			typeInfo: &bridge.TypeInfo{
-// 				Name: "User",
-// 				Fields: map[string]*bridge.FieldInfo{
-// 					"Name": {
-// 						Name: "Name",
-// 						Type: types.Typ[types.String],
-// 					},
-// 					"Age": {
-// 						Name: "Age",
-// 						Type: types.Typ[types.Int],
-// 					},
-// 				},
-// 			},
-// 			want: []CompletionItem{
-// 				{
-// 					Label:         "Name",
-// 					Kind:          "field",
-// 					Detail:        "string",
-// 					Documentation: "Field of type: string",
-// 				},
-// 				{
-// 					Label:         "Age",
-// 					Kind:          "field",
-// 					Detail:        "int",
-// 					Documentation: "Field of type: int",
-// 				},
-// 			},
-// 		},
-// 	}
-
-// 	for _, tt := range tests {
-// 		t.Run(tt.name, func(t *testing.T) {
-// 			doc := position.NewDocument(tt.content)
-// 			pos := doc.NewBasicPosition(tt.content, tt.offset)
-// 			fmt.Printf("Test %s: content=%q, offset=%d\n", tt.name, tt.content, tt.offset)
-// 			fmt.Printf("IsAfterDot=%v, IsInTemplateAction=%v, IsDotCompletion=%v\n",
-// 				position.IsAfterDot(pos),
-// 				position.IsInTemplateAction(pos),
-// 				position.IsDotCompletion(pos))
-// 			got := GetCompletions(context.Background(), pos, tt.typeInfo)
-// 			assert.Equal(t, tt.want, got, "GetCompletions should match expected value")
-// 		})
-// 	}
-// }
+package completion_test
+
+import (
+	"context"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/completion"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+func createMockRegistry(t *testing.T) *ast.Registry {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+	address := pkgd.AddStruct("Address", map[string]types.Type{
+		"Street": types.Typ[types.String],
+		"City":   types.Typ[types.String],
+	})
+
+	person := pkgd.AddStruct("Person", map[string]types.Type{
+		"Name":    types.Typ[types.String],
+		"Age":     types.Typ[types.Int],
+		"Address": address,
+	})
+
+	sig := types.NewSignatureType(
+		types.NewVar(0, pkgd.Package.Types, "p", person),
+		nil,
+		nil,
+		types.NewTuple(),
+		types.NewTuple(types.NewVar(0, pkgd.Package.Types, "", types.Typ[types.String])),
+		false,
+	)
+	person.AddMethod(types.NewFunc(0, pkgd.Package.Types, "GetJob", sig))
+
+	pkgd.AddFunction("prettyPrint", types.NewSignature(
+		nil,
+		types.NewTuple(types.NewVar(0, pkgd.Package.Types, "v", types.NewInterfaceType(nil, nil))),
+		types.NewTuple(types.NewVar(0, pkgd.Package.Types, "", types.Typ[types.String])),
+		false,
+	))
+
+	return registry
+}
+
+func labels(items []completion.CompletionItem) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.Label)
+	}
+	return out
+}
+
+func TestGetCompletions(t *testing.T) {
+	tests := []struct {
+		name string
+		// the cursor is placed at the "^" character, which is removed from the template
+		template   string
+		wantLabels []string
+		wantKinds  map[string]string
+	}{
+		{
+			name:       "root fields after dot",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .^ }}",
+			wantLabels: []string{"Address", "Age", "GetJob", "Name"},
+			wantKinds: map[string]string{
+				"Address": completion.KindField,
+				"GetJob":  completion.KindMethod,
+			},
+		},
+		{
+			name:       "root fields filtered by prefix",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .A^ }}",
+			wantLabels: []string{"Address", "Age"},
+		},
+		{
+			name:       "nested path",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Address.^ }}",
+			wantLabels: []string{"City", "Street"},
+		},
+		{
+			name:       "nested path without closing braces",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Address.C^",
+			wantLabels: []string{"City"},
+		},
+		{
+			name:       "unresolvable path",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Nope.^ }}",
+			wantLabels: nil,
+		},
+		{
+			name:       "variable fields",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ $a := .Address }}{{ $a.^ }}",
+			wantLabels: []string{"City", "Street"},
+		},
+		{
+			name:       "nested path of a variable",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ with $p := . }}{{ $p.Address.S^ }}{{ end }}",
+			wantLabels: []string{"Street"},
+		},
+		{
+			name:       "root variable",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ $.A^ }}",
+			wantLabels: []string{"Address", "Age"},
+		},
+		{
+			name:       "variable declared after the cursor",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ $a.^ }}{{ $a := .Address }}",
+			wantLabels: nil,
+		},
+		{
+			name:       "function position",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Name | up^ }}",
+			wantLabels: []string{"upper"},
+			wantKinds: map[string]string{
+				"upper": completion.KindFunction,
+			},
+		},
+		{
+			name:       "function after if keyword",
+			template:   "{{ if le^ }}{{ end }}",
+			wantLabels: []string{"le", "len"},
+		},
+		{
+			name:       "function at start of action",
+			template:   "{{ prin^ }}",
+			wantLabels: []string{"print", "printf", "println"},
+		},
+		{
+			name:       "funcmap function",
+			template:   "{{ .Name | pre^ }}",
+			wantLabels: []string{"prettyPrint"},
+			wantKinds: map[string]string{
+				"prettyPrint": completion.KindFunction,
+			},
+		},
+		{
+			name:       "outside of action",
+			template:   "{{- /*gotype: github.com/example/types.Person*/ -}}\nHello .^",
+			wantLabels: nil,
+		},
+		{
+			name:       "inside of a comment",
+			template:   "{{/* .^ */}}",
+			wantLabels: nil,
+		},
+		{
+			name:       "no type hint",
+			template:   "{{ .^ }}",
+			wantLabels: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			offset := strings.Index(tt.template, "^")
+			content := tt.template[:offset] + tt.template[offset+1:]
+
+			got, err := completion.GetCompletions(ctx, "test.tmpl", content, position.NewBasicPosition("", offset), createMockRegistry(t))
+			require.NoError(t, err)
+
+			if tt.wantLabels == nil {
+				assert.Empty(t, got)
+				return
+			}
+
+			assert.Equal(t, tt.wantLabels, labels(got))
+
+			for _, item := range got {
+				if kind, ok := tt.wantKinds[item.Label]; ok {
+					assert.Equal(t, kind, item.Kind, "kind mismatch for %s", item.Label)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCompletionsDetail(t *testing.T) {
+	ctx := context.Background()
+
+	content := "{{ upp }}"
+	got, err := completion.GetCompletions(ctx, "test.tmpl", content, position.NewBasicPosition("", 6), createMockRegistry(t))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "upper", got[0].Label)
+	assert.Equal(t, "func(string) string", got[0].Detail)
+	assert.Equal(t, "func upper(string) string", got[0].Documentation)
+}
+
+func TestGetCompletionsFieldDocumentation(t *testing.T) {
+	ctx := context.Background()
+
+	content := "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ . }}"
+	got, err := completion.GetCompletions(ctx, "test.tmpl", content, position.NewBasicPosition("", len(content)-3), createMockRegistry(t))
+	require.NoError(t, err)
+
+	documentation := map[string]string{}
+	for _, item := range got {
+		documentation[item.Label] = item.Documentation
+	}
+
+	assert.Equal(t, "Field of type: string", documentation["Name"])
+	assert.Equal(t, "func (types.Person) GetJob() string", documentation["GetJob"])
+}
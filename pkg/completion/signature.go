@@ -0,0 +1,371 @@
+package completion
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/position"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Signature describes the function or method called by the command at the cursor
+type Signature struct {
+	// Label is the whole signature, e.g. "printf(arg1 string, arg2 ...interface{}) string"
+	Label         string
+	Documentation string
+	Parameters    []SignatureParameter
+	// ActiveParameter is the index of the parameter the cursor is at
+	ActiveParameter int
+	// Piped is the command whose result is passed as the last argument, e.g. ".Name" in
+	// {{ .Name | printf "%s" }}, or empty if the command is not part of a pipeline
+	Piped string
+}
+
+// SignatureParameter is a parameter of a signature, its label is a substring of the signature label
+type SignatureParameter struct {
+	Label         string
+	Documentation string
+}
+
+// keywords that can start an action before its pipeline
+var pipelineKeywords = map[string]bool{
+	"if":    true,
+	"else":  true,
+	"with":  true,
+	"range": true,
+}
+
+// GetSignatureHelp returns the signature of the function or method whose arguments are
+// being typed at the cursor, e.g. printf in {{ printf "%s %d" .Name or Format in
+// {{ .Format "2006" }}.
+//
+// Builtin and FuncMap functions are described by their template method info, methods of
+// the dot by their Go signature. In a pipeline the result of the previous command is
+// passed as the last argument, so the last parameter is marked as filled by it and the
+// arguments being typed fill the parameters before it.
+func GetSignatureHelp(ctx context.Context, fileName string, content string, cursor position.RawPosition, registry *ast.Registry) (*Signature, error) {
+	if cursor.Offset < 0 || cursor.Offset > len(content) {
+		return nil, errors.Errorf("cursor offset %d out of range", cursor.Offset)
+	}
+
+	before := content[:cursor.Offset]
+
+	actionStart := strings.LastIndex(before, "{{")
+	if actionStart == -1 || strings.Contains(before[actionStart:], "}}") {
+		// not inside of an action
+		return nil, nil
+	}
+
+	action := before[actionStart+2:]
+	action = strings.TrimPrefix(action, "-")
+	if strings.HasPrefix(strings.TrimSpace(action), "/*") {
+		// inside of a comment
+		return nil, nil
+	}
+
+	cmd := scanCommand(action)
+	if cmd == nil {
+		return nil, nil
+	}
+
+	zerolog.Ctx(ctx).Trace().Strs("words", cmd.words).Str("piped", cmd.piped).Int("arg", cmd.arg).Msg("signature help")
+
+	var (
+		sig *Signature
+		err error
+	)
+
+	switch name := cmd.words[0]; {
+	case strings.HasPrefix(name, "."):
+		sig, err = methodSignature(ctx, fileName, content, actionStart, cursor, name, registry)
+	case isIdentifier(name):
+		sig, err = functionSignature(ctx, fileName, content, actionStart, cursor, name, registry)
+	default:
+		// variables, literals and parenthesized pipelines are not called
+		return nil, nil
+	}
+	if err != nil || sig == nil {
+		return nil, err
+	}
+
+	sig.Piped = cmd.piped
+	sig.ActiveParameter = activeParameter(len(sig.Parameters), cmd.arg, cmd.piped != "", strings.HasPrefix(lastParameter(sig), "..."))
+
+	if cmd.piped != "" && len(sig.Parameters) > 0 {
+		last := &sig.Parameters[len(sig.Parameters)-1]
+		last.Documentation = fmt.Sprintf("Filled by the piped value `%s`", cmd.piped)
+		sig.Documentation += fmt.Sprintf("\n\nThe result of `%s` is passed as the last argument, `%s`.", cmd.piped, last.Label)
+	}
+
+	return sig, nil
+}
+
+// functionSignature returns the signature of a builtin or FuncMap function
+func functionSignature(ctx context.Context, fileName string, content string, actionStart int, cursor position.RawPosition, name string, registry *ast.Registry) (*Signature, error) {
+	// function sets enabled by a directive are only known if the rest of the template parses
+	sets := []string{}
+	if info, err := parseIncomplete(ctx, fileName, content, actionStart, cursor.Offset, registry); err == nil {
+		sets = info.FunctionSets()
+	}
+
+	method, ok := registry.TemplateMethods(fileName, sets...)[name]
+	if !ok {
+		return nil, nil
+	}
+
+	names := make([]string, len(method.Parameters))
+	for i := range names {
+		names[i] = fmt.Sprintf("arg%d", i+1)
+	}
+
+	sig := buildSignature(name, names, method.Parameters, method.Results, method.Variadic)
+	sig.Documentation = "Template function: " + name
+	return sig, nil
+}
+
+// methodSignature returns the signature of a method at a field path, e.g. ".CreatedAt.Format"
+func methodSignature(ctx context.Context, fileName string, content string, actionStart int, cursor position.RawPosition, word string, registry *ast.Registry) (*Signature, error) {
+	info, err := parseIncomplete(ctx, fileName, content, actionStart, cursor.Offset, registry)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for signature help: %w", err)
+	}
+
+	lastDot := strings.LastIndex(word, ".")
+	path, name := word[:lastDot], word[lastDot+1:]
+
+	typeInfo, err := resolveDotPath(ctx, info, cursor, path, actionStart, registry)
+	if err != nil || typeInfo == nil {
+		return nil, err
+	}
+
+	field, ok := typeInfo.Fields[name]
+	if !ok || field.Type.Func == nil {
+		return nil, nil
+	}
+
+	signature, ok := field.Type.Func.Type().(*types.Signature)
+	if !ok {
+		return nil, nil
+	}
+
+	names := make([]string, signature.Params().Len())
+	params := make([]types.Type, signature.Params().Len())
+	for i := range params {
+		param := signature.Params().At(i)
+		names[i] = param.Name()
+		if names[i] == "" || names[i] == "_" {
+			names[i] = fmt.Sprintf("arg%d", i+1)
+		}
+		params[i] = param.Type()
+	}
+
+	results := make([]types.Type, signature.Results().Len())
+	for i := range results {
+		results[i] = signature.Results().At(i).Type()
+	}
+
+	sig := buildSignature(name, names, params, results, signature.Variadic())
+	sig.Documentation = "Method " + name
+	if recv := signature.Recv(); recv != nil {
+		sig.Documentation = "Method of " + types.TypeString(recv.Type(), qualifier)
+	}
+	return sig, nil
+}
+
+// buildSignature formats a signature in Go style, with a variadic last parameter as "...T"
+func buildSignature(name string, names []string, params []types.Type, results []types.Type, variadic bool) *Signature {
+	sig := &Signature{Parameters: make([]SignatureParameter, len(params))}
+
+	labels := make([]string, len(params))
+	for i, param := range params {
+		typ := types.TypeString(param, qualifier)
+		if slice, ok := param.(*types.Slice); ok && variadic && i == len(params)-1 {
+			typ = "..." + types.TypeString(slice.Elem(), qualifier)
+		}
+		labels[i] = names[i] + " " + typ
+		sig.Parameters[i] = SignatureParameter{Label: labels[i]}
+	}
+
+	sig.Label = name + "(" + strings.Join(labels, ", ") + ")"
+
+	resultStrings := make([]string, len(results))
+	for i, result := range results {
+		resultStrings[i] = types.TypeString(result, qualifier)
+	}
+
+	switch len(resultStrings) {
+	case 0:
+	case 1:
+		sig.Label += " " + resultStrings[0]
+	default:
+		sig.Label += " (" + strings.Join(resultStrings, ", ") + ")"
+	}
+
+	return sig
+}
+
+// activeParameter maps the index of the argument at the cursor to a parameter. The piped
+// value fills the last parameter, so typed arguments only reach it if it is variadic.
+func activeParameter(params int, arg int, piped bool, variadic bool) int {
+	if params == 0 {
+		return 0
+	}
+	explicit := params
+	if piped && !variadic {
+		explicit = params - 1
+	}
+	if arg >= explicit {
+		return params - 1
+	}
+	return arg
+}
+
+func lastParameter(sig *Signature) string {
+	if len(sig.Parameters) == 0 {
+		return ""
+	}
+	label := sig.Parameters[len(sig.Parameters)-1].Label
+	return label[strings.IndexByte(label, ' ')+1:]
+}
+
+// qualifier writes package qualified types with the package name only, e.g. "time.Time"
+func qualifier(pkg *types.Package) string {
+	return pkg.Name()
+}
+
+// command is the command being typed at the cursor
+type command struct {
+	// words are the function and the arguments up to the cursor
+	words []string
+	// arg is the index of the argument at the cursor
+	arg int
+	// piped is the previous command of the pipeline
+	piped string
+}
+
+// scanCommand returns the innermost command of the action text that the cursor, at the
+// end of the text, is in. Nil is returned if the cursor is still at the function name.
+func scanCommand(action string) *command {
+	type frame struct {
+		start int // the offset of the opening parenthesis
+		words []string
+		piped string
+	}
+
+	stack := []*frame{{start: -1}}
+	word := -1 // the start of the current word
+
+	endWord := func(i int) {
+		if word != -1 {
+			top := stack[len(stack)-1]
+			top.words = append(top.words, action[word:i])
+			word = -1
+		}
+	}
+
+	for i := 0; i < len(action); i++ {
+		top := stack[len(stack)-1]
+		switch c := action[i]; c {
+		case '"', '`', '\'':
+			if word == -1 {
+				word = i
+			}
+			i = skipQuoted(action, i)
+		case '(':
+			endWord(i)
+			stack = append(stack, &frame{start: i})
+		case ')':
+			endWord(i)
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+				parent := stack[len(stack)-1]
+				parent.words = append(parent.words, action[top.start:i+1])
+			}
+		case '|':
+			endWord(i)
+			top.piped = strings.Join(commandWords(top.words, len(stack) == 1 && top.piped == ""), " ")
+			top.words = nil
+		case ' ', '\t', '\r', '\n':
+			endWord(i)
+		default:
+			if word == -1 {
+				word = i
+			}
+		}
+	}
+
+	typing := word != -1 || strings.HasSuffix(action, ")")
+	endWord(len(action))
+
+	top := stack[len(stack)-1]
+	words := commandWords(top.words, len(stack) == 1 && top.piped == "")
+	if len(words) == 0 || (typing && len(words) == 1) {
+		return nil
+	}
+
+	arg := len(words) - 1
+	if typing {
+		arg--
+	}
+
+	return &command{words: words, arg: arg, piped: top.piped}
+}
+
+// commandWords strips the declarations and, for the first command of an action, the
+// keywords before a command, e.g. "range $i, $v := .Items" is the command ".Items"
+func commandWords(words []string, first bool) []string {
+	for i := len(words) - 1; i >= 0; i-- {
+		if words[i] == "=" || strings.HasSuffix(words[i], ":=") {
+			return words[i+1:]
+		}
+	}
+
+	if !first {
+		return words
+	}
+
+	for len(words) > 0 {
+		switch {
+		case pipelineKeywords[words[0]]:
+			words = words[1:]
+		case words[0] == "template" || words[0] == "block":
+			// the name of the template is not an argument
+			words = words[min(2, len(words)):]
+		default:
+			return words
+		}
+	}
+
+	return words
+}
+
+// skipQuoted returns the offset of the closing quote of the literal at start, or the last
+// offset of the text if it is not closed yet
+func skipQuoted(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			return i
+		}
+	}
+	return len(text) - 1
+}
+
+func isIdentifier(word string) bool {
+	for i, c := range word {
+		if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		return false
+	}
+	return word != ""
+}
@@ -0,0 +1,183 @@
+package completion_test
+
+import (
+	"context"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/completion"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+func createSignatureRegistry(t *testing.T) *ast.Registry {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+	pkg := pkgd.Package.Types
+
+	stamp := pkgd.AddStruct("Stamp", map[string]types.Type{})
+	stamp.AddMethod(types.NewFunc(0, pkg, "Format", types.NewSignature(
+		types.NewVar(0, pkg, "s", stamp),
+		types.NewTuple(types.NewVar(0, pkg, "layout", types.Typ[types.String])),
+		types.NewTuple(types.NewVar(0, pkg, "", types.Typ[types.String])),
+		false,
+	)))
+
+	event := pkgd.AddStruct("Event", map[string]types.Type{
+		"Name":      types.Typ[types.String],
+		"CreatedAt": stamp,
+	})
+	event.AddMethod(types.NewFunc(0, pkg, "Greet", types.NewSignature(
+		types.NewVar(0, pkg, "e", event),
+		types.NewTuple(
+			types.NewVar(0, pkg, "greeting", types.Typ[types.String]),
+			types.NewVar(0, pkg, "times", types.Typ[types.Int]),
+		),
+		types.NewTuple(types.NewVar(0, pkg, "", types.Typ[types.String])),
+		false,
+	)))
+
+	return registry
+}
+
+func TestGetSignatureHelp(t *testing.T) {
+	const hint = "{{- /*gotype: github.com/example/types.Event*/ -}}\n"
+
+	tests := []struct {
+		name string
+		// the cursor is placed at the "^" character, which is removed from the template
+		template   string
+		wantLabel  string
+		wantActive int
+		wantPiped  string
+	}{
+		{
+			name:       "builtin first argument",
+			template:   `{{ printf ^`,
+			wantLabel:  "printf(arg1 string, arg2 ...interface{}) string",
+			wantActive: 0,
+		},
+		{
+			name:       "builtin variadic argument",
+			template:   `{{ printf "%s %d" .Name ^`,
+			wantLabel:  "printf(arg1 string, arg2 ...interface{}) string",
+			wantActive: 1,
+		},
+		{
+			name:       "argument being typed",
+			template:   `{{ printf "%s %d" .Na^ }}`,
+			wantLabel:  "printf(arg1 string, arg2 ...interface{}) string",
+			wantActive: 1,
+		},
+		{
+			name:       "unterminated string argument",
+			template:   `{{ printf "%s ^`,
+			wantLabel:  "printf(arg1 string, arg2 ...interface{}) string",
+			wantActive: 0,
+		},
+		{
+			name:       "method of dot",
+			template:   hint + `{{ .Greet "hi" ^ }}`,
+			wantLabel:  "Greet(greeting string, times int) string",
+			wantActive: 1,
+		},
+		{
+			name:       "method at field path",
+			template:   hint + `{{ .CreatedAt.Format ^ }}`,
+			wantLabel:  "Format(layout string) string",
+			wantActive: 0,
+		},
+		{
+			name:       "piped value fills the last parameter",
+			template:   `{{ .Name | replace ^ }}`,
+			wantLabel:  "replace(arg1 string, arg2 string, arg3 string) string",
+			wantActive: 0,
+			wantPiped:  ".Name",
+		},
+		{
+			name:       "no argument left for the piped value",
+			template:   `{{ .Name | replace "a" "b" ^ }}`,
+			wantLabel:  "replace(arg1 string, arg2 string, arg3 string) string",
+			wantActive: 2,
+			wantPiped:  ".Name",
+		},
+		{
+			name:       "parenthesized command",
+			template:   `{{ if eq (len .Name) ^ }}{{ end }}`,
+			wantLabel:  "eq(arg1 interface{}, arg2 ...interface{}) (bool, error)",
+			wantActive: 1,
+		},
+		{
+			name:       "inside of parentheses",
+			template:   `{{ printf "%s" (upper ^) }}`,
+			wantLabel:  "upper(arg1 string) string",
+			wantActive: 0,
+		},
+		{
+			name:       "after a declaration",
+			template:   `{{ $x := split ^ }}`,
+			wantLabel:  "split(arg1 string, arg2 string) []string",
+			wantActive: 0,
+		},
+		{
+			name:     "still typing the function name",
+			template: `{{ prin^ }}`,
+		},
+		{
+			name:     "field is not called",
+			template: hint + `{{ .Name ^ }}`,
+		},
+		{
+			name:     "unknown function",
+			template: `{{ nope ^ }}`,
+		},
+		{
+			name:     "outside of action",
+			template: `printf ^`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			offset := strings.Index(tt.template, "^")
+			content := tt.template[:offset] + tt.template[offset+1:]
+
+			got, err := completion.GetSignatureHelp(ctx, "test.tmpl", content, position.NewBasicPosition("", offset), createSignatureRegistry(t))
+			require.NoError(t, err)
+
+			if tt.wantLabel == "" {
+				assert.Nil(t, got)
+				return
+			}
+
+			require.NotNil(t, got)
+			assert.Equal(t, tt.wantLabel, got.Label)
+			assert.Equal(t, tt.wantActive, got.ActiveParameter)
+			assert.Equal(t, tt.wantPiped, got.Piped)
+			for _, param := range got.Parameters {
+				assert.Contains(t, got.Label, param.Label)
+			}
+		})
+	}
+}
+
+func TestGetSignatureHelpPipedDocumentation(t *testing.T) {
+	content := `{{ .Name | printf "%s" }}`
+
+	got, err := completion.GetSignatureHelp(context.Background(), "test.tmpl", content, position.NewBasicPosition("", strings.Index(content, `"%s"`)), createSignatureRegistry(t))
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	require.Len(t, got.Parameters, 2)
+
+	assert.Empty(t, got.Parameters[0].Documentation)
+	assert.Equal(t, "Filled by the piped value `.Name`", got.Parameters[1].Documentation)
+	assert.Contains(t, got.Documentation, "The result of `.Name` is passed as the last argument, `arg2 ...interface{}`.")
+}
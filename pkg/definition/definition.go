@@ -0,0 +1,173 @@
+// Package definition provides functionality for locating the declarations behind template references.
+package definition
+
+import (
+	"context"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Location represents the location of a definition in a file
+type Location struct {
+	// File is the path of the file containing the definition
+	File string
+	// Range is the range of the definition in the file
+	Range position.Range
+}
+
+// FindDefinition returns the location of the declaration behind the reference at the given position.
+//
+// Supported references are:
+//   - fields and methods, e.g. {{ .Address.City }}, which resolve to the go struct field or method
+//   - type hints, e.g. {{/*gotype: pkg.Person*/}}, which resolve to the go named type
+//   - template calls, e.g. {{ template "name" }}, which resolve to the matching define or block
+func FindDefinition(ctx context.Context, info *parser.ParsedTemplateFile, pos position.RawPosition, registry *ast.Registry) ([]Location, error) {
+	for _, block := range info.Blocks {
+		for _, call := range block.TemplateCalls {
+			if pos.HasRangeOverlapWith(call.Position) {
+				zerolog.Ctx(ctx).Trace().Msgf("template call %s at %v overlaps with position %v", call.Name, call.Position, pos)
+				return FindTemplateDefinitions(ctx, info, call.Name, registry), nil
+			}
+		}
+	}
+
+	obj, err := ResolveObjectAtPosition(ctx, info, pos, registry)
+	if err != nil {
+		return nil, errors.Errorf("resolving object: %w", err)
+	}
+
+	if obj == nil {
+		return nil, nil
+	}
+
+	loc, err := NewLocationFromObject(registry, obj)
+	if err != nil {
+		return nil, errors.Errorf("finding location of %s: %w", obj.Name(), err)
+	}
+
+	return []Location{loc}, nil
+}
+
+// ResolveObjectAtPosition returns the go object (a *types.Var, *types.Func or *types.TypeName) that
+// the field, method or type hint at the given position refers to. It returns nil if there is no
+// reference at the position.
+func ResolveObjectAtPosition(ctx context.Context, info *parser.ParsedTemplateFile, pos position.RawPosition, registry *ast.Registry) (types.Object, error) {
+	methods := registry.TemplateMethods(info.Filename, info.FunctionSets()...)
+
+	for _, block := range info.Blocks {
+		if block.TypeHint == nil {
+			continue
+		}
+
+		if pos.HasRangeOverlapWith(block.TypeHint.Position) {
+			thd, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+			if err != nil {
+				return nil, errors.Errorf("building type hint definition: %w", err)
+			}
+			if root := thd.TypeName(); root != nil {
+				return root, nil
+			}
+			return nil, nil
+		}
+
+		for _, variable := range block.Variables {
+			if !pos.HasRangeOverlapWith(variable.Position) {
+				continue
+			}
+
+			thd, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+			if err != nil {
+				return nil, errors.Errorf("building type hint definition: %w", err)
+			}
+
+			dotThd, err := variable.DotTypeHintDefinition(ctx, thd, methods)
+			if err != nil || dotThd == nil {
+				return nil, nil
+			}
+
+			field, err := ast.GenerateFieldInfoFromPosition(ctx, dotThd, variable.PathAtPosition(pos))
+			if err != nil {
+				return nil, errors.Errorf("generating field info: %w", err)
+			}
+
+			return field.Type.Obj(), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// NewLocationFromObject returns the location of the declaration of a go object
+func NewLocationFromObject(registry *ast.Registry, obj types.Object) (Location, error) {
+	pos, err := registry.GetObjectPosition(obj)
+	if err != nil {
+		return Location{}, err
+	}
+
+	return NewLocationFromTokenPosition(pos, obj.Name()), nil
+}
+
+// NewLocationFromTokenPosition converts a go token position of an identifier to a Location
+func NewLocationFromTokenPosition(pos token.Position, name string) Location {
+	start := position.Place{Line: pos.Line - 1, Character: pos.Column - 1}
+	return Location{
+		File: pos.Filename,
+		Range: position.Range{
+			Start: start,
+			End:   position.Place{Line: start.Line, Character: start.Character + len(name)},
+		},
+	}
+}
+
+// FindTemplateDefinitions returns the locations of the define or block statements for a template name.
+// The current file is searched first, followed by every other template file in the registry.
+func FindTemplateDefinitions(ctx context.Context, info *parser.ParsedTemplateFile, name string, registry *ast.Registry) []Location {
+	if loc, ok := findTemplateDefinitionInContent(ctx, info.Filename, info.SourceContent, name); ok {
+		return []Location{loc}
+	}
+
+	locs := []Location{}
+	if registry == nil {
+		return locs
+	}
+
+	for _, pkg := range registry.Packages {
+		for file, content := range pkg.TemplateFiles {
+			if file == info.Filename {
+				continue
+			}
+			if loc, ok := findTemplateDefinitionInContent(ctx, file, content, name); ok {
+				locs = append(locs, loc)
+			}
+		}
+	}
+
+	sort.Slice(locs, func(i, j int) bool {
+		return locs[i].File < locs[j].File
+	})
+
+	return locs
+}
+
+func findTemplateDefinitionInContent(ctx context.Context, file string, content string, name string) (Location, bool) {
+	start, err := parser.UseRegexToFindStartOfBlock(ctx, content, name)
+	if err != nil {
+		zerolog.Ctx(ctx).Trace().Err(err).Str("file", file).Str("name", name).Msg("template definition not found")
+		return Location{}, false
+	}
+
+	return Location{
+		File: file,
+		Range: position.Range{
+			Start: position.OffsetToPlace(content, start.Offset),
+			End:   position.OffsetToPlace(content, start.Offset+start.Length()),
+		},
+	}, true
+}
@@ -0,0 +1,88 @@
+package definition_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/definition"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+func TestFindDefinitionTemplateCalls(t *testing.T) {
+	tests := []struct {
+		name string
+		// the cursor is placed at the "^" character, which is removed from the template
+		template string
+		others   map[string]string
+		want     []definition.Location
+	}{
+		{
+			name:     "define in same file",
+			template: "{{ template \"he^ader\" }}\n{{ define \"header\" }}hi{{ end }}",
+			want: []definition.Location{
+				{
+					File: "test.tmpl",
+					Range: position.Range{
+						Start: position.Place{Line: 1, Character: 0},
+						End:   position.Place{Line: 1, Character: 21},
+					},
+				},
+			},
+		},
+		{
+			name:     "block in another file",
+			template: "{{ template \"^footer\" . }}",
+			others: map[string]string{
+				"b.tmpl": "hello\n  {{- block \"footer\" . -}}bye{{ end }}",
+				"a.tmpl": "{{ define \"other\" }}{{ end }}",
+			},
+			want: []definition.Location{
+				{
+					File: "b.tmpl",
+					Range: position.Range{
+						Start: position.Place{Line: 1, Character: 2},
+						End:   position.Place{Line: 1, Character: 26},
+					},
+				},
+			},
+		},
+		{
+			name:     "missing define",
+			template: "{{ template \"^nope\" }}",
+			want:     []definition.Location{},
+		},
+		{
+			name:     "outside of a reference",
+			template: "he^llo {{ template \"header\" }}",
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			offset := strings.Index(tt.template, "^")
+			content := tt.template[:offset] + tt.template[offset+1:]
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+			pkgd.AddTemplateFile("test.tmpl", content)
+			for name, other := range tt.others {
+				pkgd.AddTemplateFile(name, other)
+			}
+
+			info, err := parser.Parse(ctx, "test.tmpl", []byte(content))
+			require.NoError(t, err)
+
+			got, err := definition.FindDefinition(ctx, info, position.NewBasicPosition("", offset), registry)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
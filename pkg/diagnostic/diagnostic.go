@@ -2,6 +2,11 @@ package diagnostic
 
 import (
 	"context"
+	"fmt"
+	"go/types"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/walteh/gotmpls/pkg/ast"
 	"github.com/walteh/gotmpls/pkg/parser"
@@ -14,8 +19,28 @@ type Diagnostic struct {
 	Message  string
 	Location position.RawPosition
 	Severity int
+	Rule     string
+	// Suggestions are replacements for the text at SuggestionLocation, e.g. the misspelled
+	// field of a field path, best first
+	Suggestions        []string
+	SuggestionLocation position.RawPosition
 }
 
+// Rules identify the check that produced a diagnostic, e.g. for code scanning tools
+const (
+	RuleTypeHint           = "type-hint"            // the type hint of a block was loaded
+	RuleUnknownFunctionSet = "unknown-function-set" // a gotmpls:funcs directive names an unknown function set
+	RuleUnknownField       = "unknown-field"        // a field or method does not exist on the type
+	RuleInvalidRange       = "invalid-range"        // a range pipeline can not be iterated over
+	RuleUndefinedVariable  = "undefined-variable"   // a $variable is used or assigned before it is declared
+	RuleInvalidCall        = "invalid-call"         // a value is called that can not be called from a template
+	RuleInvalidArgument    = "invalid-argument"     // the number or types of the arguments do not match
+	RuleUnknownFunction    = "unknown-function"     // a function is not a builtin or in an enabled FuncMap
+	RuleUndefinedTemplate  = "undefined-template"   // a {{ template }} call names a template that is not defined
+	RuleDuplicateTemplate  = "duplicate-template"   // a template is defined by more than one file of a package
+	RuleAmbiguousPackage   = "ambiguous-package"    // the package of a type hint is a name that matches more than one package
+)
+
 // Severity levels for diagnostics using bit flags
 const (
 	SeverityError       = 1
@@ -27,50 +52,194 @@ const (
 // Example usage:
 // Severity: SeverityInformation | SeverityHint  // Combines both severities
 
-// GetDiagnosticsFromParsed returns diagnostic information for a parsed template
+// GetDiagnosticsFromParsed returns diagnostic information for a template parsed with
+// parser.ParseWithRegistry, so that the blocks without a gotype comment are checked against the go code.
 func GetDiagnosticsFromParsed(ctx context.Context, nodes *parser.ParsedTemplateFile, registry *ast.Registry) ([]*Diagnostic, error) {
-
 	var diagnostics []*Diagnostic
+
+	// the builtins, the enabled function sets and the functions declared in the package's FuncMaps
+	methods := registry.TemplateMethods(nodes.Filename, nodes.FunctionSets()...)
+
 	for _, block := range nodes.Blocks {
-		if block.TypeHint == nil {
-			continue
-		} else {
-			// green happy underline for successful load
-			diagnostics = append(diagnostics, &Diagnostic{
-				Message:  "type hint successfully loaded: " + block.TypeHint.TypePath,
-				Location: block.TypeHint.Position,
-				Severity: SeverityInformation,
-			})
+		for _, set := range block.FunctionSets {
+			if _, ok := ast.FunctionSets[set.Name]; !ok {
+				diagnostics = append(diagnostics, &Diagnostic{
+					Message:  fmt.Sprintf("unknown function set %q, expected one of: %s", set.Name, strings.Join(ast.FunctionSetNames(), ", ")),
+					Location: set.Position,
+					Severity: SeverityError,
+					Rule:     RuleUnknownFunctionSet,
+				})
+			}
 		}
+	}
+
+	// the templates the file can call, and those that call it
+	set := newTemplateSet(ctx, nodes, registry)
+	diagnostics = append(diagnostics, set.checkTemplateCalls(ctx, nodes)...)
+
+	for i := range nodes.Blocks {
+		block := &nodes.Blocks[i]
+
+		// the type `.` is bound to at the root of the block
+		var root types.Type
+		var typeInfo *ast.TypeHintDefinition
+
+		if block.TypeHint != nil {
+			// Get type information
+			var err error
+			typeInfo, err = ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+			if err != nil {
+				var ambiguous *ast.AmbiguousPackageError
+				if errors.As(err, &ambiguous) {
+					diagnostics = append(diagnostics, &Diagnostic{
+						Message:  ambiguous.Error(),
+						Location: block.TypeHint.Position,
+						Severity: SeverityError,
+						Rule:     RuleAmbiguousPackage,
+					})
+					continue
+				}
+				return nil, errors.Errorf("validating type: %w", err)
+			}
+
+			if block.TypeHint.Origin == "" {
+				// green happy underline for successful load
+				diagnostics = append(diagnostics, &Diagnostic{
+					Message:  "type hint successfully loaded: " + block.TypeHint.TypePath,
+					Location: block.TypeHint.Position,
+					Severity: SeverityInformation,
+					Rule:     RuleTypeHint,
+				})
+			}
 
-		// Get type information
-		typeInfo, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
-		if err != nil {
-			return nil, errors.Errorf("validating type: %w", err)
+			root = typeInfo.Type
+		} else {
+			// a block without a hint is checked against the type it is called with, if it is known
+			def := set.definition(block)
+			if def == nil {
+				continue
+			}
+			typeInfo = set.dot(ctx, def)
+			if typeInfo == nil {
+				continue
+			}
+			root = typeInfo.Type
 		}
 
 		for _, variable := range block.Variables {
+			variableTypeInfo, err := variable.DotTypeHintDefinition(ctx, typeInfo, methods)
+			if err != nil || variableTypeInfo == nil {
+				// errors in a range or with pipeline are reported on the pipeline itself
+				continue
+			}
 
 			// Validate field access
-			_, err = ast.GenerateFieldInfoFromPosition(ctx, typeInfo, variable.Position)
+			_, err = ast.GenerateFieldInfoFromPosition(ctx, variableTypeInfo, variable.Position)
 			if err != nil {
+				diagnostics = append(diagnostics, unknownField(err, variable.Position, variable.Position))
+			}
+		}
+
+		// Validate that range pipelines can be iterated over
+		for _, scope := range block.Scopes {
+			if scope.Keyword != "range" || scope.Value == nil {
+				continue
+			}
+
+			// unresolved fields in the pipeline are already reported on their own
+			pipeType, err := scope.Value.ResolveType(ctx, root, methods)
+			if err != nil || pipeType == nil {
+				continue
+			}
+
+			if _, err := ast.RangeElementType(pipeType); err != nil {
+				diagnostics = append(diagnostics, &Diagnostic{
+					Message:  err.Error(),
+					Location: scope.Value.Position,
+					Severity: SeverityError,
+					Rule:     RuleInvalidRange,
+				})
+			}
+		}
+
+		// Validate range declarations with an index or key variable
+		for _, variable := range block.VariableDeclarations {
+			if variable.Range != parser.RangeKey {
+				continue
+			}
+
+			pipeType, err := variable.Value.ResolveType(ctx, root, methods)
+			if err != nil || pipeType == nil {
+				continue
+			}
+
+			if _, err := ast.RangeKeyType(pipeType); err != nil {
 				diagnostics = append(diagnostics, &Diagnostic{
 					Message:  err.Error(),
 					Location: variable.Position,
 					Severity: SeverityError,
+					Rule:     RuleInvalidRange,
+				})
+			}
+		}
+
+		// Validate variable references
+		for _, ref := range block.VariableReferences {
+			if ref.IsUndefined() {
+				message := "undefined variable " + ref.Name()
+				if ref.Assign {
+					message = "assignment to undeclared variable " + ref.Name()
+				}
+				diagnostics = append(diagnostics, &Diagnostic{
+					Message:  message,
+					Location: ref.Position,
+					Severity: SeverityError,
+					Rule:     RuleUndefinedVariable,
 				})
+				continue
+			}
+
+			if ref.FieldPath() == "" {
+				continue
+			}
+
+			// errors in the variable's own pipeline are reported on the pipeline itself
+			varType, err := ref.VariableType(ctx, root, methods)
+			if err != nil || varType == nil {
+				continue
+			}
+
+			varTypeInfo, err := ast.GenerateTypeHintDefinitionFromType(ctx, varType, ref.VariableAddressable(ctx, typeInfo, methods))
+			if err != nil {
+				return nil, errors.Errorf("generating type definition for %s: %w", ref.Name(), err)
+			}
+
+			path := position.NewBasicPosition(ref.FieldPath(), ref.Position.Offset+len(ref.Name()))
+			_, err = ast.GenerateFieldInfoFromPosition(ctx, varTypeInfo, path)
+			if err != nil {
+				diagnostics = append(diagnostics, unknownField(err, ref.Position, path))
 			}
 		}
 
+		// Validate the arguments and results of every command in a pipeline
+		checker := &pipelineChecker{root: root, methods: methods}
+		for _, pipeline := range block.Pipelines() {
+			checker.checkPipeline(ctx, pipeline)
+		}
+		diagnostics = append(diagnostics, checker.diagnostics...)
+
 		// Validate function calls
 		for _, functionCall := range block.Functions {
-			_, err := ast.GenerateFunctionCallInfoFromPosition(ctx, functionCall.Position)
+			_, err := ast.GenerateFunctionCallInfoFromMethods(ctx, methods, functionCall.Position)
 			if err != nil {
-				diagnostics = append(diagnostics, &Diagnostic{
+				diagnostic := &Diagnostic{
 					Message:  err.Error(),
 					Location: functionCall.Position,
 					Severity: SeverityError,
-				})
+					Rule:     RuleUnknownFunction,
+				}
+				diagnostic.suggest(functionCall.Position, slices.Collect(maps.Keys(methods)))
+				diagnostics = append(diagnostics, diagnostic)
 			}
 		}
 	}
@@ -82,7 +251,7 @@ func GetDiagnosticsFromParsed(ctx context.Context, nodes *parser.ParsedTemplateF
 // GetDiagnostics returns diagnostic information for a template
 func GetDiagnostics(ctx context.Context, template string, registry *ast.Registry) ([]*Diagnostic, error) {
 	// Parse the template
-	nodes, err := parser.Parse(ctx, "template.tmpl", []byte(template))
+	nodes, err := parser.ParseWithRegistry(ctx, "template.tmpl", []byte(template), registry)
 	if err != nil {
 		return nil, errors.Errorf("parsing template: %w", err)
 	}
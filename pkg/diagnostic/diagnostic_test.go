@@ -3,6 +3,7 @@ package diagnostic_test
 import (
 	"context"
 	"go/types"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/walteh/gotmpls/pkg/ast"
 	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"github.com/walteh/gotmpls/pkg/parser"
 	"github.com/walteh/gotmpls/pkg/position"
 )
 
@@ -28,6 +30,7 @@ func TestDiagnosticProvider_GetDiagnostics(t *testing.T) {
 					Message:  "type hint successfully loaded: github.com/example/types.Person",
 					Location: position.NewBasicPosition("github.com/example/types.Person", 11),
 					Severity: diagnostic.SeverityInformation,
+					Rule:     diagnostic.RuleTypeHint,
 				},
 			},
 			wantErr: false,
@@ -40,11 +43,13 @@ func TestDiagnosticProvider_GetDiagnostics(t *testing.T) {
 					Message:  "field not found [ NonExistent ] in type [ Person ]",
 					Location: position.NewBasicPosition(".NonExistent", 54),
 					Severity: diagnostic.SeverityError,
+					Rule:     diagnostic.RuleUnknownField,
 				},
 				{
 					Message:  "type hint successfully loaded: github.com/example/types.Person",
 					Location: position.NewBasicPosition("github.com/example/types.Person", 11),
 					Severity: diagnostic.SeverityInformation,
+					Rule:     diagnostic.RuleTypeHint,
 				},
 			},
 			wantErr: false,
@@ -88,3 +93,1039 @@ func TestDiagnosticProvider_GetDiagnostics(t *testing.T) {
 		})
 	}
 }
+
+func TestGetDiagnosticsRangeAndWith(t *testing.T) {
+	const hint = "{{/*gotype: github.com/example/types.Invoice*/}}"
+
+	tests := []struct {
+		name     string
+		template string
+		want     []*diagnostic.Diagnostic
+	}{
+		{
+			name:     "range over slice checks element fields",
+			template: hint + "{{ range .Items }}{{ .Title }}{{ .Total }}{{ end }}",
+			want: []*diagnostic.Diagnostic{
+				{
+					Message:  "field not found [ Total ] in type [ LineItem ]",
+					Location: position.NewBasicPosition(".Total", 80),
+					Severity: diagnostic.SeverityError,
+					Rule:     diagnostic.RuleUnknownField,
+				},
+			},
+		},
+		{
+			name:     "range over map checks value fields",
+			template: hint + "{{ range .ByCode }}{{ .Title }}{{ end }}",
+			want:     []*diagnostic.Diagnostic{},
+		},
+		{
+			name:     "else branch keeps the outer type",
+			template: hint + "{{ range .Items }}{{ .Title }}{{ else }}{{ .Number }}{{ end }}",
+			want:     []*diagnostic.Diagnostic{},
+		},
+		{
+			name:     "with rebinds to the pipeline type",
+			template: hint + "{{ with .Customer }}{{ .Email }}{{ .Number }}{{ end }}",
+			want: []*diagnostic.Diagnostic{
+				{
+					Message:  "field not found [ Number ] in type [ Customer ]",
+					Location: position.NewBasicPosition(".Number", 82),
+					Severity: diagnostic.SeverityError,
+					Rule:     diagnostic.RuleUnknownField,
+				},
+			},
+		},
+		{
+			name:     "nested range inside with",
+			template: hint + "{{ with .Customer }}{{ range .Orders }}{{ .Title }}{{ end }}{{ end }}",
+			want:     []*diagnostic.Diagnostic{},
+		},
+		{
+			name:     "range over non iterable",
+			template: hint + "{{ range .Number }}{{ .Title }}{{ end }}",
+			want: []*diagnostic.Diagnostic{
+				{
+					Message:  "range can't iterate over string",
+					Location: position.NewBasicPosition(".Number", 56),
+					Severity: diagnostic.SeverityError,
+					Rule:     diagnostic.RuleInvalidRange,
+				},
+			},
+		},
+		{
+			name:     "unknown pipeline type is not checked",
+			template: hint + "{{ range slice .Items 1 }}{{ .Anything }}{{ end }}",
+			want:     []*diagnostic.Diagnostic{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+			lineItem := pkgd.AddStruct("LineItem", map[string]types.Type{
+				"Title": types.Typ[types.String],
+			})
+			customer := pkgd.AddStruct("Customer", map[string]types.Type{
+				"Email":  types.Typ[types.String],
+				"Orders": types.NewSlice(lineItem),
+			})
+			pkgd.AddStruct("Invoice", map[string]types.Type{
+				"Number":   types.Typ[types.String],
+				"Items":    types.NewSlice(lineItem),
+				"ByCode":   types.NewMap(types.Typ[types.String], lineItem),
+				"Customer": types.NewPointer(customer),
+			})
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			// ignore the "type hint successfully loaded" diagnostic
+			errs := []*diagnostic.Diagnostic{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					errs = append(errs, d)
+				}
+			}
+
+			assert.ElementsMatch(t, tt.want, errs)
+		})
+	}
+}
+
+func TestGetDiagnosticsVariables(t *testing.T) {
+	const hint = "{{/*gotype: github.com/example/types.Invoice*/}}"
+
+	tests := []struct {
+		name     string
+		template string
+		// the diagnostics are described as "<text>: <message>"
+		want []string
+	}{
+		{
+			name:     "variable from field",
+			template: hint + "{{ $c := .Customer }}{{ $c.Email }}{{ $c.Nope }}",
+			want:     []string{"$c.Nope: field not found [ Nope ] in type [ Customer ]"},
+		},
+		{
+			name:     "range key and value",
+			template: hint + "{{ range $i, $item := .Items }}{{ $item.Title }}{{ $item.Price }}{{ end }}",
+			want:     []string{"$item.Price: field not found [ Price ] in type [ LineItem ]"},
+		},
+		{
+			name:     "single range variable is the element",
+			template: hint + "{{ range $item := .Items }}{{ $item.Title }}{{ end }}",
+			want:     []string{},
+		},
+		{
+			name:     "variable from another variable",
+			template: hint + "{{ $c := .Customer }}{{ $orders := $c.Orders }}{{ range $orders }}{{ .Title }}{{ end }}",
+			want:     []string{},
+		},
+		{
+			name:     "root variable inside range",
+			template: hint + "{{ range .Items }}{{ $.Number }}{{ $.Title }}{{ end }}",
+			want:     []string{"$.Title: field not found [ Title ] in type [ Invoice ]"},
+		},
+		{
+			name:     "variable out of scope",
+			template: hint + "{{ with $c := .Customer }}{{ $c.Email }}{{ end }}{{ $c.Email }}",
+			want:     []string{"$c.Email: undefined variable $c"},
+		},
+		{
+			name:     "undefined variable",
+			template: hint + "{{ $nope }}",
+			want:     []string{"$nope: undefined variable $nope"},
+		},
+		{
+			name:     "assignment to undeclared variable",
+			template: hint + "{{ $total = 1 }}",
+			want:     []string{"$total: assignment to undeclared variable $total"},
+		},
+		{
+			name:     "assignment to declared variable",
+			template: hint + "{{ $total := 0 }}{{ range .Items }}{{ $total = 1 }}{{ end }}",
+			want:     []string{},
+		},
+		{
+			name:     "range over map with key",
+			template: hint + "{{ range $code, $item := .ByCode }}{{ $code.Title }}{{ end }}",
+			want:     []string{"$code.Title: field not found [ Title ] in type [ string ]"},
+		},
+		{
+			name:     "two variables over a channel",
+			template: hint + "{{ range $i, $item := .Queue }}{{ end }}",
+			want:     []string{"$i: range over chan LineItem permits only one iteration variable"},
+		},
+		{
+			name:     "variable from function result is not checked",
+			template: hint + "{{ $first := index .Items 0 }}{{ $first.Anything }}",
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+			lineItem := pkgd.AddStruct("LineItem", map[string]types.Type{
+				"Title": types.Typ[types.String],
+			})
+			customer := pkgd.AddStruct("Customer", map[string]types.Type{
+				"Email":  types.Typ[types.String],
+				"Orders": types.NewSlice(lineItem),
+			})
+			pkgd.AddStruct("Invoice", map[string]types.Type{
+				"Number":   types.Typ[types.String],
+				"Items":    types.NewSlice(lineItem),
+				"ByCode":   types.NewMap(types.Typ[types.String], lineItem),
+				"Queue":    types.NewChan(types.SendRecv, lineItem),
+				"Customer": types.NewPointer(customer),
+			})
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			errs := []string{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					errs = append(errs, d.Location.Text+": "+d.Message)
+				}
+			}
+
+			assert.ElementsMatch(t, tt.want, errs)
+		})
+	}
+}
+
+func TestGetDiagnosticsPipelines(t *testing.T) {
+	const hint = "{{/*gotype: github.com/example/types.Person*/}}"
+
+	tests := []struct {
+		name     string
+		template string
+		// the diagnostics are described as "<text>: <message>"
+		want []string
+	}{
+		{
+			name:     "piped value matches parameter",
+			template: hint + "{{ .Name | upper }}",
+			want:     []string{},
+		},
+		{
+			name:     "piped value does not match parameter",
+			template: hint + "{{ .Age | upper }}",
+			want:     []string{".Age: cannot use int as string argument to upper"},
+		},
+		{
+			name:     "piped value through several commands",
+			template: hint + "{{ .Name | printf \"%s!\" | upper | len }}",
+			want:     []string{},
+		},
+		{
+			name:     "argument does not match parameter",
+			template: hint + "{{ replace .Name .Age \"x\" }}",
+			want:     []string{".Age: cannot use int as string argument to replace"},
+		},
+		{
+			name:     "constant does not match parameter",
+			template: hint + "{{ upper 3 }}",
+			want:     []string{"3: cannot use untyped int as string argument to upper"},
+		},
+		{
+			name:     "too few arguments",
+			template: hint + "{{ replace .Name \"a\" }}",
+			want:     []string{"replace: wrong number of args for replace: want 3 got 2"},
+		},
+		{
+			name:     "too many arguments with piped value",
+			template: hint + "{{ .Name | upper .Name }}",
+			want:     []string{"upper: wrong number of args for upper: want 1 got 2"},
+		},
+		{
+			name:     "variadic function",
+			template: hint + "{{ printf \"%s %d\" .Name .Age }}{{ printf }}",
+			want:     []string{"printf: wrong number of args for printf: want at least 1 got 0"},
+		},
+		{
+			name:     "variadic method argument type",
+			template: hint + "{{ .Join \",\" }}{{ .Join \",\" .Name .Name }}{{ .Age | .Join \",\" .Name }}",
+			want:     []string{".Age: cannot use int as string argument to Join"},
+		},
+		{
+			name:     "parenthesized pipeline",
+			template: hint + "{{ upper (len .Name) }}",
+			want:     []string{"len .Name: cannot use int as string argument to upper"},
+		},
+		{
+			name:     "method with arguments",
+			template: hint + "{{ .Fmt \"x\" 3 }}{{ .Fmt 3 \"x\" }}",
+			want: []string{
+				"3: cannot use untyped int as string argument to Fmt",
+				"\"x\": cannot use untyped string as int argument to Fmt",
+			},
+		},
+		{
+			name:     "method result is piped",
+			template: hint + "{{ .Fmt \"x\" 3 | len }}{{ .Fmt \"x\" 3 | not | upper }}",
+			want:     []string{"not: cannot use bool as string argument to upper"},
+		},
+		{
+			name:     "method with error result",
+			template: hint + "{{ .Lookup \"x\" | upper }}{{ .Lookup 1 }}",
+			want:     []string{"1: cannot use untyped int as string argument to Lookup"},
+		},
+		{
+			name:     "method with invalid results",
+			template: hint + "{{ .Pair }}",
+			want:     []string{".Pair: can't call method/function \"Pair\" with 2 results"},
+		},
+		{
+			name:     "field with arguments",
+			template: hint + "{{ .Name \"x\" }}",
+			want:     []string{".Name: Name is not a method but has arguments"},
+		},
+		{
+			name:     "variable with arguments",
+			template: hint + "{{ $n := .Name }}{{ $n \"x\" }}{{ $n | upper }}",
+			want:     []string{"$n: can't give argument to non-function $n"},
+		},
+		{
+			name:     "funcmap function",
+			template: hint + "{{ .Name | shout }}{{ .Age | shout }}{{ nope }}",
+			want: []string{
+				".Age: cannot use int as string argument to shout",
+				"nope: method nope not found",
+			},
+		},
+		{
+			name:     "values of type any are not checked",
+			template: hint + "{{ index .Tags 0 | upper }}",
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+			person := pkgd.AddStruct("Person", map[string]types.Type{
+				"Name": types.Typ[types.String],
+				"Age":  types.Typ[types.Int],
+				"Tags": types.NewSlice(types.Typ[types.String]),
+			})
+
+			pkg := person.Obj().Pkg()
+			recv := types.NewVar(0, pkg, "p", person)
+			method := func(name string, params, results []types.Type, variadic bool) {
+				vars := func(typs []types.Type) *types.Tuple {
+					out := make([]*types.Var, len(typs))
+					for i, typ := range typs {
+						out[i] = types.NewVar(0, pkg, "", typ)
+					}
+					return types.NewTuple(out...)
+				}
+				sig := types.NewSignatureType(recv, nil, nil, vars(params), vars(results), variadic)
+				person.AddMethod(types.NewFunc(0, pkg, name, sig))
+			}
+
+			str, num := types.Typ[types.String], types.Typ[types.Int]
+			method("Fmt", []types.Type{str, num}, []types.Type{str}, false)
+			method("Join", []types.Type{str, types.NewSlice(str)}, []types.Type{str}, true)
+			method("Lookup", []types.Type{str}, []types.Type{str, types.Universe.Lookup("error").Type()}, false)
+			method("Pair", nil, []types.Type{str, num}, false)
+
+			pkgd.AddFunction("shout", types.NewSignatureType(nil, nil, nil,
+				types.NewTuple(types.NewVar(0, pkg, "s", str)),
+				types.NewTuple(types.NewVar(0, pkg, "", str)), false))
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			errs := []string{}
+			for _, d := range got {
+				assert.NotEmpty(t, d.Rule, "every diagnostic should have a rule")
+				if d.Severity == diagnostic.SeverityError {
+					errs = append(errs, d.Location.Text+": "+d.Message)
+				}
+			}
+
+			assert.ElementsMatch(t, tt.want, errs)
+		})
+	}
+}
+
+func TestGetDiagnosticsFunctionSets(t *testing.T) {
+	const hint = "{{/*gotype: github.com/example/types.Person*/}}"
+
+	tests := []struct {
+		name     string
+		template string
+		sets     []string // the function sets enabled for the workspace
+		// the diagnostics are described as "<text>: <message>"
+		want []string
+	}{
+		{
+			name:     "sprig functions are unknown by default",
+			template: hint + "{{ default \"x\" .Name }}",
+			want:     []string{"default: method default not found"},
+		},
+		{
+			name:     "sprig enabled by directive",
+			template: "{{/* gotmpls:funcs sprig */}}" + hint + "{{ default \"x\" .Name }}{{ dict \"a\" 1 | toYaml }}{{ list 1 2 | join \",\" }}",
+			want:     []string{},
+		},
+		{
+			name:     "sprig signatures are checked",
+			template: "{{/* gotmpls:funcs sprig */}}" + hint + "{{ .Age | upper }}{{ .Name | b64enc }}{{ now | date \"2006\" }}{{ trunc \"x\" .Name }}",
+			want: []string{
+				".Age: cannot use int as string argument to upper",
+				"\"x\": cannot use untyped string as int argument to trunc",
+			},
+		},
+		{
+			name:     "sprig results type variables and range values",
+			template: "{{/* gotmpls:funcs sprig */}}" + hint + "{{ $parts := splitList \",\" .Name }}{{ $parts.Len }}{{ range splitList \",\" .Name }}{{ .Len }}{{ end }}",
+			want: []string{
+				"$parts.Len: field not found [ Len ] in type [ []string ]",
+				".Len: field not found [ Len ] in type [ string ]",
+			},
+		},
+		{
+			name:     "sprig enabled by configuration",
+			template: hint + "{{ .Name | trim | title }}",
+			sets:     []string{"sprig"},
+			want:     []string{},
+		},
+		{
+			name:     "helm extends sprig",
+			template: "{{/* gotmpls:funcs helm */}}" + hint + "{{ include \"row\" . | indent 2 }}{{ required \"name\" .Name }}",
+			want:     []string{},
+		},
+		{
+			name:     "unknown function set",
+			template: "{{/* gotmpls:funcs sprig, nope */}}" + hint + "{{ .Name }}",
+			want:     []string{"nope: unknown function set \"nope\", expected one of: helm, sprig"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			registry.FunctionSets = tt.sets
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+			pkgd.AddStruct("Person", map[string]types.Type{
+				"Name": types.Typ[types.String],
+				"Age":  types.Typ[types.Int],
+			})
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			errs := []string{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					errs = append(errs, d.Location.Text+": "+d.Message)
+				}
+			}
+
+			assert.ElementsMatch(t, tt.want, errs)
+		})
+	}
+}
+
+func TestGetDiagnosticsSuggestions(t *testing.T) {
+	const hint = "{{/*gotype: github.com/example/types.Invoice*/}}"
+
+	tests := []struct {
+		name            string
+		template        string
+		wantMessage     string
+		wantSuggestions []string
+		// the last occurrence of the text in the template that the suggestions replace
+		wantReplace string
+	}{
+		{
+			name:            "typo in field",
+			template:        hint + "{{ .Numbr }}",
+			wantMessage:     "field not found [ Numbr ] in type [ Invoice ], did you mean Number?",
+			wantSuggestions: []string{"Number"},
+			wantReplace:     "Numbr",
+		},
+		{
+			name:            "case insensitive match ranks first",
+			template:        hint + "{{ .items }}",
+			wantMessage:     "field not found [ items ] in type [ Invoice ], did you mean Items?",
+			wantSuggestions: []string{"Items", "Item"},
+			wantReplace:     "items",
+		},
+		{
+			name:            "typo in nested field",
+			template:        hint + "{{ .Customer.Emial }}",
+			wantMessage:     "field not found [ Emial ] in type [ Customer ], did you mean Email?",
+			wantSuggestions: []string{"Email"},
+			wantReplace:     "Emial",
+		},
+		{
+			name:            "typo in variable field",
+			template:        hint + "{{ $c := .Customer }}{{ $c.Emai }}",
+			wantMessage:     "field not found [ Emai ] in type [ Customer ], did you mean Email?",
+			wantSuggestions: []string{"Email"},
+			wantReplace:     "Emai",
+		},
+		{
+			name:            "typo in function",
+			template:        hint + "{{ .Number | uper }}",
+			wantMessage:     "method uper not found, did you mean upper?",
+			wantSuggestions: []string{"upper"},
+			wantReplace:     "uper",
+		},
+		{
+			name:        "nothing close enough",
+			template:    hint + "{{ .Completely }}",
+			wantMessage: "field not found [ Completely ] in type [ Invoice ]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+			lineItem := pkgd.AddStruct("LineItem", map[string]types.Type{
+				"Title": types.Typ[types.String],
+			})
+			customer := pkgd.AddStruct("Customer", map[string]types.Type{
+				"Email": types.Typ[types.String],
+			})
+			pkgd.AddStruct("Invoice", map[string]types.Type{
+				"Number":   types.Typ[types.String],
+				"Items":    types.NewSlice(lineItem),
+				"Item":     lineItem,
+				"Customer": customer,
+			})
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			errs := []*diagnostic.Diagnostic{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					errs = append(errs, d)
+				}
+			}
+			require.Len(t, errs, 1)
+
+			assert.Equal(t, tt.wantMessage, errs[0].Message)
+			assert.Equal(t, tt.wantSuggestions, errs[0].Suggestions)
+			if tt.wantReplace != "" {
+				// node positions are one before the offset in the content
+				assert.Equal(t, position.NewBasicPosition(tt.wantReplace, strings.LastIndex(tt.template, tt.wantReplace)-1), errs[0].SuggestionLocation)
+			}
+		})
+	}
+}
+
+func TestGetDiagnosticsTemplateCalls(t *testing.T) {
+	const hint = "{{/*gotype: github.com/example/types.Invoice*/}}"
+
+	tests := []struct {
+		name     string
+		template string
+		// the other templates of the package, by file name
+		files map[string]string
+		// the errors and warnings, described as "<rule> <location text>: <message>"
+		want []string
+	}{
+		{
+			name:     "call with a matching argument",
+			template: hint + `{{ template "row" .Item }}{{ define "row" }}{{/*gotype: github.com/example/types.LineItem*/}}{{ .Title }}{{ end }}`,
+			want:     []string{},
+		},
+		{
+			name:     "call with a pointer to the hinted type",
+			template: hint + `{{ template "row" .First }}{{ define "row" }}{{/*gotype: github.com/example/types.LineItem*/}}{{ .Title }}{{ end }}`,
+			want:     []string{},
+		},
+		{
+			name:     "call with a mismatched argument",
+			template: hint + `{{ template "row" .Customer }}{{ define "row" }}{{/*gotype: github.com/example/types.LineItem*/}}{{ .Title }}{{ end }}`,
+			want:     []string{`invalid-argument .Customer: cannot use Customer as LineItem in call to template "row"`},
+		},
+		{
+			name:     "call to a template of another file",
+			template: hint + `{{ template "row" .Customer }}`,
+			files: map[string]string{
+				"row.tmpl": `{{ define "row" }}{{/*gotype: github.com/example/types.LineItem*/}}{{ .Title }}{{ end }}`,
+			},
+			want: []string{`invalid-argument .Customer: cannot use Customer as LineItem in call to template "row"`},
+		},
+		{
+			name:     "call to the content of another file",
+			template: hint + `{{ template "header.tmpl" . }}`,
+			files: map[string]string{
+				"header.tmpl": `{{ .Number }}`,
+			},
+			want: []string{},
+		},
+		{
+			name:     "undefined template",
+			template: hint + `{{ template "rows" .Item }}{{ define "row" }}{{ end }}`,
+			want:     []string{`undefined-template "rows": template "rows" is not defined, did you mean row?`},
+		},
+		{
+			name:     "duplicate definition",
+			template: hint + `{{ define "row" }}{{ end }}`,
+			files: map[string]string{
+				"other.tmpl": `{{ define "row" }}{{ end }}`,
+			},
+			want: []string{`duplicate-template "row": template "row" is also defined in other.tmpl`},
+		},
+		{
+			name:     "block overridden by a define",
+			template: hint + `{{ block "row" .Item }}{{ end }}`,
+			files: map[string]string{
+				"other.tmpl": `{{ define "row" }}{{ end }}`,
+			},
+			want: []string{},
+		},
+		{
+			name:     "define inferred from its calls",
+			template: hint + `{{ template "row" .Item }}{{ define "row" }}{{ .Title }}{{ .Titel }}{{ end }}`,
+			want:     []string{`unknown-field .Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?`},
+		},
+		{
+			name:     "define inferred from calls in another file",
+			template: `{{ define "row" }}{{ .Titel }}{{ end }}`,
+			files: map[string]string{
+				"invoice.tmpl": hint + `{{ range .Items }}{{ template "row" . }}{{ end }}`,
+			},
+			want: []string{`unknown-field .Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?`},
+		},
+		{
+			name:     "define called with different types is not inferred",
+			template: hint + `{{ template "row" .Item }}{{ template "row" .Customer }}{{ define "row" }}{{ .Titel }}{{ end }}`,
+			want:     []string{},
+		},
+		{
+			name:     "recursive define",
+			template: hint + `{{ template "row" .Item }}{{ define "row" }}{{ .Titel }}{{ template "row" . }}{{ end }}`,
+			want:     []string{`unknown-field .Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+			lineItem := pkgd.AddStruct("LineItem", map[string]types.Type{
+				"Title": types.Typ[types.String],
+			})
+			customer := pkgd.AddStruct("Customer", map[string]types.Type{
+				"Email": types.Typ[types.String],
+			})
+			pkgd.AddStruct("Invoice", map[string]types.Type{
+				"Number":   types.Typ[types.String],
+				"Items":    types.NewSlice(lineItem),
+				"Item":     lineItem,
+				"First":    types.NewPointer(lineItem),
+				"Customer": customer,
+			})
+
+			pkgd.AddTemplateFile("page.tmpl", tt.template)
+			for name, content := range tt.files {
+				pkgd.AddTemplateFile(name, content)
+			}
+
+			nodes, err := parser.Parse(ctx, "page.tmpl", []byte(tt.template))
+			require.NoError(t, err)
+
+			got, err := diagnostic.GetDiagnosticsFromParsed(ctx, nodes, registry)
+			require.NoError(t, err)
+
+			described := []string{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityInformation {
+					continue
+				}
+				described = append(described, d.Rule+" "+d.Location.Text+": "+d.Message)
+			}
+			assert.ElementsMatch(t, tt.want, described)
+		})
+	}
+}
+
+func TestGetDiagnosticsTemplateCallsAcrossPackages(t *testing.T) {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+	pages := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/pages")
+	shared := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/shared")
+
+	template := `{{ template "footer" . }}{{ template "layout.tmpl" . }}{{ template "nav" . }}`
+	pages.AddTemplateFile("/pages/page.tmpl", template)
+	shared.AddTemplateFile("/shared/layout.tmpl", `{{ define "footer" }}{{ end }}`)
+	shared.AddTemplateFile("/shared/nav.tmpl", `{{ define "nav" }}{{ end }}`)
+
+	// only layout.tmpl is parsed into the same template as page.tmpl
+	pages.ExecuteHints = []*ast.ExecuteHint{{
+		Name:  "page.tmpl",
+		Files: map[string]string{"/pages/page.tmpl": "page.tmpl", "/shared/layout.tmpl": "layout.tmpl"},
+	}}
+
+	nodes, err := parser.Parse(ctx, "/pages/page.tmpl", []byte(template))
+	require.NoError(t, err)
+
+	got, err := diagnostic.GetDiagnosticsFromParsed(ctx, nodes, registry)
+	require.NoError(t, err)
+
+	described := []string{}
+	for _, d := range got {
+		if d.Severity == diagnostic.SeverityError {
+			described = append(described, d.Location.Text+": "+d.Message)
+		}
+	}
+	assert.Equal(t, []string{`"nav": template "nav" is not defined`}, described)
+}
+
+func TestGetDiagnosticsTemplateSetsOfExecuteCalls(t *testing.T) {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/pages")
+
+	layout := `<main>{{ template "content" . }}</main>`
+	home := `{{ define "content" }}home{{ end }}`
+	about := `{{ define "content" }}about{{ end }}`
+	pkgd.AddTemplateFile("/templates/layout.tmpl", layout)
+	pkgd.AddTemplateFile("/templates/home.tmpl", home)
+	pkgd.AddTemplateFile("/templates/about.tmpl", about)
+
+	// every page is parsed separately with the shared layout
+	pkgd.ExecuteHints = []*ast.ExecuteHint{
+		{Name: "layout.tmpl", Files: map[string]string{"/templates/layout.tmpl": "layout.tmpl", "/templates/home.tmpl": "home.tmpl"}},
+		{Name: "layout.tmpl", Files: map[string]string{"/templates/layout.tmpl": "layout.tmpl", "/templates/about.tmpl": "about.tmpl"}},
+	}
+
+	for file, content := range map[string]string{"/templates/layout.tmpl": layout, "/templates/home.tmpl": home, "/templates/about.tmpl": about} {
+		nodes, err := parser.ParseWithRegistry(ctx, file, []byte(content), registry)
+		require.NoError(t, err)
+
+		got, err := diagnostic.GetDiagnosticsFromParsed(ctx, nodes, registry)
+		require.NoError(t, err)
+
+		for _, d := range got {
+			assert.NotEqual(t, diagnostic.RuleDuplicateTemplate, d.Rule, "%s: %s", file, d.Message)
+			assert.NotEqual(t, diagnostic.SeverityError, d.Severity, "%s: %s", file, d.Message)
+		}
+	}
+}
+
+func TestGetDiagnosticsImplicitTypeHints(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		hints    []*ast.ExecuteHint
+		bindings []*ast.Binding
+		// the errors, described as "<location text>: <message>"
+		want []string
+	}{
+		{
+			name:     "file executed with a type",
+			template: `{{ .Number }}{{ .Numbr }}`,
+			hints:    []*ast.ExecuteHint{{Name: "page.tmpl", TypePath: "github.com/example/types.Invoice"}},
+			want:     []string{".Numbr: field not found [ Numbr ] in type [ Invoice ], did you mean Number?"},
+		},
+		{
+			name:     "define executed with a type",
+			template: `{{ .Anything }}{{ define "row" }}{{ .Titel }}{{ end }}`,
+			hints:    []*ast.ExecuteHint{{Name: "row", TypePath: "github.com/example/types.LineItem"}},
+			want:     []string{".Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?"},
+		},
+		{
+			name:     "gotype comment wins",
+			template: `{{/*gotype: github.com/example/types.LineItem*/}}{{ .Title }}`,
+			hints:    []*ast.ExecuteHint{{Name: "page.tmpl", TypePath: "github.com/example/types.Invoice"}},
+			want:     []string{},
+		},
+		{
+			name:     "executed with different types",
+			template: `{{ .Number }}{{ .Title }}`,
+			hints: []*ast.ExecuteHint{
+				{Name: "page.tmpl", TypePath: "github.com/example/types.Invoice"},
+				{Name: "page.tmpl", TypePath: "github.com/example/types.LineItem"},
+			},
+			want: []string{},
+		},
+		{
+			name:     "type that is not loaded",
+			template: `{{ .Anything }}`,
+			hints:    []*ast.ExecuteHint{{Name: "page.tmpl", TypePath: "net/http.Request"}},
+			want:     []string{},
+		},
+		{
+			name:     "file bound to a type",
+			template: `{{ .Numbr }}{{ define "row" }}{{ .Anything }}{{ end }}`,
+			bindings: []*ast.Binding{{TypePath: "github.com/example/types.Invoice"}},
+			want:     []string{".Numbr: field not found [ Numbr ] in type [ Invoice ], did you mean Number?"},
+		},
+		{
+			name:     "define bound to a type",
+			template: `{{ .Anything }}{{ define "row" }}{{ .Titel }}{{ end }}`,
+			bindings: []*ast.Binding{{Define: "row", TypePath: "github.com/example/types.LineItem"}},
+			want:     []string{".Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?"},
+		},
+		{
+			name:     "binding wins over execution",
+			template: `{{ .Title }}`,
+			hints:    []*ast.ExecuteHint{{Name: "page.tmpl", TypePath: "github.com/example/types.Invoice"}},
+			bindings: []*ast.Binding{{TypePath: "github.com/example/types.LineItem"}},
+			want:     []string{},
+		},
+		{
+			name:     "gotype comment wins over binding",
+			template: `{{/*gotype: github.com/example/types.LineItem*/}}{{ .Title }}`,
+			bindings: []*ast.Binding{{TypePath: "github.com/example/types.Invoice"}},
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+			pkgd.AddStruct("LineItem", map[string]types.Type{
+				"Title": types.Typ[types.String],
+			})
+			pkgd.AddStruct("Invoice", map[string]types.Type{
+				"Number": types.Typ[types.String],
+			})
+
+			pkgd.AddTemplateFile("/templates/page.tmpl", tt.template)
+			for _, hint := range tt.hints {
+				hint.Files = map[string]string{"/templates/page.tmpl": "page.tmpl"}
+			}
+			pkgd.ExecuteHints = tt.hints
+			for _, binding := range tt.bindings {
+				binding.File = "/templates/page.tmpl"
+			}
+			pkgd.Bindings = tt.bindings
+
+			nodes, err := parser.ParseWithRegistry(ctx, "/templates/page.tmpl", []byte(tt.template), registry)
+			require.NoError(t, err)
+
+			got, err := diagnostic.GetDiagnosticsFromParsed(ctx, nodes, registry)
+			require.NoError(t, err)
+
+			described := []string{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					described = append(described, d.Location.Text+": "+d.Message)
+				}
+			}
+			assert.ElementsMatch(t, tt.want, described)
+		})
+	}
+}
+
+func TestGetDiagnosticsCompositeTypeHints(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		// the errors, described as "<location text>: <message>"
+		want []string
+	}{
+		{
+			name:     "slice at the root",
+			template: `{{/*gotype: []github.com/example/types.LineItem*/}}{{ range . }}{{ .Title }}{{ .Titel }}{{ end }}`,
+			want:     []string{".Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?"},
+		},
+		{
+			name:     "field of a slice",
+			template: `{{/*gotype: []github.com/example/types.LineItem*/}}{{ .Title }}`,
+			want:     []string{".Title: field not found [ Title ] in type [ []LineItem ]"},
+		},
+		{
+			name:     "map of pointers",
+			template: `{{/*gotype: map[string]*github.com/example/types.LineItem*/}}{{ range $k, $v := . }}{{ $v.Titel }}{{ end }}`,
+			want:     []string{"$v.Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?"},
+		},
+		{
+			name:     "generic type",
+			template: `{{/*gotype: github.com/example/types.Page[github.com/example/types.LineItem]*/}}{{ .Title }}{{ range .Items }}{{ .Titel }}{{ end }}`,
+			want:     []string{".Titel: field not found [ Titel ] in type [ LineItem ], did you mean Title?"},
+		},
+		{
+			name:     "unnamed struct",
+			template: `{{/*gotype: struct{ Name string; Items []github.com/example/types.LineItem }*/}}{{ .Name }}{{ .Nme }}`,
+			want:     []string{".Nme: field not found [ Nme ] in type [ struct{Name string; Items []LineItem} ], did you mean Name?"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+			pkg := pkgd.Package.Types
+
+			pkgd.AddStruct("LineItem", map[string]types.Type{
+				"Title": types.Typ[types.String],
+			})
+
+			param := types.NewTypeParam(types.NewTypeName(0, pkg, "T", nil), types.Universe.Lookup("any").Type())
+			page := types.NewNamed(types.NewTypeName(0, pkg, "Page", nil), nil, nil)
+			page.SetTypeParams([]*types.TypeParam{param})
+			page.SetUnderlying(types.NewStruct([]*types.Var{
+				types.NewField(0, pkg, "Title", types.Typ[types.String], false),
+				types.NewField(0, pkg, "Items", types.NewSlice(param), false),
+			}, nil))
+			pkg.Scope().Insert(page.Obj())
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			described := []string{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					described = append(described, d.Location.Text+": "+d.Message)
+				}
+			}
+			assert.ElementsMatch(t, tt.want, described)
+		})
+	}
+}
+
+func TestGetDiagnosticsPointerMethods(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		// the errors, described as "<location text>: <message>"
+		want []string
+	}{
+		{
+			name:     "value data",
+			template: `{{/*gotype: github.com/example/types.Counter*/}}{{ .Inc }}`,
+			want:     []string{".Inc: field not found [ Inc ] in type [ Counter ]"},
+		},
+		{
+			name:     "pointer data",
+			template: `{{/*gotype: *github.com/example/types.Counter*/}}{{ .Inc }}{{ $c := . }}{{ $c.Inc }}`,
+			want:     []string{},
+		},
+		{
+			name:     "range over a slice",
+			template: `{{/*gotype: github.com/example/types.Report*/}}{{ range .List }}{{ .Inc }}{{ end }}{{ range $c := .List }}{{ $c.Inc }}{{ end }}`,
+			want:     []string{},
+		},
+		{
+			name:     "range over a map",
+			template: `{{/*gotype: *github.com/example/types.Report*/}}{{ range .ByID }}{{ .Inc }}{{ end }}{{ range $c := .ByID }}{{ $c.Inc }}{{ end }}`,
+			want: []string{
+				".Inc: field not found [ Inc ] in type [ Counter ]",
+				"$c.Inc: field not found [ Inc ] in type [ Counter ]",
+			},
+		},
+		{
+			name:     "field of a ranged over slice element",
+			template: `{{/*gotype: github.com/example/types.Report*/}}{{ range .Reports }}{{ .Total.Inc }}{{ end }}`,
+			want:     []string{},
+		},
+		{
+			name:     "method result",
+			template: `{{/*gotype: *github.com/example/types.Counter*/}}{{ .Current.Inc }}{{ with .Current }}{{ .Inc }}{{ end }}`,
+			want: []string{
+				".Current.Inc: field not found [ Inc ] in type [ Current ]",
+				".Inc: field not found [ Inc ] in type [ Counter ]",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			registry := ast.NewEmptyRegistry()
+			pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+			pkg := pkgd.Package.Types
+
+			counter := pkgd.AddStruct("Counter", map[string]types.Type{
+				"Count": types.Typ[types.Int],
+			})
+			inc := types.NewSignature(types.NewVar(0, pkg, "c", types.NewPointer(counter)), types.NewTuple(), types.NewTuple(types.NewVar(0, pkg, "", types.Typ[types.Int])), false)
+			counter.AddMethod(types.NewFunc(0, pkg, "Inc", inc))
+			current := types.NewSignature(types.NewVar(0, pkg, "c", counter), types.NewTuple(), types.NewTuple(types.NewVar(0, pkg, "", counter)), false)
+			counter.AddMethod(types.NewFunc(0, pkg, "Current", current))
+
+			total := pkgd.AddStruct("Total", map[string]types.Type{
+				"Total": counter,
+			})
+			pkgd.AddStruct("Report", map[string]types.Type{
+				"List":    types.NewSlice(counter),
+				"ByID":    types.NewMap(types.Typ[types.String], counter),
+				"Reports": types.NewSlice(total),
+			})
+
+			got, err := diagnostic.GetDiagnostics(ctx, tt.template, registry)
+			require.NoError(t, err)
+
+			described := []string{}
+			for _, d := range got {
+				if d.Severity == diagnostic.SeverityError {
+					described = append(described, d.Location.Text+": "+d.Message)
+				}
+			}
+			assert.ElementsMatch(t, tt.want, described)
+		})
+	}
+}
+
+func TestGetDiagnosticsAmbiguousPackage(t *testing.T) {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+	for _, path := range []string{"github.com/example/billing/types", "github.com/example/users/types"} {
+		registry.AddInMemoryPackageForTesting(ctx, path).AddStruct("Person", map[string]types.Type{
+			"Name": types.Typ[types.String],
+		})
+	}
+
+	got, err := diagnostic.GetDiagnostics(ctx, `{{/*gotype: types.Person*/}}{{ .Nme }}`, registry)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, "package name types is ambiguous, it matches github.com/example/billing/types, github.com/example/users/types; use the import path instead", got[0].Message)
+	assert.Equal(t, "types.Person", got[0].Location.Text)
+	assert.Equal(t, diagnostic.RuleAmbiguousPackage, got[0].Rule)
+	assert.Equal(t, diagnostic.SeverityError, got[0].Severity)
+
+	got, err = diagnostic.GetDiagnostics(ctx, `{{/*gotype: github.com/example/users/types.Person*/}}{{ .Nme }}`, registry)
+	require.NoError(t, err)
+	messages := []string{}
+	for _, d := range got {
+		if d.Severity == diagnostic.SeverityError {
+			messages = append(messages, d.Message)
+		}
+	}
+	assert.Equal(t, []string{"field not found [ Nme ] in type [ Person ], did you mean Name?"}, messages)
+}
@@ -0,0 +1,306 @@
+package diagnostic
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"strings"
+
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+// pipelineChecker type checks the commands of a pipeline against the signatures of the functions
+// and methods they call, following the rules of text/template:
+//
+//   - the result of each command is passed as the final argument to the next one
+//   - variadic functions accept any number of trailing arguments
+//   - functions and methods return one result, or two when the second is an error
+//
+// Operands whose type can not be determined statically are not checked.
+type pipelineChecker struct {
+	root        types.Type                         // the type `.` is bound to at the root of the block, nil if unknown
+	methods     map[string]*ast.TemplateMethodInfo // the functions that can be called from the template
+	diagnostics []*Diagnostic
+	results     map[*parser.Command]types.Type // the result of every command, if they are recorded
+}
+
+// CommandTypes returns the type of the result of every command in the pipelines of a block, as
+// they are resolved when type checking the block. Commands whose result can not be determined
+// statically are left out.
+func CommandTypes(ctx context.Context, block *parser.BlockInfo, root types.Type, methods map[string]*ast.TemplateMethodInfo) map[*parser.Command]types.Type {
+	checker := &pipelineChecker{root: root, methods: methods, results: map[*parser.Command]types.Type{}}
+	for _, pipeline := range block.Pipelines() {
+		checker.checkPipeline(ctx, pipeline)
+	}
+	return checker.results
+}
+
+// argument is a value passed to a function or method, with the position it is reported at
+type argument struct {
+	Position position.RawPosition
+	Type     types.Type
+}
+
+// checkPipeline checks every command of the pipeline and returns the type of its result
+func (c *pipelineChecker) checkPipeline(ctx context.Context, pipeline *parser.Pipeline) types.Type {
+	var piped *argument
+	var result types.Type
+
+	for _, cmd := range pipeline.Commands {
+		result = c.checkCommand(ctx, cmd, piped)
+		piped = &argument{Position: cmd.Position, Type: result}
+		if c.results != nil && result != nil {
+			c.results[cmd] = result
+		}
+	}
+
+	return result
+}
+
+// checkCommand checks a single command, with the result of the previous command (if any) as its
+// final argument, and returns the type of its result
+func (c *pipelineChecker) checkCommand(ctx context.Context, cmd *parser.Command, piped *argument) types.Type {
+	args := make([]*argument, 0, len(cmd.Args)+1)
+	for _, arg := range cmd.Args {
+		args = append(args, &argument{Position: arg.Position, Type: c.operandType(ctx, arg)})
+	}
+	if piped != nil {
+		args = append(args, piped)
+	}
+
+	op := cmd.Operand
+
+	switch {
+	case op.Function != "":
+		method, ok := c.methods[op.Function]
+		if !ok {
+			// unknown functions are reported on their own
+			return nil
+		}
+		if !c.checkCall(op.Function, op.Position, method, args) {
+			return nil
+		}
+		return resultType(method)
+	case op.Field != nil && op.Field.Position.Text != ".":
+		dot, err := op.Field.Dot.ResolveType(ctx, c.root, c.methods)
+		if err != nil || dot == nil {
+			return nil
+		}
+		return c.checkMember(ctx, op, dot, op.Field.Position.Text, args)
+	case op.Variable != nil && op.Variable.FieldPath() != "":
+		typ, err := op.Variable.VariableType(ctx, c.root, c.methods)
+		if err != nil || typ == nil {
+			return nil
+		}
+		return c.checkMember(ctx, op, typ, op.Variable.FieldPath(), args)
+	}
+
+	if len(args) > 0 {
+		c.report(op.Position, RuleInvalidCall, "can't give argument to non-function %s", op.Position.Text)
+		return nil
+	}
+
+	return c.operandType(ctx, op)
+}
+
+// checkMember checks the last field or method of a field path like ".Address.Format", which is
+// called with the arguments when it is a method
+func (c *pipelineChecker) checkMember(ctx context.Context, op *parser.Operand, typ types.Type, path string, args []*argument) types.Type {
+	prefix, name := path[:strings.LastIndex(path, ".")], path[strings.LastIndex(path, ".")+1:]
+
+	// errors in the field path are reported on their own
+	recv, err := ast.FieldPathType(ctx, typ, prefix)
+	if err != nil || recv == nil {
+		return nil
+	}
+
+	var pkg *types.Package
+	if named, ok := deref(recv).(*types.Named); ok {
+		pkg = named.Obj().Pkg()
+	}
+
+	switch obj := lookupFieldOrMethod(recv, pkg, name).(type) {
+	case *types.Var:
+		if len(args) > 0 {
+			c.report(op.Position, RuleInvalidCall, "%s is not a method but has arguments", name)
+			return nil
+		}
+		return knownType(obj.Type())
+	case *types.Func:
+		sig, ok := obj.Type().(*types.Signature)
+		if !ok {
+			return nil
+		}
+
+		method, err := ast.GenerateFunctionCallInfoFromSignature(ctx, sig)
+		if err != nil {
+			return nil
+		}
+
+		if !c.checkCall(name, op.Position, method, args) {
+			return nil
+		}
+		return resultType(method)
+	}
+
+	return nil
+}
+
+// checkCall checks the results of a function or method and the number and types of the arguments
+// passed to it. It returns false if the function can not be called from a template at all.
+func (c *pipelineChecker) checkCall(name string, pos position.RawPosition, method *ast.TemplateMethodInfo, args []*argument) bool {
+	if !hasValidResults(method) {
+		c.report(pos, RuleInvalidCall, "can't call method/function %q with %d results", name, len(method.Results))
+		return false
+	}
+
+	params := method.Parameters
+
+	if method.Variadic {
+		if len(args) < len(params)-1 {
+			c.report(pos, RuleInvalidArgument, "wrong number of args for %s: want at least %d got %d", name, len(params)-1, len(args))
+			return true
+		}
+	} else if len(args) != len(params) {
+		c.report(pos, RuleInvalidArgument, "wrong number of args for %s: want %d got %d", name, len(params), len(args))
+		return true
+	}
+
+	for i, arg := range args {
+		param := parameterType(method, i)
+		if !assignable(arg.Type, param) {
+			c.report(arg.Position, RuleInvalidArgument, "cannot use %s as %s argument to %s", ast.TypeDisplayName(arg.Type), ast.TypeDisplayName(param), name)
+		}
+	}
+
+	return true
+}
+
+// operandType returns the type of an operand used as an argument, nil if it can not be determined statically
+func (c *pipelineChecker) operandType(ctx context.Context, op *parser.Operand) types.Type {
+	switch {
+	case op.Function != "":
+		// functions used as arguments are called without arguments
+		method, ok := c.methods[op.Function]
+		if !ok {
+			return nil
+		}
+		if !c.checkCall(op.Function, op.Position, method, nil) {
+			return nil
+		}
+		return resultType(method)
+	case op.Field != nil:
+		dot, err := op.Field.Dot.ResolveType(ctx, c.root, c.methods)
+		if err != nil || dot == nil {
+			return nil
+		}
+		typ, err := ast.FieldPathType(ctx, dot, op.Field.Position.Text)
+		if err != nil {
+			return nil
+		}
+		return knownType(typ)
+	case op.Variable != nil:
+		typ, err := op.Variable.ResolveType(ctx, c.root, c.methods)
+		if err != nil {
+			return nil
+		}
+		return knownType(typ)
+	case op.Pipeline != nil:
+		return c.checkPipeline(ctx, op.Pipeline)
+	}
+
+	return op.Type
+}
+
+func (c *pipelineChecker) report(pos position.RawPosition, rule string, format string, args ...any) {
+	c.diagnostics = append(c.diagnostics, &Diagnostic{
+		Message:  fmt.Sprintf(format, args...),
+		Location: pos,
+		Severity: SeverityError,
+		Rule:     rule,
+	})
+}
+
+// parameterType returns the type of the i-th argument, which is the element type of the last
+// parameter for the trailing arguments of a variadic function
+func parameterType(method *ast.TemplateMethodInfo, i int) types.Type {
+	last := len(method.Parameters) - 1
+	if method.Variadic && i >= last {
+		if slice, ok := method.Parameters[last].(*types.Slice); ok {
+			return slice.Elem()
+		}
+	}
+	return method.Parameters[i]
+}
+
+// resultType returns the type of the first result of a function, nil if it is only known at execution time
+func resultType(method *ast.TemplateMethodInfo) types.Type {
+	if len(method.Results) == 0 {
+		return nil
+	}
+	return knownType(method.Results[0])
+}
+
+// hasValidResults reports whether a function can be called from a template, which requires one
+// result, or two results where the second is an error
+func hasValidResults(method *ast.TemplateMethodInfo) bool {
+	switch len(method.Results) {
+	case 1:
+		return true
+	case 2:
+		return types.Identical(method.Results[1], types.Universe.Lookup("error").Type())
+	}
+	return false
+}
+
+// assignable reports whether a value of type arg can be passed as a parameter of type param.
+// Like text/template, pointers are dereferenced and addressable values are referenced as needed.
+func assignable(arg, param types.Type) bool {
+	if arg == nil || param == nil {
+		return true
+	}
+
+	// the dynamic type of an interface is only known at execution time
+	if types.IsInterface(arg) {
+		return true
+	}
+
+	if types.AssignableTo(arg, param) {
+		return true
+	}
+
+	if ptr, ok := arg.(*types.Pointer); ok && types.AssignableTo(ptr.Elem(), param) {
+		return true
+	}
+
+	if basic, ok := arg.(*types.Basic); ok && basic.Info()&types.IsUntyped != 0 {
+		return false
+	}
+
+	return types.AssignableTo(types.NewPointer(arg), param)
+}
+
+// knownType returns nil for values of type any, which are only known at execution time
+func knownType(typ types.Type) types.Type {
+	if typ == nil {
+		return nil
+	}
+	if iface, ok := typ.Underlying().(*types.Interface); ok && iface.Empty() {
+		return nil
+	}
+	return typ
+}
+
+func lookupFieldOrMethod(typ types.Type, pkg *types.Package, name string) types.Object {
+	obj, _, _ := types.LookupFieldOrMethod(typ, true, pkg, name)
+	return obj
+}
+
+func deref(typ types.Type) types.Type {
+	if ptr, ok := typ.(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return typ
+}
@@ -0,0 +1,119 @@
+package diagnostic
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/position"
+	"gitlab.com/tozd/go/errors"
+)
+
+// maxSuggestions is the number of suggestions offered for an unknown name
+const maxSuggestions = 3
+
+// unknownField reports an error of the field path at path, e.g. a field that does not exist.
+// A missing field is reported with the fields of its type that were likely meant.
+func unknownField(err error, location position.RawPosition, path position.RawPosition) *Diagnostic {
+	diagnostic := &Diagnostic{
+		Message:  err.Error(),
+		Location: location,
+		Severity: SeverityError,
+		Rule:     RuleUnknownField,
+	}
+
+	var notFound *ast.FieldNotFoundError
+	if errors.As(err, &notFound) {
+		field := position.NewBasicPosition(notFound.Field, path.Offset+notFound.Offset)
+		diagnostic.suggest(field, slices.Collect(maps.Keys(notFound.Type.Fields)))
+	}
+
+	return diagnostic
+}
+
+// suggest sets the candidates that were likely meant instead of the text at pos, and mentions
+// the best one in the message
+func (d *Diagnostic) suggest(pos position.RawPosition, candidates []string) {
+	suggestions := rankSuggestions(pos.Text, candidates)
+	if len(suggestions) == 0 {
+		return
+	}
+
+	d.Message = fmt.Sprintf("%s, did you mean %s?", d.Message, suggestions[0])
+	d.SuggestionLocation = pos
+	d.Suggestions = suggestions
+}
+
+// rankSuggestions returns the candidates that are close to name, best first. A candidate that
+// only differs in case ranks first, the others rank by their edit distance to name, and
+// candidates that are too different to be a typo are left out.
+func rankSuggestions(name string, candidates []string) []string {
+	type ranked struct {
+		name     string
+		distance int
+	}
+
+	lower := strings.ToLower(name)
+	maxDistance := max(1, len(name)/3)
+
+	matches := []ranked{}
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		distance := editDistance(lower, strings.ToLower(candidate))
+		if distance > maxDistance {
+			continue
+		}
+		if distance > 0 {
+			// a case insensitive match is better than any typo
+			distance++
+		}
+		matches = append(matches, ranked{name: candidate, distance: distance})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	suggestions := []string{}
+	for _, match := range matches[:min(len(matches), maxSuggestions)] {
+		suggestions = append(suggestions, match.name)
+	}
+	return suggestions
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and transpositions
+// of adjacent characters needed to turn a into b
+func editDistance(a, b string) int {
+	// d[i][j] is the distance between the first i characters of a and the first j of b
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
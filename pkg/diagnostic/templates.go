@@ -0,0 +1,333 @@
+package diagnostic
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"maps"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+// templateSet is the set of templates a template file is executed with: the file itself and the
+// files that the go code parses into the same templates, or else the other templates embedded by its
+// package. Like template.ParseFS and ParseFiles, every define and block of the set can be called by
+// name, and the content of a file by the name it is defined as.
+type templateSet struct {
+	registry    *ast.Registry
+	methods     map[*parser.ParsedTemplateFile]map[string]*ast.TemplateMethodInfo
+	definitions map[string][]*templateDefinition
+	unparsed    map[string]bool            // the names of the files of the set that do not parse
+	calls       map[string][]*templateCall // the calls of every template, by the name they call
+	dots        map[*parser.BlockInfo]*ast.TypeHintDefinition
+	resolving   map[*parser.BlockInfo]bool
+}
+
+// templateDefinition is a named template of the set
+type templateDefinition struct {
+	file     *parser.ParsedTemplateFile
+	block    *parser.BlockInfo
+	fileName string // the name the content of the file is defined as
+}
+
+// templateCall is a {{ template "name" pipeline }} call of the set
+type templateCall struct {
+	caller *templateDefinition
+	call   *parser.TemplateCallLocation
+}
+
+// newTemplateSet collects the named templates and the template calls of a file and of the other
+// files of its set. Files of the set that do not parse are left out.
+func newTemplateSet(ctx context.Context, nodes *parser.ParsedTemplateFile, registry *ast.Registry) *templateSet {
+	set := &templateSet{
+		registry:    registry,
+		methods:     map[*parser.ParsedTemplateFile]map[string]*ast.TemplateMethodInfo{},
+		definitions: map[string][]*templateDefinition{},
+		unparsed:    map[string]bool{},
+		calls:       map[string][]*templateCall{},
+		dots:        map[*parser.BlockInfo]*ast.TypeHintDefinition{},
+		resolving:   map[*parser.BlockInfo]bool{},
+	}
+
+	files := setFiles(nodes.Filename, registry)
+	set.add(nodes, files[nodes.Filename])
+
+	// the other files are added in a stable order, so that diagnostics do not depend on map order
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if name == nodes.Filename {
+			continue
+		}
+		content, _, ok := registry.GetTemplateFile(name)
+		if !ok {
+			set.unparsed[files[name]] = true
+			continue
+		}
+		file, err := parser.ParseWithRegistry(ctx, name, []byte(content), registry)
+		if err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Str("file", name).Msg("skipping template that does not parse")
+			set.unparsed[files[name]] = true
+			continue
+		}
+		set.add(file, files[name])
+	}
+
+	return set
+}
+
+// setFiles returns the files of the set of a template file, with the name their content is defined
+// as: the files parsed together with it by the go code that executes it, or the templates embedded by
+// its package if no execute call of it is known
+func setFiles(file string, registry *ast.Registry) map[string]string {
+	files := map[string]string{}
+	for _, hint := range registry.ExecuteHints(file) {
+		maps.Copy(files, hint.Files)
+	}
+
+	if len(files) == 0 {
+		files[file] = filepath.Base(file)
+		if _, pkg, ok := registry.GetTemplateFile(file); ok {
+			for name := range pkg.TemplateFiles {
+				files[name] = filepath.Base(name)
+			}
+		}
+	}
+
+	return files
+}
+
+func (set *templateSet) add(file *parser.ParsedTemplateFile, fileName string) {
+	set.methods[file] = set.registry.TemplateMethods(file.Filename, file.FunctionSets()...)
+
+	for i := range file.Blocks {
+		def := &templateDefinition{file: file, block: &file.Blocks[i], fileName: fileName}
+		name := def.name()
+		set.definitions[name] = append(set.definitions[name], def)
+
+		for j := range def.block.TemplateCalls {
+			call := &def.block.TemplateCalls[j]
+			set.calls[call.Name] = append(set.calls[call.Name], &templateCall{caller: def, call: call})
+		}
+	}
+}
+
+// name returns the name the template is called by
+func (def *templateDefinition) name() string {
+	if def.block.Keyword() == "" {
+		return def.fileName
+	}
+	return def.block.Name
+}
+
+// definition returns the template a block of the set is defined by
+func (set *templateSet) definition(block *parser.BlockInfo) *templateDefinition {
+	for _, defs := range set.definitions {
+		for _, def := range defs {
+			if def.block == block {
+				return def
+			}
+		}
+	}
+	return nil
+}
+
+// callee returns the template a call executes, nil if the name is not defined or is defined by
+// more than one file and none of them is the file of the call
+func (set *templateSet) callee(call *templateCall) *templateDefinition {
+	defs := set.definitions[call.call.Name]
+	if len(defs) == 1 {
+		return defs[0]
+	}
+	for _, def := range defs {
+		if def.file == call.caller.file {
+			return def
+		}
+	}
+	return nil
+}
+
+// dotType returns the type `.` is bound to at the root of a template, nil if it is unknown
+func (set *templateSet) dotType(ctx context.Context, def *templateDefinition) types.Type {
+	if dot := set.dot(ctx, def); dot != nil {
+		return dot.Type
+	}
+	return nil
+}
+
+// dot returns the type definition of the value `.` is bound to at the root of a template, nil if it is unknown.
+//
+// It is the type of the gotype hint of the template. A template without a hint takes the type of
+// the arguments it is called with, if every call passes an argument of the same known type, and
+// is addressable if every argument is.
+func (set *templateSet) dot(ctx context.Context, def *templateDefinition) *ast.TypeHintDefinition {
+	if dot, ok := set.dots[def.block]; ok {
+		return dot
+	}
+
+	if def.block.TypeHint != nil {
+		typeInfo, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, def.block.TypeHint.TypePath, set.registry)
+		if err != nil {
+			typeInfo = nil
+		}
+		set.dots[def.block] = typeInfo
+		return typeInfo
+	}
+
+	// recursive templates are inferred from their other calls only
+	if set.resolving[def.block] {
+		return nil
+	}
+	set.resolving[def.block] = true
+	defer delete(set.resolving, def.block)
+
+	var inferred types.Type
+	addressable := true
+	for _, call := range set.calls[def.name()] {
+		if set.callee(call) != def || call.caller == def {
+			continue
+		}
+		typ := set.argumentType(ctx, call)
+		if typ == nil {
+			inferred = nil
+			break
+		}
+		if inferred != nil && !types.Identical(inferred, typ) {
+			inferred = nil
+			break
+		}
+		inferred = typ
+		addressable = addressable && set.argumentAddressable(ctx, call)
+	}
+
+	var dot *ast.TypeHintDefinition
+	if inferred != nil {
+		typeInfo, err := ast.GenerateTypeHintDefinitionFromType(ctx, inferred, addressable)
+		if err == nil {
+			dot = typeInfo
+		}
+	}
+
+	set.dots[def.block] = dot
+	return dot
+}
+
+// argumentType returns the type of the value a call passes to a template, nil if it is unknown
+func (set *templateSet) argumentType(ctx context.Context, call *templateCall) types.Type {
+	if call.call.Pipeline == nil {
+		return nil
+	}
+	checker := &pipelineChecker{root: set.dotType(ctx, call.caller), methods: set.methods[call.caller.file]}
+	return knownType(checker.checkPipeline(ctx, call.call.Pipeline))
+}
+
+// argumentAddressable reports whether the value a call passes to a template is addressable, which
+// is only known for a field or variable that is passed as is
+func (set *templateSet) argumentAddressable(ctx context.Context, call *templateCall) bool {
+	if call.call.Pipeline == nil || len(call.call.Pipeline.Commands) != 1 || len(call.call.Pipeline.Commands[0].Args) > 0 {
+		return false
+	}
+
+	caller := set.dot(ctx, call.caller)
+	if caller == nil {
+		return false
+	}
+
+	op := call.call.Pipeline.Commands[0].Operand
+	value := &parser.PipelineValue{Field: op.Field, Variable: op.Variable}
+	return value.Addressable(ctx, caller, set.methods[call.caller.file])
+}
+
+// checkTemplateCalls reports the template calls of a file to undefined templates or with an
+// argument that does not match the gotype hint of the template, and the templates of the file
+// that are also defined by another file of the set
+func (set *templateSet) checkTemplateCalls(ctx context.Context, file *parser.ParsedTemplateFile) []*Diagnostic {
+	var diagnostics []*Diagnostic
+
+	for i := range file.Blocks {
+		def := set.definition(&file.Blocks[i])
+		if def == nil {
+			continue
+		}
+
+		for j := range def.block.TemplateCalls {
+			call := &templateCall{caller: def, call: &def.block.TemplateCalls[j]}
+
+			if len(set.definitions[call.call.Name]) == 0 {
+				if set.unparsed[call.call.Name] {
+					continue
+				}
+				diagnostic := &Diagnostic{
+					Message:  fmt.Sprintf("template %q is not defined", call.call.Name),
+					Location: call.call.Position,
+					Severity: SeverityError,
+					Rule:     RuleUndefinedTemplate,
+				}
+				// the suggestion replaces the name inside of the quotes
+				if len(call.call.Position.Text) == len(call.call.Name)+2 {
+					name := position.NewBasicPosition(call.call.Name, call.call.Position.Offset+1)
+					diagnostic.suggest(name, slices.Collect(maps.Keys(set.definitions)))
+				}
+				diagnostics = append(diagnostics, diagnostic)
+				continue
+			}
+
+			callee := set.callee(call)
+			if callee == nil || callee.block.TypeHint == nil || call.call.Pipeline == nil {
+				continue
+			}
+
+			param := set.dotType(ctx, callee)
+			arg := set.argumentType(ctx, call)
+			if param == nil || arg == nil || assignable(arg, param) {
+				continue
+			}
+
+			diagnostics = append(diagnostics, &Diagnostic{
+				Message:  fmt.Sprintf("cannot use %s as %s in call to template %q", ast.TypeDisplayName(arg), ast.TypeDisplayName(param), call.call.Name),
+				Location: call.call.Pipeline.Position,
+				Severity: SeverityError,
+				Rule:     RuleInvalidArgument,
+			})
+		}
+
+		diagnostics = append(diagnostics, set.checkDuplicate(def)...)
+	}
+
+	return diagnostics
+}
+
+// checkDuplicate reports a named template that is also defined by another file of the set, in
+// which case the template that is parsed last silently replaces the other. A block that is
+// redefined by a define is the intended way of overriding it and is not reported.
+func (set *templateSet) checkDuplicate(def *templateDefinition) []*Diagnostic {
+	if def.block.Keyword() == "" {
+		return nil
+	}
+
+	others := []string{}
+	for _, other := range set.definitions[def.name()] {
+		if other.file == def.file {
+			continue
+		}
+		if (def.block.Keyword() == "block") != (other.block.Keyword() == "block") {
+			continue
+		}
+		others = append(others, filepath.Base(other.file.Filename))
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	sort.Strings(others)
+
+	return []*Diagnostic{{
+		Message:  fmt.Sprintf("template %q is also defined in %s", def.name(), others[0]),
+		Location: def.block.NamePosition(),
+		Severity: SeverityWarning,
+		Rule:     RuleDuplicateTemplate,
+	}}
+}
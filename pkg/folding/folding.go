@@ -0,0 +1,164 @@
+// Package folding provides the foldable regions of a go template.
+package folding
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Kinds of folding ranges
+const (
+	KindRegion  = "region"
+	KindComment = "comment"
+)
+
+// FoldingRange is a range of zero-based lines that can be folded
+type FoldingRange struct {
+	StartLine int
+	EndLine   int
+	Kind      string
+}
+
+// GetFoldingRanges returns the foldable regions of a template.
+//
+// Every define, block, if, range and with folds up to the line before its {{ end }}, and every
+// else branch is a separate region that folds up to the next else or the end. Comments fold
+// when they span multiple lines.
+func GetFoldingRanges(ctx context.Context, info *parser.ParsedTemplateFile) ([]FoldingRange, error) {
+	content := info.SourceContent
+
+	trees, err := parser.ParseTree(info.Filename, []byte(content))
+	if err != nil {
+		return nil, errors.Errorf("parsing template: %w", err)
+	}
+
+	f := &folder{content: content, ranges: []FoldingRange{}}
+
+	for _, block := range info.Blocks {
+		tree, ok := trees[block.Name]
+		if !ok || tree.Root == nil {
+			continue
+		}
+
+		if tree.CanRelyOnKeyword() {
+			end := strings.LastIndex(content[:block.EndPosition.Offset], "{{")
+			f.add(block.StartPosition.Offset, end, KindRegion)
+		}
+
+		f.list(tree.Root)
+	}
+
+	sort.SliceStable(f.ranges, func(i, j int) bool {
+		return f.ranges[i].StartLine < f.ranges[j].StartLine
+	})
+
+	zerolog.Ctx(ctx).Trace().Int("ranges", len(f.ranges)).Str("file", info.Filename).Msg("built folding ranges")
+
+	return f.ranges, nil
+}
+
+type folder struct {
+	content string
+	ranges  []FoldingRange
+}
+
+// add adds a region from the line of start to the line before the line of next, the offset of
+// the action that ends the region
+func (f *folder) add(start, next int, kind string) {
+	startLine := f.line(start)
+	endLine := f.line(next) - 1
+	if endLine > startLine {
+		f.ranges = append(f.ranges, FoldingRange{StartLine: startLine, EndLine: endLine, Kind: kind})
+	}
+}
+
+func (f *folder) line(offset int) int {
+	return position.OffsetToPlace(f.content, offset).Line
+}
+
+// actionStart returns the offset of the left delimiter of the action that contains offset
+func (f *folder) actionStart(offset int) int {
+	return strings.LastIndex(f.content[:offset], "{{")
+}
+
+func (f *folder) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			f.branch(&n.BranchNode)
+		case *parse.RangeNode:
+			f.branch(&n.BranchNode)
+		case *parse.WithNode:
+			f.branch(&n.BranchNode)
+		case *parse.CommentNode:
+			start := int(n.Pos)
+			end := start + len(n.Text)
+			if f.line(end) > f.line(start) {
+				f.ranges = append(f.ranges, FoldingRange{StartLine: f.line(start), EndLine: f.line(end), Kind: KindComment})
+			}
+		}
+	}
+}
+
+// branch adds a region for the body of a branch and one for each of its else branches
+func (f *folder) branch(n *parse.BranchNode) {
+	start := f.actionStart(int(n.Keyword().Pos()))
+
+	for {
+		f.list(n.List)
+
+		if n.ElseList == nil {
+			break
+		}
+
+		if chained := elseChain(n.ElseList); chained != nil {
+			// {{ else if }} and {{ else with }} continue the chain, up to the shared {{ end }}
+			next := f.actionStart(int(chained.Keyword().Pos()))
+			f.add(start, next, KindRegion)
+			start, n = next, chained
+			continue
+		}
+
+		next := f.actionStart(int(n.ElseList.Position()))
+		f.add(start, next, KindRegion)
+		start = next
+		f.list(n.ElseList)
+		break
+	}
+
+	end := position.NewBranchEndPosition(n)
+	// node positions are one before the offset in the content
+	f.add(start, f.actionStart(end.Offset+1), KindRegion)
+}
+
+// elseChain returns the branch of an {{ else if }} or {{ else with }}, which is parsed as the only
+// node of the else list
+func elseChain(list *parse.ListNode) *parse.BranchNode {
+	if len(list.Nodes) != 1 {
+		return nil
+	}
+	var branch *parse.BranchNode
+	switch n := list.Nodes[0].(type) {
+	case *parse.IfNode:
+		branch = &n.BranchNode
+	case *parse.WithNode:
+		branch = &n.BranchNode
+	default:
+		return nil
+	}
+	if !strings.HasPrefix(branch.Keyword().Val(), "else") {
+		return nil
+	}
+	return branch
+}
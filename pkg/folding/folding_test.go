@@ -0,0 +1,91 @@
+package folding_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/folding"
+	"github.com/walteh/gotmpls/pkg/parser"
+)
+
+func TestGetFoldingRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     []folding.FoldingRange
+	}{
+		{
+			name: "define_with_nested_range",
+			template: `{{ define "list" }}
+<ul>
+{{ range .Items }}
+	<li>{{ . }}</li>
+{{ end }}
+</ul>
+{{ end }}`,
+			want: []folding.FoldingRange{
+				{StartLine: 0, EndLine: 5, Kind: folding.KindRegion},
+				{StartLine: 2, EndLine: 3, Kind: folding.KindRegion},
+			},
+		},
+		{
+			name: "else_branches_are_separate_regions",
+			template: `{{ if .A }}
+a
+{{ else if .B }}
+b
+{{ else }}
+c
+{{ end }}`,
+			want: []folding.FoldingRange{
+				{StartLine: 0, EndLine: 1, Kind: folding.KindRegion},
+				{StartLine: 2, EndLine: 3, Kind: folding.KindRegion},
+				{StartLine: 4, EndLine: 5, Kind: folding.KindRegion},
+			},
+		},
+		{
+			name: "with_else_and_nested_if",
+			template: `{{ with .A }}
+{{ if .B }}
+b
+{{ end }}
+{{ else }}
+c
+{{ end }}`,
+			want: []folding.FoldingRange{
+				{StartLine: 0, EndLine: 3, Kind: folding.KindRegion},
+				{StartLine: 1, EndLine: 2, Kind: folding.KindRegion},
+				{StartLine: 4, EndLine: 5, Kind: folding.KindRegion},
+			},
+		},
+		{
+			name: "multi_line_comments",
+			template: `{{/*
+gotype: test.Person
+*/}}
+{{/* single line */}}
+{{ .Name }}`,
+			want: []folding.FoldingRange{
+				{StartLine: 0, EndLine: 2, Kind: folding.KindComment},
+			},
+		},
+		{
+			name:     "single_line_structures_do_not_fold",
+			template: `{{ if .A }}a{{ else }}b{{ end }}`,
+			want:     []folding.FoldingRange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parser.Parse(context.Background(), "test.tmpl", []byte(tt.template))
+			require.NoError(t, err)
+
+			got, err := folding.GetFoldingRanges(context.Background(), info)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package formatter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+)
+
+// collectActions returns the actions and comments of the parsed templates of a file, in order
+func collectActions(content string, trees map[string]*parse.Tree) []action {
+	c := &collector{content: content}
+
+	for _, tree := range trees {
+		if tree.Root == nil {
+			continue
+		}
+
+		if !tree.CanRelyOnKeyword() || tree.Keyword().Val() != "define" {
+			// the end of a block is the last node of its tree
+			c.list(tree.Root, int(tree.Root.Position()))
+			continue
+		}
+
+		name := tree.DefineName()
+		header := c.add(int(tree.Keyword().Pos()), int(name.Pos())+len(name.Val()), "define", "define "+name.Val())
+
+		// the {{ end }} of a define is not part of its tree, it is the action after the last node
+		end := c.list(tree.Root, header.end)
+		c.next(end, "end", "end")
+	}
+
+	sort.Slice(c.actions, func(i, j int) bool {
+		return c.actions[i].start < c.actions[j].start
+	})
+
+	return c.actions
+}
+
+type collector struct {
+	content string
+	actions []action
+}
+
+// list collects the actions of the nodes of a list, and returns the offset after its last node, or
+// from if the list is empty
+func (c *collector) list(list *parse.ListNode, from int) int {
+	end := from
+	if list == nil {
+		return end
+	}
+	for _, node := range list.Nodes {
+		end = c.node(node)
+	}
+	return end
+}
+
+// node collects the actions of a node, and returns the offset after it
+func (c *collector) node(node parse.Node) int {
+	switch n := node.(type) {
+	case *parse.TextNode:
+		return int(n.Pos) + len(n.Text)
+	case *parse.CommentNode:
+		act := c.add(int(n.Pos), int(n.Pos)+len(n.Text), "", "")
+		return act.end
+	case *parse.ActionNode:
+		_, end := position.PipeSpan(c.content, n.Pipe)
+		return c.add(int(n.Pos), end, "", n.Pipe.String()).end
+	case *parse.IfNode:
+		return c.branch(&n.BranchNode)
+	case *parse.RangeNode:
+		return c.branch(&n.BranchNode)
+	case *parse.WithNode:
+		return c.branch(&n.BranchNode)
+	case *parse.TemplateNode:
+		return c.template(n)
+	case *parse.BreakNode, *parse.ContinueNode, *parse.EndNode:
+		keyword := n.(parse.KeywordNode).Keyword()
+		return c.add(int(keyword.Pos()), int(keyword.Pos())+len(keyword.Val()), keyword.Val(), keyword.Val()).end
+	}
+	return int(node.Position())
+}
+
+// branch collects the actions of an if, range or with and of its else branches, up to its end
+func (c *collector) branch(n *parse.BranchNode) int {
+	keyword := n.Keyword()
+	name, inner := keyword.Val(), keyword.Val()+" "+n.Pipe.String()
+	if rest, ok := strings.CutPrefix(keyword.Val(), "else"); ok {
+		// {{ else if }} and {{ else with }} continue the chain of the enclosing branch
+		name, inner = "else", "else "+strings.TrimSpace(rest)+" "+n.Pipe.String()
+	}
+
+	_, pipeEnd := position.PipeSpan(c.content, n.Pipe)
+	header := c.add(int(keyword.Pos()), pipeEnd, name, inner)
+
+	end := c.list(n.List, header.end)
+	if n.ElseList == nil {
+		return end
+	}
+
+	if len(n.ElseList.Nodes) != 1 || !isElseChain(n.ElseList.Nodes[0]) {
+		// the {{ else }} is not part of the tree, it is the action after the last node of the list
+		end = c.next(end, "else", "else")
+	}
+
+	return c.list(n.ElseList, end)
+}
+
+// isElseChain reports whether a node is the branch of an {{ else if }} or {{ else with }}
+func isElseChain(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.IfNode:
+		return strings.HasPrefix(n.Keyword().Val(), "else")
+	case *parse.WithNode:
+		return strings.HasPrefix(n.Keyword().Val(), "else")
+	}
+	return false
+}
+
+// template collects a template call or the opening action of a block
+func (c *collector) template(n *parse.TemplateNode) int {
+	name := n.Keyword()
+	end := int(name.Pos()) + len(name.Val())
+	if n.Pipe != nil {
+		_, end = position.PipeSpan(c.content, n.Pipe)
+	}
+
+	// the keyword is the first word of the action
+	start := c.actionStart(int(name.Pos()))
+	keyword := "template"
+	if fields := strings.Fields(strings.TrimPrefix(c.content[start+2:name.Pos()], "-")); len(fields) > 0 {
+		keyword = fields[0]
+	}
+
+	inner := keyword + " " + name.Val()
+	if n.Pipe != nil {
+		inner += " " + n.Pipe.String()
+	}
+	return c.add(int(name.Pos()), end, keyword, inner).end
+}
+
+// next collects the action that starts after offset, which is an else or end that is not part of
+// the tree, and returns the offset after it
+func (c *collector) next(offset int, keyword string, inner string) int {
+	idx := strings.Index(c.content[offset:], "{{")
+	if idx == -1 {
+		return offset
+	}
+	first := offset + idx + len("{{")
+	return c.add(first, first, keyword, inner).end
+}
+
+// actionStart returns the offset of the left delimiter of the action that contains offset
+func (c *collector) actionStart(offset int) int {
+	return strings.LastIndex(c.content[:offset], "{{")
+}
+
+// add collects the action whose content spans from first to last. The inner text is the canonical
+// form of its content, or empty for a comment.
+func (c *collector) add(first, last int, keyword string, inner string) action {
+	act := action{
+		start:   c.actionStart(first),
+		keyword: keyword,
+		comment: inner == "",
+	}
+
+	act.end = last + strings.Index(c.content[last:], "}}") + 2
+	act.text = c.content[act.start:act.end]
+
+	// like the lexer, a trim marker is a "-" next to a space
+	act.trimLeft = strings.HasPrefix(act.text, "{{-") && len(act.text) > 3 && isSpace(act.text[3])
+	act.trimRight = strings.HasSuffix(act.text, "-}}") && len(act.text) > 4 && isSpace(act.text[len(act.text)-4])
+	act.inner = inner
+
+	c.actions = append(c.actions, act)
+	return act
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
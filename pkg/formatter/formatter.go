@@ -0,0 +1,253 @@
+// Package formatter formats go templates into a canonical layout.
+package formatter
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Options configure the formatter
+type Options struct {
+	// Indent is one level of indentation, a tab if empty
+	Indent string
+}
+
+// TextEdit represents a replacement of a range of text in a template
+type TextEdit struct {
+	Range   position.Range
+	NewText string
+}
+
+// edit is a replacement of content[start:end]
+type edit struct {
+	start, end int
+	text       string
+}
+
+// action is a {{ }} action or comment of a template
+type action struct {
+	start, end int // offsets of the left delimiter and after the right delimiter
+	trimLeft   bool
+	trimRight  bool
+	comment    bool
+	text       string // the text of the whole action
+	inner      string // the canonical text between the delimiters and trim markers, printed from the parse tree
+	keyword    string // "if", "else", "end", ... if the action starts with a keyword
+}
+
+// keywords that open a block closed by {{ end }}
+var blockKeywords = map[string]bool{
+	"if":     true,
+	"range":  true,
+	"with":   true,
+	"define": true,
+	"block":  true,
+}
+
+// Format returns the formatted template.
+//
+// Inside of actions, spacing is normalized to {{ pipeline }}: a single space around pipes and
+// declarations, after commas, and none inside of parentheses. Trim markers, comments, literals
+// and actions that span multiple lines are kept as they are.
+//
+// The bodies of if, range, with, define and block are indented one level deeper than the line
+// of their opening action, and else and end are aligned with it. Only indentation that is not
+// part of the output is changed, which is whitespace removed by a trim marker: either the line
+// starts with {{- or the previous action ends with -}}. Formatting never changes what a template
+// renders.
+func Format(ctx context.Context, name string, content string, opts Options) (string, error) {
+	edits, err := format(ctx, name, content, opts)
+	if err != nil {
+		return "", err
+	}
+	return apply(content, edits), nil
+}
+
+// Edits returns the edits that format the template, sorted by position.
+func Edits(ctx context.Context, name string, content string, opts Options) ([]TextEdit, error) {
+	edits, err := format(ctx, name, content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	textEdits := make([]TextEdit, 0, len(edits))
+	for _, e := range edits {
+		textEdits = append(textEdits, TextEdit{
+			Range: position.Range{
+				Start: position.OffsetToPlace(content, e.start),
+				End:   position.OffsetToPlace(content, e.end),
+			},
+			NewText: e.text,
+		})
+	}
+	return textEdits, nil
+}
+
+// InRange returns the edits that touch the range, e.g. to format a selection
+func InRange(edits []TextEdit, rng position.Range) []TextEdit {
+	filtered := []TextEdit{}
+	for _, e := range edits {
+		if !before(e.Range.End, rng.Start) && !before(rng.End, e.Range.Start) {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+func before(a, b position.Place) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+func format(ctx context.Context, name string, content string, opts Options) ([]edit, error) {
+	trees, err := parser.ParseTree(name, []byte(content))
+	if err != nil {
+		return nil, errors.Errorf("parsing template: %w", err)
+	}
+
+	if opts.Indent == "" {
+		opts.Indent = "\t"
+	}
+
+	actions := collectActions(content, trees)
+
+	edits := []edit{}
+	for _, act := range actions {
+		if text := act.format(); text != act.text {
+			edits = append(edits, edit{start: act.start, end: act.end, text: text})
+		}
+	}
+	edits = append(edits, indentEdits(content, actions, opts.Indent)...)
+
+	// indentation is inserted before the action that starts the line
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end < edits[j].end
+	})
+
+	// the formatter only changes whitespace, so the result has to parse as well
+	if _, err := parser.ParseTree(name, []byte(apply(content, edits))); err != nil {
+		return nil, errors.Errorf("formatted template is invalid: %w", err)
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("name", name).Int("actions", len(actions)).Int("edits", len(edits)).Msg("formatted template")
+
+	return edits, nil
+}
+
+func apply(content string, edits []edit) string {
+	var sb strings.Builder
+	last := 0
+	for _, e := range edits {
+		sb.WriteString(content[last:e.start])
+		sb.WriteString(e.text)
+		last = e.end
+	}
+	sb.WriteString(content[last:])
+	return sb.String()
+}
+
+// indentEdits re-indents the lines whose indentation is removed by a trim marker
+func indentEdits(content string, actions []action, indent string) []edit {
+	type block struct {
+		indent string // the indentation of the line of the opening action
+	}
+
+	edits := []edit{}
+	stack := []block{}
+	newIndents := map[int]string{} // keyed by the offset of the start of a line
+
+	lineIndent := func(offset int) string {
+		start := strings.LastIndex(content[:offset], "\n") + 1
+		if indent, ok := newIndents[start]; ok {
+			return indent
+		}
+		return content[start : start+len(content[start:])-len(strings.TrimLeft(content[start:], " \t"))]
+	}
+
+	next := 0 // the next action to apply to the stack
+	for lineStart := strings.Index(content, "\n") + 1; lineStart > 0 && lineStart < len(content); {
+		first := lineStart + len(content[lineStart:]) - len(strings.TrimLeft(content[lineStart:], " \t"))
+
+		for ; next < len(actions) && actions[next].start < lineStart; next++ {
+			switch act := actions[next]; {
+			case blockKeywords[act.keyword]:
+				stack = append(stack, block{indent: lineIndent(act.start)})
+			case act.keyword == "end" && len(stack) > 0:
+				stack = stack[:len(stack)-1]
+			}
+		}
+
+		if reindentable(content, actions, next, lineStart, first) && len(stack) > 0 {
+			target := stack[len(stack)-1].indent
+			if next == len(actions) || actions[next].start != first || (actions[next].keyword != "end" && actions[next].keyword != "else") {
+				target += indent
+			}
+			newIndents[lineStart] = target
+			if target != content[lineStart:first] {
+				edits = append(edits, edit{start: lineStart, end: first, text: target})
+			}
+		}
+
+		idx := strings.Index(content[lineStart:], "\n")
+		if idx == -1 {
+			break
+		}
+		lineStart += idx + 1
+	}
+
+	return edits
+}
+
+// reindentable reports whether the indentation of a line is removed by a trim marker. The next
+// action is the first action that starts at or after the line.
+func reindentable(content string, actions []action, next int, lineStart, first int) bool {
+	if first == len(content) || content[first] == '\n' || content[first] == '\r' {
+		// blank lines are left alone
+		return false
+	}
+
+	if next > 0 && actions[next-1].end > lineStart {
+		// inside of an action or comment that spans multiple lines
+		return false
+	}
+
+	if next < len(actions) && actions[next].start == first && actions[next].trimLeft {
+		return true
+	}
+
+	if next > 0 && actions[next-1].trimRight {
+		return strings.TrimLeft(content[actions[next-1].end:first], " \t\r\n") == ""
+	}
+
+	return false
+}
+
+// format returns the canonical form of the action, comments and actions that span multiple lines
+// are returned as they are
+func (act action) format() string {
+	if act.comment {
+		return act.text
+	}
+
+	left, right := "{{ ", " }}"
+	if act.trimLeft {
+		left = "{{- "
+	}
+	if act.trimRight {
+		right = " -}}"
+	}
+
+	text := left + act.inner + right
+	if strings.Count(text, "\n") != strings.Count(act.text, "\n") {
+		return act.text
+	}
+	return text
+}
@@ -0,0 +1,164 @@
+package formatter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/formatter"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "spacing_inside_of_actions",
+			template: `{{.Name}} {{   .Address.Street   }} {{$x:=.Age}}{{$x}}`,
+			want:     `{{ .Name }} {{ .Address.Street }} {{ $x := .Age }}{{ $x }}`,
+		},
+		{
+			name:     "pipes_parentheses_and_commas",
+			template: `{{.Name|printf "%s"|len}} {{ ( len  .Items ) }} {{range $i ,$v:=.Items}}{{$i}}{{end}}`,
+			want:     `{{ .Name | printf "%s" | len }} {{ (len .Items) }} {{ range $i, $v := .Items }}{{ $i }}{{ end }}`,
+		},
+		{
+			name:     "field_chains_are_kept_together",
+			template: `{{(index .Items 0).Name}} {{$.Root.Name}} {{.Method  .Arg}}`,
+			want:     `{{ (index .Items 0).Name }} {{ $.Root.Name }} {{ .Method .Arg }}`,
+		},
+		{
+			name:     "literals_are_kept",
+			template: `{{printf "a  |  b}}" 'x' ` + "`raw  }}`" + ` -1}}`,
+			want:     `{{ printf "a  |  b}}" 'x' ` + "`raw  }}`" + ` -1 }}`,
+		},
+		{
+			name:     "keywords",
+			template: `{{define "row"}}{{.A}}{{end}}{{template "row" .}}{{block "b" .X}}{{if .A}}x{{else   if .B}}y{{  else  }}{{/* c */}}z{{end}}{{end}}`,
+			want:     `{{ define "row" }}{{ .A }}{{ end }}{{ template "row" . }}{{ block "b" .X }}{{ if .A }}x{{ else if .B }}y{{ else }}{{/* c */}}z{{ end }}{{ end }}`,
+		},
+		{
+			name:     "range_control",
+			template: `{{range $i,$v:=.Items}}{{if .X}}{{break}}{{end}}{{continue}}{{else}}{{$x = 2}}{{end}}`,
+			want:     `{{ range $i, $v := .Items }}{{ if .X }}{{ break }}{{ end }}{{ continue }}{{ else }}{{ $x = 2 }}{{ end }}`,
+		},
+		{
+			name:     "delimiters_inside_of_literals",
+			template: `{{(index .Items "}}").A.B.C}} {{printf ` + "`a\n}}b`" + `  .X}}`,
+			want:     `{{ (index .Items "}}").A.B.C }} {{ printf ` + "`a\n}}b`" + ` .X }}`,
+		},
+		{
+			name:     "trim_markers_are_kept",
+			template: `a {{-  .Name   -}} b {{-  .Name}} c {{.Name   -}} d`,
+			want:     `a {{- .Name -}} b {{- .Name }} c {{ .Name -}} d`,
+		},
+		{
+			name:     "comments_are_kept",
+			template: `{{/*   gotype: test.Person   */}}{{- /* x */ -}}{{.Name}}`,
+			want:     `{{/*   gotype: test.Person   */}}{{- /* x */ -}}{{ .Name }}`,
+		},
+		{
+			name:     "multi_line_actions_are_kept",
+			template: "{{ printf \"%s\"\n    .Name }}",
+			want:     "{{ printf \"%s\"\n    .Name }}",
+		},
+		{
+			name: "trimmed_bodies_are_indented",
+			template: `{{- range .Items }}
+{{- if .Ready }}
+{{- .Name }}
+      {{- else }}
+{{- .ID }}
+{{- end }}
+ {{- end }}
+`,
+			want: `{{- range .Items }}
+	{{- if .Ready }}
+		{{- .Name }}
+	{{- else }}
+		{{- .ID }}
+	{{- end }}
+{{- end }}
+`,
+		},
+		{
+			name: "text_after_right_trim_is_indented",
+			template: `{{ define "row" -}}
+<tr>{{ .Name }}</tr>
+{{- end }}`,
+			want: `{{ define "row" -}}
+	<tr>{{ .Name }}</tr>
+{{- end }}`,
+		},
+		{
+			name: "rendered_indentation_is_kept",
+			template: `<ul>
+  {{- range .Items }}
+  <li>{{.}}</li>
+      {{- end }}
+</ul>`,
+			want: `<ul>
+  {{- range .Items }}
+  <li>{{ . }}</li>
+  {{- end }}
+</ul>`,
+		},
+		{
+			name:     "indentation_is_inserted_before_actions",
+			template: "{{range .Items}}\n{{- if .X}}\n{{- .Name|len}}\n{{- end}}\n{{end}}\n",
+			want:     "{{ range .Items }}\n\t{{- if .X }}\n\t\t{{- .Name | len }}\n\t{{- end }}\n{{ end }}\n",
+		},
+		{
+			name:     "already_formatted",
+			template: "{{ if .X -}}\n\t{{ .Y }}\n{{- end }}\n",
+			want:     "{{ if .X -}}\n\t{{ .Y }}\n{{- end }}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatter.Format(context.Background(), "test.tmpl", tt.template, formatter.Options{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			again, err := formatter.Format(context.Background(), "test.tmpl", got, formatter.Options{})
+			require.NoError(t, err)
+			assert.Equal(t, got, again, "formatting should be idempotent")
+		})
+	}
+}
+
+func TestFormatIndent(t *testing.T) {
+	got, err := formatter.Format(context.Background(), "test.tmpl", "{{ with .X -}}\n{{ .Y }}\n{{- end }}", formatter.Options{Indent: "  "})
+	require.NoError(t, err)
+	assert.Equal(t, "{{ with .X -}}\n  {{ .Y }}\n{{- end }}", got)
+}
+
+func TestFormatInvalid(t *testing.T) {
+	_, err := formatter.Format(context.Background(), "test.tmpl", "{{ if .X }}", formatter.Options{})
+	require.Error(t, err)
+}
+
+func TestEditsInRange(t *testing.T) {
+	content := "{{.A}}\n{{.B}}\n{{.C}}"
+
+	edits, err := formatter.Edits(context.Background(), "test.tmpl", content, formatter.Options{})
+	require.NoError(t, err)
+	require.Len(t, edits, 3)
+
+	selected := formatter.InRange(edits, position.Range{
+		Start: position.Place{Line: 1, Character: 0},
+		End:   position.Place{Line: 1, Character: 2},
+	})
+	assert.Equal(t, []formatter.TextEdit{{
+		Range: position.Range{
+			Start: position.Place{Line: 1, Character: 0},
+			End:   position.Place{Line: 1, Character: 6},
+		},
+		NewText: "{{ .B }}",
+	}}, selected)
+}
@@ -137,6 +137,8 @@ func FormatHoverResponse(ctx context.Context, variable *parser.VariableLocation,
 }
 
 func BuildHoverResponseFromParse(ctx context.Context, info *parser.ParsedTemplateFile, hoverPosition position.RawPosition, registry *ast.Registry) (*HoverInfo, error) {
+	methods := registry.TemplateMethods(info.Filename, info.FunctionSets()...)
+
 	for _, block := range info.Blocks {
 		if block.TypeHint == nil {
 			continue
@@ -149,7 +151,7 @@ func BuildHoverResponseFromParse(ctx context.Context, info *parser.ParsedTemplat
 			zerolog.Ctx(ctx).Trace().Msgf("checking overlap of [%s:%d] with [%s:%d]", hoverPosition.Text, hoverPosition.Offset, function.Position.Text, function.Position.Offset)
 			if hoverPosition.HasRangeOverlapWith(function.Position) {
 				zerolog.Ctx(ctx).Trace().Msgf("function %s at %v overlaps with position %v", function.Name(), function.Position, hoverPosition)
-				method, err := ast.GenerateFunctionCallInfoFromPosition(ctx, function.Position)
+				method, err := ast.GenerateFunctionCallInfoFromMethods(ctx, methods, function.Position)
 				if err != nil {
 					return nil, errors.Errorf("generating function call info: %w", err)
 				}
@@ -173,10 +175,16 @@ func BuildHoverResponseFromParse(ctx context.Context, info *parser.ParsedTemplat
 			if hoverPosition.HasRangeOverlapWith(variable.Position) {
 				zerolog.Ctx(ctx).Trace().Msgf("variable %s at %v overlaps with position %v", variable.Name(), variable.Position, hoverPosition)
 
-				typeInfo, err := ast.GenerateFieldInfoFromPosition(ctx, thd, variable.Position)
+				dotThd, err := variable.DotTypeHintDefinition(ctx, thd, methods)
+				if err != nil || dotThd == nil {
+					return nil, nil
+				}
+
+				typeInfo, err := ast.GenerateFieldInfoFromPosition(ctx, dotThd, variable.Position)
 				if err != nil {
 					// If the field doesn't exist, return nil hover info instead of an error
-					if strings.Contains(err.Error(), "field not found") {
+					var notFound *ast.FieldNotFoundError
+					if errors.As(err, &notFound) {
 						return nil, nil
 					}
 					return nil, errors.Errorf("generating field info: %w", err)
@@ -0,0 +1,190 @@
+// Package inlay provides inlay hints with the inferred types of go template pipelines and variables.
+package inlay
+
+import (
+	"context"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Options select the kinds of inlay hints
+type Options struct {
+	// VariableTypes shows the type of a variable after its declaration, e.g. {{ $x: int := len .Items }}
+	VariableTypes bool `json:"variableTypes"`
+	// PipelineTypes shows the result of every command of a pipeline with more than one command
+	PipelineTypes bool `json:"pipelineTypes"`
+	// RangeTypes shows the type `.` is bound to after the header of a range
+	RangeTypes bool `json:"rangeTypes"`
+}
+
+// Hint is a label shown at a position of the template
+type Hint struct {
+	Position position.Place
+	Label    string
+}
+
+// GetInlayHints returns the inferred types of the variables, pipeline commands and range
+// elements of a template.
+//
+// The types are resolved the same way as when the template is type checked, against the
+// gotype hint of each block. Values whose type can not be determined statically have no hint.
+func GetInlayHints(ctx context.Context, info *parser.ParsedTemplateFile, registry *ast.Registry, opts Options) ([]Hint, error) {
+	content := info.SourceContent
+
+	trees, err := parser.ParseTree(info.Filename, []byte(content))
+	if err != nil {
+		return nil, errors.Errorf("parsing template: %w", err)
+	}
+
+	methods := registry.TemplateMethods(info.Filename, info.FunctionSets()...)
+
+	h := &hinter{content: content, opts: opts, hints: []Hint{}}
+
+	for _, block := range info.Blocks {
+		tree, ok := trees[block.Name]
+		if !ok || tree.Root == nil {
+			continue
+		}
+
+		// the type `.` is bound to at the root of the block
+		var root types.Type
+		if block.TypeHint != nil {
+			typeInfo, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+			if err != nil {
+				// the hint is reported by the diagnostics, the other blocks still get hints
+				zerolog.Ctx(ctx).Debug().Err(err).Str("file", info.Filename).Str("block", block.Name).Msg("skipping block with unresolved type hint")
+				continue
+			}
+			root = typeInfo.Type
+		}
+
+		// commands are matched to their parse nodes by their offset
+		h.results = map[int]types.Type{}
+		for cmd, typ := range diagnostic.CommandTypes(ctx, &block, root, methods) {
+			// node positions are one before the offset in the content
+			h.results[cmd.Position.Offset+1] = typ
+		}
+
+		h.list(tree.Root)
+	}
+
+	sort.SliceStable(h.hints, func(i, j int) bool {
+		a, b := h.hints[i].Position, h.hints[j].Position
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	})
+
+	zerolog.Ctx(ctx).Trace().Int("hints", len(h.hints)).Str("file", info.Filename).Msg("built inlay hints")
+
+	return h.hints, nil
+}
+
+type hinter struct {
+	content string
+	opts    Options
+	results map[int]types.Type // the result of each command, by the offset of the command
+	hints   []Hint
+}
+
+func (h *hinter) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			h.pipe(n.Pipe, false)
+		case *parse.TemplateNode:
+			h.pipe(n.Pipe, false)
+		case *parse.IfNode:
+			h.branch(&n.BranchNode, false)
+		case *parse.RangeNode:
+			h.branch(&n.BranchNode, true)
+		case *parse.WithNode:
+			h.branch(&n.BranchNode, false)
+		}
+	}
+}
+
+func (h *hinter) branch(n *parse.BranchNode, isRange bool) {
+	result := h.pipe(n.Pipe, isRange)
+
+	if isRange && h.opts.RangeTypes && result != nil {
+		if elem, err := ast.RangeElementType(result); err == nil && elem != nil {
+			_, end := position.PipeSpan(h.content, n.Pipe)
+			h.add(h.actionEnd(end), ".: "+typeString(elem))
+		}
+	}
+
+	h.list(n.List)
+	h.list(n.ElseList)
+}
+
+// pipe adds the hints of a pipeline and its declarations, and returns the type of its result
+func (h *hinter) pipe(pipe *parse.PipeNode, isRange bool) types.Type {
+	if pipe == nil || len(pipe.Cmds) == 0 {
+		return nil
+	}
+
+	var result types.Type
+	for _, cmd := range pipe.Cmds {
+		result = h.results[int(cmd.Position())]
+		if h.opts.PipelineTypes && len(pipe.Cmds) > 1 && result != nil {
+			_, end := position.CommandSpan(h.content, cmd)
+			h.add(end, ": "+typeString(result))
+		}
+	}
+
+	if !h.opts.VariableTypes || pipe.IsAssign || result == nil {
+		return result
+	}
+
+	for i, decl := range pipe.Decl {
+		typ := result
+		if isRange {
+			var err error
+			if len(pipe.Decl) == 2 && i == 0 {
+				typ, err = ast.RangeKeyType(result)
+			} else {
+				typ, err = ast.RangeElementType(result)
+			}
+			if err != nil || typ == nil {
+				continue
+			}
+		}
+
+		_, end := position.OperandSpan(h.content, decl)
+		h.add(end, ": "+typeString(typ))
+	}
+
+	return result
+}
+
+func (h *hinter) add(offset int, label string) {
+	h.hints = append(h.hints, Hint{Position: position.OffsetToPlace(h.content, offset), Label: label})
+}
+
+// actionEnd returns the offset after the right delimiter of the action that contains offset
+func (h *hinter) actionEnd(offset int) int {
+	idx := strings.Index(h.content[offset:], "}}")
+	if idx == -1 {
+		return len(h.content)
+	}
+	return offset + idx + len("}}")
+}
+
+// typeString writes package qualified types with the package name only, e.g. "[]*types.Order"
+func typeString(typ types.Type) string {
+	return types.TypeString(typ, func(pkg *types.Package) string {
+		return pkg.Name()
+	})
+}
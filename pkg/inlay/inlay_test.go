@@ -0,0 +1,139 @@
+package inlay_test
+
+import (
+	"context"
+	"fmt"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/inlay"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+func createMockRegistry(t *testing.T) *ast.Registry {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+	pkg := pkgd.Package.Types
+
+	order := pkgd.AddStruct("Order", map[string]types.Type{
+		"Price": types.Typ[types.Float64],
+	})
+
+	pkgd.AddStruct("Invoice", map[string]types.Type{
+		"Title":  types.Typ[types.String],
+		"Orders": types.NewSlice(types.NewPointer(order)),
+		"Tags":   types.NewMap(types.Typ[types.String], types.Typ[types.Int]),
+	})
+
+	pkgd.AddFunction("first", types.NewSignature(
+		nil,
+		types.NewTuple(types.NewVar(0, pkg, "orders", types.NewSlice(types.NewPointer(order)))),
+		types.NewTuple(types.NewVar(0, pkg, "", types.NewPointer(order))),
+		false,
+	))
+
+	return registry
+}
+
+func TestGetInlayHints(t *testing.T) {
+	const hint = "{{- /*gotype: github.com/example/types.Invoice*/ -}}\n"
+
+	all := inlay.Options{VariableTypes: true, PipelineTypes: true, RangeTypes: true}
+
+	tests := []struct {
+		name     string
+		template string
+		opts     inlay.Options
+		// the hints are described as "<line>:<character><label>"
+		want []string
+	}{
+		{
+			name:     "variable declaration",
+			template: hint + `{{ $n := len .Orders }}`,
+			opts:     all,
+			want:     []string{"1:5: int"},
+		},
+		{
+			name:     "every command of a pipeline",
+			template: hint + `{{ .Orders | first | printf "%v" }}`,
+			opts:     all,
+			want:     []string{"1:10: []*types.Order", "1:18: *types.Order", "1:32: string"},
+		},
+		{
+			name:     "single command has no pipeline hint",
+			template: hint + `{{ .Title }}`,
+			opts:     all,
+			want:     []string{},
+		},
+		{
+			name:     "range header and declarations",
+			template: hint + `{{ range $i, $o := .Orders }}{{ $o.Price }}{{ end }}`,
+			opts:     all,
+			want:     []string{"1:11: int", "1:15: *types.Order", "1:29.: *types.Order"},
+		},
+		{
+			name:     "range over map",
+			template: hint + `{{ range $k, $v := .Tags }}{{ end }}`,
+			opts:     all,
+			want:     []string{"1:11: string", "1:15: int", "1:27.: int"},
+		},
+		{
+			name:     "range without declarations",
+			template: hint + "{{ range .Orders -}}\n{{ .Price }}{{ end }}",
+			opts:     all,
+			want:     []string{"1:20.: *types.Order"},
+		},
+		{
+			name:     "unknown types have no hints",
+			template: hint + `{{ $x := index .Orders 0 }}{{ $y := .Nope }}`,
+			opts:     all,
+			want:     []string{},
+		},
+		{
+			name:     "only the enabled kinds",
+			template: hint + `{{ range $o := .Orders }}{{ $p := $o.Price | printf "%v" }}{{ end }}`,
+			opts:     inlay.Options{VariableTypes: true},
+			want:     []string{"1:11: *types.Order", "1:30: string"},
+		},
+		{
+			name:     "blocks with an unresolved type hint are skipped",
+			template: `{{ define "broken" }}{{- /*gotype: github.com/example/types.Missing*/ -}}{{ $t := .Title }}{{ end }}` + hint + `{{ $t := .Title }}`,
+			opts:     all,
+			want:     []string{"1:5: string"},
+		},
+		{
+			name:     "no options",
+			template: hint + `{{ $n := len .Orders }}`,
+			want:     []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			info, err := parser.Parse(ctx, "test.tmpl", []byte(tt.template))
+			require.NoError(t, err)
+
+			hints, err := inlay.GetInlayHints(ctx, info, createMockRegistry(t), tt.opts)
+			require.NoError(t, err)
+
+			got := []string{}
+			for _, h := range hints {
+				got = append(got, describe(h.Position)+h.Label)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func describe(place position.Place) string {
+	return fmt.Sprintf("%d:%d", place.Line, place.Character)
+}
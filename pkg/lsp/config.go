@@ -0,0 +1,51 @@
+package lsp
+
+import (
+	"encoding/json"
+
+	"github.com/walteh/gotmpls/pkg/inlay"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Config is the workspace configuration of the server, sent by the client as initialization options
+// and with workspace/didChangeConfiguration.
+//
+// The settings can either be sent as is, or nested in a "gotmpls" section:
+//
+//	{"gotmpls": {"functionSets": ["sprig"], "inlayHints": {"variableTypes": true}}}
+type Config struct {
+	// FunctionSets are the bundled function sets (e.g. "sprig") that can be called from every template
+	FunctionSets []string `json:"functionSets"`
+	// InlayHints select the inferred types that are shown as inlay hints, all are off by default
+	InlayHints inlay.Options `json:"inlayHints"`
+}
+
+// parseConfig reads the configuration from the settings sent by the client
+func parseConfig(settings any) (Config, error) {
+	cfg := Config{}
+
+	if settings == nil {
+		return cfg, nil
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return cfg, errors.Errorf("marshalling settings: %w", err)
+	}
+
+	section := struct {
+		Gotmpls *Config `json:"gotmpls"`
+	}{}
+	if err := json.Unmarshal(data, &section); err != nil {
+		return cfg, errors.Errorf("unmarshalling settings: %w", err)
+	}
+	if section.Gotmpls != nil {
+		return *section.Gotmpls, nil
+	}
+
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, errors.Errorf("unmarshalling settings: %w", err)
+	}
+
+	return cfg, nil
+}
@@ -78,3 +78,15 @@ func (m *DocumentManager) Delete(uri string) {
 	normalizedURI := normalizeURI(uri)
 	m.store.Delete(normalizedURI)
 }
+
+// Open returns the documents opened by the client, as opposed to those read from the filesystem
+func (m *DocumentManager) Open() []*Document {
+	docs := []*Document{}
+	m.store.Range(func(_, value any) bool {
+		if doc, ok := value.(*Document); ok && doc.LanguageID != "" {
+			docs = append(docs, doc)
+		}
+		return true
+	})
+	return docs
+}
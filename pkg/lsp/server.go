@@ -3,7 +3,10 @@ package lsp
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -11,12 +14,21 @@ import (
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/completion"
+	"github.com/walteh/gotmpls/pkg/definition"
 	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"github.com/walteh/gotmpls/pkg/folding"
+	"github.com/walteh/gotmpls/pkg/formatter"
 	"github.com/walteh/gotmpls/pkg/hover"
+	"github.com/walteh/gotmpls/pkg/inlay"
 	"github.com/walteh/gotmpls/pkg/lsp/protocol"
 	"github.com/walteh/gotmpls/pkg/parser"
 	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/references"
+	"github.com/walteh/gotmpls/pkg/rename"
+	"github.com/walteh/gotmpls/pkg/selection"
 	"github.com/walteh/gotmpls/pkg/semtok"
+	"github.com/walteh/gotmpls/pkg/symbols"
 	"gitlab.com/tozd/go/errors"
 )
 
@@ -35,7 +47,10 @@ type Server struct {
 	documents *DocumentManager
 
 	// Workspace management
-	workspace string
+	workspaceFolders []string
+	// the result ids of the diagnostics published for each document, keyed by the normalized URI
+	publishedResults map[string]string
+	workspaceMu      sync.Mutex
 	// workspaceFSWatcher *fsnotify.Watcher
 
 	// Server state
@@ -55,6 +70,13 @@ type Server struct {
 
 	// LSP client for notifications
 	callbackClient protocol.Client
+
+	// Workspace configuration sent by the client
+	config   Config
+	configMu sync.RWMutex
+
+	// Packages loaded for the modules of the workspace
+	registries *ast.RegistryCache
 }
 
 func NewServer(ctx context.Context) *Server {
@@ -62,6 +84,7 @@ func NewServer(ctx context.Context) *Server {
 		id:          xid.New().String(),
 		documents:   NewDocumentManager(),
 		cancelFuncs: &sync.Map{},
+		registries:  ast.NewRegistryCache(),
 		debug:       true, // Disabled debug mode
 	}
 }
@@ -74,6 +97,71 @@ func (me *Server) Documents() *DocumentManager {
 	return me.documents
 }
 
+// Config returns the current workspace configuration
+func (me *Server) Config() Config {
+	me.configMu.RLock()
+	defer me.configMu.RUnlock()
+	return me.config
+}
+
+func (me *Server) setConfig(cfg Config) {
+	me.configMu.Lock()
+	defer me.configMu.Unlock()
+	me.config = cfg
+}
+
+// analyzePackage returns the cached packages of a file, with the workspace configuration applied to the registry.
+// The unsaved content of every open Go file is added to the overlay, so that the packages are reloaded
+// when Go code is edited but reused while templates are edited.
+func (s *Server) analyzePackage(ctx context.Context, path string, overlay map[string][]byte) (*ast.Registry, error) {
+	overlay = maps.Clone(overlay)
+	for _, doc := range s.documents.Open() {
+		docPath := normalizeURI(doc.URI)
+		if _, ok := overlay[docPath]; !ok && strings.HasSuffix(docPath, ".go") {
+			overlay[docPath] = []byte(doc.Content)
+		}
+	}
+
+	// only the packages of the type hints are loaded, so they are read before the template is analyzed
+	hints := []string{}
+	if content, ok := overlay[path]; ok && !strings.HasSuffix(path, ".go") {
+		if info, err := parser.Parse(ctx, path, content); err == nil {
+			for _, block := range info.Blocks {
+				if block.TypeHint != nil {
+					hints = append(hints, block.TypeHint.TypePath)
+				}
+			}
+		}
+	}
+
+	reg, err := s.registries.Registry(ctx, path, overlay, hints...)
+	if err != nil {
+		return nil, err
+	}
+
+	reg.FunctionSets = s.Config().FunctionSets
+
+	return reg, nil
+}
+
+// parseTemplate parses a template, with the type hints that the go code of the registry implies for
+// the blocks without a gotype comment
+func parseTemplate(ctx context.Context, path string, content string, reg *ast.Registry) (*parser.ParsedTemplateFile, error) {
+	return parser.ParseWithRegistry(ctx, path, []byte(content), reg)
+}
+
+// parseDocument parses an open template with the type hints implied by the go code of its packages.
+// The syntax of a template does not depend on the go code, so the hints are left out if the packages
+// can not be loaded.
+func (s *Server) parseDocument(ctx context.Context, path string, content string) (*parser.ParsedTemplateFile, error) {
+	reg, err := s.analyzePackage(ctx, path, map[string][]byte{path: []byte(content)})
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("path", path).Msg("parsing template without implicit type hints")
+		reg = nil
+	}
+	return parseTemplate(ctx, path, content, reg)
+}
+
 // Required interface methods
 func (s *Server) Progress(ctx context.Context, params *protocol.ProgressParams) error {
 	return nil // Not implemented yet
@@ -118,6 +206,22 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitializ
 
 	// Store client capabilities
 	s.clientCapabilities = params.Capabilities
+
+	cfg, err := parseConfig(params.InitializationOptions)
+	if err != nil {
+		logger.Warn().Err(err).Msg("ignoring invalid initialization options")
+	} else {
+		s.setConfig(cfg)
+	}
+
+	folders := []string{}
+	for _, folder := range params.WorkspaceFolders {
+		folders = append(folders, normalizeURI(folder.URI))
+	}
+	if len(folders) == 0 && params.RootURI != "" {
+		folders = append(folders, normalizeURI(string(params.RootURI)))
+	}
+	s.setWorkspaceFolders(folders)
 	logger.Debug().
 		Interface("semantic_tokens", s.clientCapabilities.TextDocument.SemanticTokens).
 		Interface("workspace_semantic_tokens", s.clientCapabilities.Workspace.SemanticTokens).
@@ -140,6 +244,52 @@ func (s *Server) Initialize(ctx context.Context, params *protocol.ParamInitializ
 			},
 			TriggerCharacters: []string{".", ":", " "},
 		},
+		CodeActionProvider: &protocol.CodeActionOptions{
+			CodeActionKinds: []protocol.CodeActionKind{protocol.QuickFix},
+		},
+		SignatureHelpProvider: &protocol.SignatureHelpOptions{
+			TriggerCharacters: []string{" ", "("},
+		},
+		DefinitionProvider: &protocol.Or_ServerCapabilities_definitionProvider{
+			Value: true,
+		},
+		ReferencesProvider: &protocol.Or_ServerCapabilities_referencesProvider{
+			Value: true,
+		},
+		RenameProvider: &protocol.Or_ServerCapabilities_renameProvider{
+			Value: protocol.RenameOptions{
+				PrepareProvider: true,
+			},
+		},
+		DocumentSymbolProvider: &protocol.Or_ServerCapabilities_documentSymbolProvider{
+			Value: true,
+		},
+		FoldingRangeProvider: &protocol.Or_ServerCapabilities_foldingRangeProvider{
+			Value: true,
+		},
+		SelectionRangeProvider: &protocol.Or_ServerCapabilities_selectionRangeProvider{
+			Value: true,
+		},
+		InlayHintProvider: &protocol.Or_ServerCapabilities_inlayHintProvider{
+			Value: true,
+		},
+		DiagnosticProvider: &protocol.Or_ServerCapabilities_diagnosticProvider{
+			Value: protocol.DiagnosticOptions{
+				InterFileDependencies: true,
+				WorkspaceDiagnostics:  true,
+			},
+		},
+		DocumentFormattingProvider: &protocol.Or_ServerCapabilities_documentFormattingProvider{
+			Value: true,
+		},
+		DocumentRangeFormattingProvider: &protocol.Or_ServerCapabilities_documentRangeFormattingProvider{
+			Value: protocol.DocumentRangeFormattingOptions{
+				RangesSupport: true,
+			},
+		},
+		DocumentOnTypeFormattingProvider: &protocol.DocumentOnTypeFormattingOptions{
+			FirstTriggerCharacter: "}",
+		},
 	}
 
 	return &protocol.InitializeResult{
@@ -221,6 +371,32 @@ func (s *Server) Initialized(ctx context.Context, params *protocol.InitializedPa
 		logger.Debug().Msg("client does not support dynamic registration of semantic tokens, using static registration")
 	}
 
+	// the cached packages are invalidated when files change on disk
+	if s.clientCapabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration {
+		watchers := []protocol.FileSystemWatcher{}
+		for _, pattern := range []string{"**/*.go", "**/go.mod", "**/go.sum", "**/go.work", "**/*.tmpl"} {
+			watchers = append(watchers, protocol.FileSystemWatcher{
+				GlobPattern: protocol.GlobPattern{Value: pattern},
+			})
+		}
+
+		err := s.callbackClient.RegisterCapability(ctx, &protocol.RegistrationParams{
+			Registrations: []protocol.Registration{
+				{
+					ID:     "watched-files",
+					Method: "workspace/didChangeWatchedFiles",
+					RegisterOptions: &protocol.DidChangeWatchedFilesRegistrationOptions{
+						Watchers: watchers,
+					},
+				},
+			},
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to register watched files")
+			return errors.Errorf("registering watched files: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -249,7 +425,61 @@ func (s *Server) Shutdown(ctx context.Context) error {
 }
 
 func (s *Server) CodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("code action request received: %+v", params)
+
+	if len(params.Context.Only) > 0 && !slices.Contains(params.Context.Only, protocol.QuickFix) {
+		return nil, nil
+	}
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	diagnostics, err := s.templateDiagnostics(ctx, params.TextDocument.URI, doc.Content)
+	if err != nil {
+		return nil, errors.Errorf("identifying diagnostics for code actions: %w", err)
+	}
+
+	actions := []protocol.CodeAction{}
+	for _, d := range diagnostics {
+		if len(d.Suggestions) == 0 {
+			continue
+		}
+
+		lspDiagnostic := toLSPDiagnostic(d, doc.Content)
+		if !rangesOverlap(lspDiagnostic.Range, params.Range) {
+			continue
+		}
+
+		// "did you mean" fixes replace the misspelled part, best suggestion first
+		for i, suggestion := range d.Suggestions {
+			actions = append(actions, protocol.CodeAction{
+				Title:       fmt.Sprintf("Change to %s", suggestion),
+				Kind:        protocol.QuickFix,
+				Diagnostics: []protocol.Diagnostic{lspDiagnostic},
+				IsPreferred: i == 0,
+				Edit: &protocol.WorkspaceEdit{
+					Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+						params.TextDocument.URI: {
+							{Range: d.SuggestionLocation.ToLSPRange(doc.Content), NewText: suggestion},
+						},
+					},
+				},
+			})
+		}
+	}
+
+	return actions, nil
+}
+
+// rangesOverlap reports whether two ranges overlap or touch, e.g. a cursor at the end of a diagnostic
+func rangesOverlap(a, b protocol.Range) bool {
+	return !positionBefore(a.End, b.Start) && !positionBefore(b.End, a.Start)
+}
+
+func positionBefore(a, b protocol.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
 }
 
 func (s *Server) CodeLens(ctx context.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
@@ -261,7 +491,53 @@ func (s *Server) ColorPresentation(ctx context.Context, params *protocol.ColorPr
 }
 
 func (s *Server) Completion(ctx context.Context, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("completion request received: %+v", params)
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for completion: %w", err)
+	}
+
+	pos := position.NewRawPositionFromLineAndColumn(int(params.Position.Line), int(params.Position.Character), "", doc.Content)
+
+	items, err := completion.GetCompletions(ctx, uripath, doc.Content, pos, reg)
+	if err != nil {
+		return nil, errors.Errorf("getting completions: %w", err)
+	}
+
+	result := &protocol.CompletionList{
+		Items: make([]protocol.CompletionItem, len(items)),
+	}
+
+	for i, item := range items {
+		kind := protocol.FieldCompletion
+		switch item.Kind {
+		case completion.KindMethod:
+			kind = protocol.MethodCompletion
+		case completion.KindFunction:
+			kind = protocol.FunctionCompletion
+		}
+		result.Items[i] = protocol.CompletionItem{
+			Label:  item.Label,
+			Kind:   kind,
+			Detail: item.Detail,
+			Documentation: &protocol.Or_CompletionItem_documentation{
+				Value: item.Documentation,
+			},
+		}
+	}
+
+	return result, nil
 }
 
 func (s *Server) Declaration(ctx context.Context, params *protocol.DeclarationParams) (*protocol.Or_textDocument_declaration, error) {
@@ -269,7 +545,44 @@ func (s *Server) Declaration(ctx context.Context, params *protocol.DeclarationPa
 }
 
 func (s *Server) Definition(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.Location, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("definition request received: %+v", params)
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for definition: %w", err)
+	}
+
+	info, err := parseTemplate(ctx, uripath, doc.Content, reg)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for definition: %w", err)
+	}
+
+	pos := position.NewRawPositionFromLineAndColumn(int(params.Position.Line), int(params.Position.Character), "", doc.Content)
+
+	locs, err := definition.FindDefinition(ctx, info, pos, reg)
+	if err != nil {
+		return nil, errors.Errorf("finding definition: %w", err)
+	}
+
+	result := make([]protocol.Location, len(locs))
+	for i, loc := range locs {
+		result[i] = protocol.Location{
+			URI:   ToDocURI(loc.File),
+			Range: loc.Range.ToLSPRange(),
+		}
+	}
+
+	return result, nil
 }
 
 func (s *Server) Diagnostic(ctx context.Context, params *protocol.DocumentDiagnosticParams) (*protocol.DocumentDiagnosticReport, error) {
@@ -284,18 +597,81 @@ func (s *Server) Diagnostic(ctx context.Context, params *protocol.DocumentDiagno
 		return nil, errors.Errorf("identifying diagnostics: %w", err)
 	}
 
+	resultID := diagnosticsResultID(diagnostics)
+	if params.PreviousResultID == resultID {
+		return &protocol.DocumentDiagnosticReport{
+			Value: protocol.RelatedUnchangedDocumentDiagnosticReport{
+				UnchangedDocumentDiagnosticReport: protocol.UnchangedDocumentDiagnosticReport{
+					Kind:     string(protocol.DiagnosticUnchanged),
+					ResultID: resultID,
+				},
+			},
+		}, nil
+	}
+
 	return &protocol.DocumentDiagnosticReport{
 		Value: protocol.RelatedFullDocumentDiagnosticReport{
 
 			FullDocumentDiagnosticReport: protocol.FullDocumentDiagnosticReport{
-				Items: diagnostics,
+				Kind:     string(protocol.DiagnosticFull),
+				ResultID: resultID,
+				Items:    diagnostics,
 			},
 		},
 	}, nil
 }
 
+// DiagnosticWorkspace reports the diagnostics of every template of the workspace, including those that
+// are not open. Templates whose diagnostics did not change since the result ids sent by the client are
+// reported as unchanged.
 func (s *Server) DiagnosticWorkspace(ctx context.Context, params *protocol.WorkspaceDiagnosticParams) (*protocol.WorkspaceDiagnosticReport, error) {
-	return nil, nil // Not implemented yet
+	logger := zerolog.Ctx(ctx)
+
+	previous := map[string]string{}
+	for _, result := range params.PreviousResultIds {
+		previous[normalizeURI(string(result.URI))] = result.Value
+	}
+
+	report := &protocol.WorkspaceDiagnosticReport{
+		Items: []protocol.WorkspaceDocumentDiagnosticReport{},
+	}
+
+	for _, tmpl := range s.workspaceTemplates(ctx) {
+		diagnostics, err := s.identifyDiagnosticsForFile(ctx, tmpl.uri, tmpl.content)
+		if err != nil {
+			logger.Error().Err(err).Str("uri", string(tmpl.uri)).Msg("failed to identify diagnostics")
+			continue
+		}
+
+		resultID := diagnosticsResultID(diagnostics)
+		if previous[normalizeURI(string(tmpl.uri))] == resultID {
+			report.Items = append(report.Items, protocol.WorkspaceDocumentDiagnosticReport{
+				Value: protocol.WorkspaceUnchangedDocumentDiagnosticReport{
+					URI:     tmpl.uri,
+					Version: tmpl.version,
+					UnchangedDocumentDiagnosticReport: protocol.UnchangedDocumentDiagnosticReport{
+						Kind:     string(protocol.DiagnosticUnchanged),
+						ResultID: resultID,
+					},
+				},
+			})
+			continue
+		}
+
+		report.Items = append(report.Items, protocol.WorkspaceDocumentDiagnosticReport{
+			Value: protocol.WorkspaceFullDocumentDiagnosticReport{
+				URI:     tmpl.uri,
+				Version: tmpl.version,
+				FullDocumentDiagnosticReport: protocol.FullDocumentDiagnosticReport{
+					Kind:     string(protocol.DiagnosticFull),
+					ResultID: resultID,
+					Items:    diagnostics,
+				},
+			},
+		})
+	}
+
+	return report, nil
 }
 
 func (s *Server) DidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
@@ -335,15 +711,73 @@ func replaceContentFromRange(ctx context.Context, content string, rangez *protoc
 }
 
 func (s *Server) DidChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
-	return nil // Not implemented yet
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Interface("settings", params.Settings).Msg("configuration changed")
+
+	cfg, err := parseConfig(params.Settings)
+	if err != nil {
+		return errors.Errorf("parsing configuration: %w", err)
+	}
+
+	s.setConfig(cfg)
+
+	// the diagnostics of every template depend on the configuration
+	s.refreshWorkspaceDiagnostics(ctx)
+
+	return nil
 }
 
 func (s *Server) DidChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
-	return nil // Not implemented yet
+	logger := zerolog.Ctx(ctx)
+
+	for _, change := range params.Changes {
+		path := normalizeURI(string(change.URI))
+		logger.Debug().Str("path", path).Uint32("type", uint32(change.Type)).Msg("watched file changed")
+
+		// saving a template does not change any Go types, so the packages that embed it are kept
+		if change.Type == protocol.Changed && !isGoFile(path) {
+			found, err := s.registries.ReloadTemplateFile(path)
+			if err != nil {
+				logger.Warn().Err(err).Str("path", path).Msg("failed to reload template file")
+			} else if found {
+				continue
+			}
+		}
+
+		s.registries.Invalidate(path)
+	}
+
+	// the diagnostics of every template depend on the packages, including templates that are not open
+	s.refreshWorkspaceDiagnostics(ctx)
+
+	return nil
 }
 
 func (s *Server) DidChangeWorkspaceFolders(ctx context.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
-	return nil // Not implemented yet
+	s.workspaceMu.Lock()
+	folders := slices.Clone(s.workspaceFolders)
+	s.workspaceMu.Unlock()
+
+	for _, folder := range params.Event.Removed {
+		s.registries.Invalidate(normalizeURI(folder.URI))
+		folders = slices.DeleteFunc(folders, func(f string) bool { return f == normalizeURI(folder.URI) })
+	}
+	for _, folder := range params.Event.Added {
+		folders = append(folders, normalizeURI(folder.URI))
+	}
+
+	s.setWorkspaceFolders(folders)
+
+	return nil
+}
+
+// isGoFile reports whether a change to the file can change the loaded packages
+func isGoFile(path string) bool {
+	switch filepath.Base(path) {
+	case "go.mod", "go.sum", "go.work", "go.work.sum":
+		return true
+	}
+	return strings.HasSuffix(path, ".go")
 }
 
 func (s *Server) DidClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) error {
@@ -427,7 +861,51 @@ func (s *Server) DocumentLink(ctx context.Context, params *protocol.DocumentLink
 }
 
 func (s *Server) DocumentSymbol(ctx context.Context, params *protocol.DocumentSymbolParams) ([]any, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("document symbol request received: %+v", params)
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	info, err := s.parseDocument(ctx, params.TextDocument.URI.Path(), doc.Content)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for document symbols: %w", err)
+	}
+
+	syms, err := symbols.GetDocumentSymbols(ctx, info)
+	if err != nil {
+		return nil, errors.Errorf("building document symbols: %w", err)
+	}
+
+	result := make([]any, 0, len(syms))
+	for _, sym := range toLSPDocumentSymbols(syms) {
+		result = append(result, sym)
+	}
+
+	return result, nil
+}
+
+// symbolKinds maps the kinds of template symbols to the closest LSP symbol kinds
+var symbolKinds = map[string]protocol.SymbolKind{
+	symbols.KindTemplate: protocol.Function,
+	symbols.KindControl:  protocol.Namespace,
+	symbols.KindVariable: protocol.Variable,
+}
+
+func toLSPDocumentSymbols(syms []symbols.Symbol) []protocol.DocumentSymbol {
+	result := make([]protocol.DocumentSymbol, 0, len(syms))
+	for _, sym := range syms {
+		result = append(result, protocol.DocumentSymbol{
+			Name:           sym.Name,
+			Detail:         sym.Detail,
+			Kind:           symbolKinds[sym.Kind],
+			Range:          sym.Range.ToLSPRange(),
+			SelectionRange: sym.SelectionRange.ToLSPRange(),
+			Children:       toLSPDocumentSymbols(sym.Children),
+		})
+	}
+	return result
 }
 
 func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCommandParams) (any, error) {
@@ -435,11 +913,77 @@ func (s *Server) ExecuteCommand(ctx context.Context, params *protocol.ExecuteCom
 }
 
 func (s *Server) FoldingRange(ctx context.Context, params *protocol.FoldingRangeParams) ([]protocol.FoldingRange, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("folding range request received: %+v", params)
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	info, err := s.parseDocument(ctx, params.TextDocument.URI.Path(), doc.Content)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for folding ranges: %w", err)
+	}
+
+	ranges, err := folding.GetFoldingRanges(ctx, info)
+	if err != nil {
+		return nil, errors.Errorf("building folding ranges: %w", err)
+	}
+
+	result := make([]protocol.FoldingRange, 0, len(ranges))
+	for _, rng := range ranges {
+		result = append(result, protocol.FoldingRange{
+			StartLine: uint32(rng.StartLine),
+			EndLine:   uint32(rng.EndLine),
+			Kind:      rng.Kind,
+		})
+	}
+
+	return result, nil
 }
 
 func (s *Server) Formatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("formatting request received: %+v", params)
+
+	edits, err := s.formattingEdits(ctx, params.TextDocument.URI, params.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return toLSPTextEdits(edits), nil
+}
+
+// formattingEdits returns the edits that format a document. Templates that do not parse are
+// not formatted, their errors are already reported as diagnostics.
+func (s *Server) formattingEdits(ctx context.Context, uri protocol.DocumentURI, options protocol.FormattingOptions) ([]formatter.TextEdit, error) {
+	doc, ok := s.documents.Get(uri)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", uri)
+	}
+
+	opts := formatter.Options{Indent: "\t"}
+	if options.InsertSpaces && options.TabSize > 0 {
+		opts.Indent = strings.Repeat(" ", int(options.TabSize))
+	}
+
+	edits, err := formatter.Edits(ctx, uri.Path(), doc.Content, opts)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("uri", string(uri)).Msg("not formatting template")
+		return nil, nil
+	}
+
+	return edits, nil
+}
+
+func toLSPTextEdits(edits []formatter.TextEdit) []protocol.TextEdit {
+	result := make([]protocol.TextEdit, 0, len(edits))
+	for _, edit := range edits {
+		result = append(result, protocol.TextEdit{
+			Range:   edit.Range.ToLSPRange(),
+			NewText: edit.NewText,
+		})
+	}
+	return result
 }
 
 func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
@@ -456,7 +1000,7 @@ func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*prot
 		uripath: []byte(doc.Content),
 	}
 
-	reg, err := ast.AnalyzePackage(ctx, uripath, overlay)
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
 	if err != nil {
 		return nil, errors.Errorf("analyzing package for hover: %w", err)
 	}
@@ -467,7 +1011,7 @@ func (s *Server) Hover(ctx context.Context, params *protocol.HoverParams) (*prot
 	}
 
 	// Parse the template
-	info, err := parser.Parse(ctx, uripath, []byte(content))
+	info, err := parseTemplate(ctx, uripath, content, reg)
 	if err != nil {
 		return nil, errors.Errorf("parsing template for hover: %w", err)
 	}
@@ -506,7 +1050,55 @@ func (s *Server) Implementation(ctx context.Context, params *protocol.Implementa
 }
 
 func (s *Server) InlayHint(ctx context.Context, params *protocol.InlayHintParams) ([]protocol.InlayHint, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("inlay hint request received: %+v", params)
+
+	opts := s.Config().InlayHints
+	if !opts.VariableTypes && !opts.PipelineTypes && !opts.RangeTypes {
+		return nil, nil
+	}
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for inlay hints: %w", err)
+	}
+
+	info, err := parseTemplate(ctx, uripath, doc.Content, reg)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for inlay hints: %w", err)
+	}
+
+	hints, err := inlay.GetInlayHints(ctx, info, reg, opts)
+	if err != nil {
+		return nil, errors.Errorf("building inlay hints: %w", err)
+	}
+
+	result := []protocol.InlayHint{}
+	for _, hint := range hints {
+		pos := protocol.Position{
+			Line:      uint32(hint.Position.Line),
+			Character: uint32(hint.Position.Character),
+		}
+		if positionBefore(pos, params.Range.Start) || positionBefore(params.Range.End, pos) {
+			continue
+		}
+		result = append(result, protocol.InlayHint{
+			Position: pos,
+			Label:    []protocol.InlayHintLabelPart{{Value: hint.Label}},
+			Kind:     protocol.Type,
+		})
+	}
+
+	return result, nil
 }
 
 func (s *Server) InlineCompletion(ctx context.Context, params *protocol.InlineCompletionParams) (*protocol.Or_Result_textDocument_inlineCompletion, error) {
@@ -525,8 +1117,21 @@ func (s *Server) Moniker(ctx context.Context, params *protocol.MonikerParams) ([
 	return nil, nil // Not implemented yet
 }
 
+// OnTypeFormatting formats the line of an action when its closing "}}" is typed
 func (s *Server) OnTypeFormatting(ctx context.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("on type formatting request received: %+v", params)
+
+	edits, err := s.formattingEdits(ctx, params.TextDocument.URI, params.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	line := position.Range{
+		Start: position.Place{Line: int(params.Position.Line)},
+		End:   position.Place{Line: int(params.Position.Line), Character: int(params.Position.Character)},
+	}
+
+	return toLSPTextEdits(formatter.InRange(edits, line)), nil
 }
 
 func (s *Server) PrepareCallHierarchy(ctx context.Context, params *protocol.CallHierarchyPrepareParams) ([]protocol.CallHierarchyItem, error) {
@@ -534,7 +1139,39 @@ func (s *Server) PrepareCallHierarchy(ctx context.Context, params *protocol.Call
 }
 
 func (s *Server) PrepareRename(ctx context.Context, params *protocol.PrepareRenameParams) (*protocol.PrepareRenameResult, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("prepare rename request received: %+v", params)
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for prepare rename: %w", err)
+	}
+
+	info, err := parseTemplate(ctx, uripath, doc.Content, reg)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for prepare rename: %w", err)
+	}
+
+	pos := position.NewRawPositionFromLineAndColumn(int(params.Position.Line), int(params.Position.Character), "", doc.Content)
+
+	target, err := rename.PrepareRename(ctx, info, pos, reg)
+	if err != nil {
+		return nil, errors.Errorf("preparing rename: %w", err)
+	}
+
+	return &protocol.PrepareRenameResult{
+		Range:       target.Range.ToLSPRange(),
+		Placeholder: target.Object.Name(),
+	}, nil
 }
 
 func (s *Server) PrepareTypeHierarchy(ctx context.Context, params *protocol.TypeHierarchyPrepareParams) ([]protocol.TypeHierarchyItem, error) {
@@ -542,23 +1179,185 @@ func (s *Server) PrepareTypeHierarchy(ctx context.Context, params *protocol.Type
 }
 
 func (s *Server) RangeFormatting(ctx context.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("range formatting request received: %+v", params)
+
+	edits, err := s.formattingEdits(ctx, params.TextDocument.URI, params.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return toLSPTextEdits(formatter.InRange(edits, position.NewRangeFromLSPRange(params.Range))), nil
 }
 
 func (s *Server) RangesFormatting(ctx context.Context, params *protocol.DocumentRangesFormattingParams) ([]protocol.TextEdit, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("ranges formatting request received: %+v", params)
+
+	edits, err := s.formattingEdits(ctx, params.TextDocument.URI, params.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	// an edit can touch more than one range, so the edits are filtered instead of collected per range
+	selected := []formatter.TextEdit{}
+	for _, edit := range edits {
+		for _, rng := range params.Ranges {
+			if len(formatter.InRange([]formatter.TextEdit{edit}, position.NewRangeFromLSPRange(rng))) > 0 {
+				selected = append(selected, edit)
+				break
+			}
+		}
+	}
+
+	return toLSPTextEdits(selected), nil
 }
 
 func (s *Server) References(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("references request received: %+v", params)
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for references: %w", err)
+	}
+
+	info, err := parseTemplate(ctx, uripath, doc.Content, reg)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for references: %w", err)
+	}
+
+	pos := position.NewRawPositionFromLineAndColumn(int(params.Position.Line), int(params.Position.Character), "", doc.Content)
+
+	obj, err := definition.ResolveObjectAtPosition(ctx, info, pos, reg)
+	if err != nil {
+		return nil, errors.Errorf("resolving object for references: %w", err)
+	}
+
+	if obj == nil {
+		return nil, nil
+	}
+
+	idx, err := references.BuildIndex(ctx, reg)
+	if err != nil {
+		return nil, errors.Errorf("building references index: %w", err)
+	}
+
+	locs := idx.References(obj)
+
+	if params.Context.IncludeDeclaration {
+		decl, err := definition.NewLocationFromObject(reg, obj)
+		if err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Msgf("declaration of %s not found", obj.Name())
+		} else {
+			locs = append([]definition.Location{decl}, locs...)
+		}
+	}
+
+	result := make([]protocol.Location, len(locs))
+	for i, loc := range locs {
+		result[i] = protocol.Location{
+			URI:   ToDocURI(loc.File),
+			Range: loc.Range.ToLSPRange(),
+		}
+	}
+
+	return result, nil
 }
 
 func (s *Server) Rename(ctx context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("rename request received: %+v", params)
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for rename: %w", err)
+	}
+
+	info, err := parseTemplate(ctx, uripath, doc.Content, reg)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for rename: %w", err)
+	}
+
+	pos := position.NewRawPositionFromLineAndColumn(int(params.Position.Line), int(params.Position.Character), "", doc.Content)
+
+	edits, err := rename.Rename(ctx, info, pos, reg, params.NewName)
+	if err != nil {
+		return nil, errors.Errorf("renaming: %w", err)
+	}
+
+	result := &protocol.WorkspaceEdit{
+		Changes: make(map[protocol.DocumentURI][]protocol.TextEdit, len(edits)),
+	}
+
+	for file, fileEdits := range edits {
+		uri := ToDocURI(file)
+		for _, edit := range fileEdits {
+			result.Changes[uri] = append(result.Changes[uri], protocol.TextEdit{
+				Range:   edit.Range.ToLSPRange(),
+				NewText: edit.NewText,
+			})
+		}
+	}
+
+	return result, nil
 }
 
 func (s *Server) SelectionRange(ctx context.Context, params *protocol.SelectionRangeParams) ([]protocol.SelectionRange, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("selection range request received: %+v", params)
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+
+	info, err := s.parseDocument(ctx, params.TextDocument.URI.Path(), doc.Content)
+	if err != nil {
+		return nil, errors.Errorf("parsing template for selection ranges: %w", err)
+	}
+
+	places := make([]position.Place, 0, len(params.Positions))
+	for _, pos := range params.Positions {
+		places = append(places, position.Place{Line: int(pos.Line), Character: int(pos.Character)})
+	}
+
+	ranges, err := selection.GetSelectionRanges(ctx, info, places)
+	if err != nil {
+		return nil, errors.Errorf("building selection ranges: %w", err)
+	}
+
+	result := make([]protocol.SelectionRange, 0, len(ranges))
+	for _, rng := range ranges {
+		result = append(result, *toLSPSelectionRange(rng))
+	}
+
+	return result, nil
+}
+
+func toLSPSelectionRange(rng *selection.SelectionRange) *protocol.SelectionRange {
+	if rng == nil {
+		return nil
+	}
+	return &protocol.SelectionRange{
+		Range:  rng.Range.ToLSPRange(),
+		Parent: toLSPSelectionRange(rng.Parent),
+	}
 }
 
 func (s *Server) SemanticTokensFull(ctx context.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
@@ -650,7 +1449,57 @@ func (s *Server) SemanticTokensRange(ctx context.Context, params *protocol.Seman
 }
 
 func (s *Server) SignatureHelp(ctx context.Context, params *protocol.SignatureHelpParams) (*protocol.SignatureHelp, error) {
-	return nil, nil // Not implemented yet
+	zerolog.Ctx(ctx).Trace().Msgf("signature help request received: %+v", params)
+
+	uripath := params.TextDocument.URI.Path()
+
+	doc, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil, errors.Errorf("document not found: %s", params.TextDocument.URI)
+	}
+	overlay := map[string][]byte{
+		uripath: []byte(doc.Content),
+	}
+
+	reg, err := s.analyzePackage(ctx, uripath, overlay)
+	if err != nil {
+		return nil, errors.Errorf("analyzing package for signature help: %w", err)
+	}
+
+	pos := position.NewRawPositionFromLineAndColumn(int(params.Position.Line), int(params.Position.Character), "", doc.Content)
+
+	sig, err := completion.GetSignatureHelp(ctx, uripath, doc.Content, pos, reg)
+	if err != nil {
+		return nil, errors.Errorf("getting signature help: %w", err)
+	}
+	if sig == nil {
+		return nil, nil
+	}
+
+	parameters := make([]protocol.ParameterInformation, len(sig.Parameters))
+	for i, param := range sig.Parameters {
+		parameters[i] = protocol.ParameterInformation{
+			Label:         param.Label,
+			Documentation: param.Documentation,
+		}
+	}
+
+	return &protocol.SignatureHelp{
+		Signatures: []protocol.SignatureInformation{
+			{
+				Label: sig.Label,
+				Documentation: &protocol.Or_SignatureInformation_documentation{
+					Value: protocol.MarkupContent{
+						Kind:  protocol.Markdown,
+						Value: sig.Documentation,
+					},
+				},
+				Parameters:      parameters,
+				ActiveParameter: uint32(sig.ActiveParameter),
+			},
+		},
+		ActiveParameter: uint32(sig.ActiveParameter),
+	}, nil
 }
 
 func (s *Server) Subtypes(ctx context.Context, params *protocol.TypeHierarchySubtypesParams) ([]protocol.TypeHierarchyItem, error) {
@@ -702,6 +1551,22 @@ func (s *Server) ResolveWorkspaceSymbol(ctx context.Context, params *protocol.Wo
 }
 
 func (s *Server) identifyDiagnosticsForFile(ctx context.Context, urid protocol.DocumentURI, content string) ([]protocol.Diagnostic, error) {
+	diagnostics, err := s.templateDiagnostics(ctx, urid, content)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []protocol.Diagnostic = make([]protocol.Diagnostic, len(diagnostics))
+
+	for i, d := range diagnostics {
+		result[i] = toLSPDiagnostic(d, content)
+	}
+
+	return result, nil
+}
+
+// templateDiagnostics type checks a template against the package it belongs to
+func (s *Server) templateDiagnostics(ctx context.Context, urid protocol.DocumentURI, content string) ([]*diagnostic.Diagnostic, error) {
 	logger := zerolog.Ctx(ctx)
 	uri := normalizeURI(string(urid))
 	logger.Debug().Str("uri", uri).Msg("validating document")
@@ -711,12 +1576,12 @@ func (s *Server) identifyDiagnosticsForFile(ctx context.Context, urid protocol.D
 		urid.Path(): []byte(content),
 	}
 
-	registry, err := ast.AnalyzePackage(ctx, uri, overlay)
+	registry, err := s.analyzePackage(ctx, uri, overlay)
 	if err != nil {
 		return nil, errors.Errorf("analyzing package: %w", err)
 	}
 
-	nodes, err := parser.Parse(ctx, uri, []byte(content))
+	nodes, err := parseTemplate(ctx, uri, content, registry)
 	if err != nil {
 		return nil, errors.Errorf("parsing template for validation: %w", err)
 	}
@@ -726,35 +1591,41 @@ func (s *Server) identifyDiagnosticsForFile(ctx context.Context, urid protocol.D
 		return nil, errors.Errorf("getting diagnostics: %w", err)
 	}
 
-	var result []protocol.Diagnostic = make([]protocol.Diagnostic, len(diagnostics))
+	return diagnostics, nil
+}
 
-	for i, d := range diagnostics {
-		result[i] = protocol.Diagnostic{
-			Range: protocol.Range{
-				Start: protocol.Position{
-					Line:      uint32(d.Location.GetRange(content).Start.Line),
-					Character: uint32(d.Location.GetRange(content).Start.Character),
-				},
-				End: protocol.Position{
-					Line:      uint32(d.Location.GetRange(content).End.Line),
-					Character: uint32(d.Location.GetRange(content).End.Character),
-				},
+func toLSPDiagnostic(d *diagnostic.Diagnostic, content string) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocol.Position{
+				Line:      uint32(d.Location.GetRange(content).Start.Line),
+				Character: uint32(d.Location.GetRange(content).Start.Character),
 			},
-			Severity: protocol.DiagnosticSeverity(d.Severity),
-			Message:  d.Message,
-		}
+			End: protocol.Position{
+				Line:      uint32(d.Location.GetRange(content).End.Line),
+				Character: uint32(d.Location.GetRange(content).End.Character),
+			},
+		},
+		Severity: protocol.DiagnosticSeverity(d.Severity),
+		Message:  d.Message,
 	}
-
-	return result, nil
 }
 
+// publishDiagnostics sends the diagnostics of a document to clients that do not pull them
 func (s *Server) publishDiagnostics(ctx context.Context, uri protocol.DocumentURI, content string) error {
+	if s.pullDiagnostics() {
+		return nil
+	}
 
 	diagnostics, err := s.identifyDiagnosticsForFile(ctx, uri, content)
 	if err != nil {
 		return errors.Errorf("identifying diagnostics: %w", err)
 	}
 
+	return s.sendDiagnostics(ctx, uri, diagnostics)
+}
+
+func (s *Server) sendDiagnostics(ctx context.Context, uri protocol.DocumentURI, diagnostics []protocol.Diagnostic) error {
 	params := &protocol.PublishDiagnosticsParams{
 		URI:         uri,
 		Diagnostics: diagnostics,
@@ -763,7 +1634,10 @@ func (s *Server) publishDiagnostics(ctx context.Context, uri protocol.DocumentUR
 	zerolog.Ctx(ctx).Debug().Msgf("found diagnostics: %+v", params)
 
 	if s.callbackClient != nil {
-		return s.callbackClient.PublishDiagnostics(ctx, params)
+		if err := s.callbackClient.PublishDiagnostics(ctx, params); err != nil {
+			return err
+		}
+		s.setPublishedResultID(uri, diagnosticsResultID(diagnostics))
 	} else {
 		zerolog.Ctx(ctx).Warn().Msg("no callback client, skipping publish diagnostics")
 	}
@@ -2,6 +2,7 @@ package lsp_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -173,6 +174,725 @@ type Person struct {
 		}
 		require.Equal(t, expectedDiag, params.Diagnostics)
 	})
+
+	t.Run("configuration_enables_function_sets", func(t *testing.T) {
+
+		files := map[string]string{
+			"go.mod": "module test",
+			"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Person struct {
+	Name string
+}`,
+			"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Name | b64enc }}`,
+		}
+
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		errorMessages := func(p *protocol.PublishDiagnosticsParams) []string {
+			msgs := []string{}
+			for _, d := range p.Diagnostics {
+				if d.Severity == protocol.SeverityError {
+					msgs = append(msgs, d.Message)
+				}
+			}
+			return msgs
+		}
+
+		var params *protocol.PublishDiagnosticsParams
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.MatchedBy(func(p *protocol.PublishDiagnosticsParams) bool {
+			return p.URI != toDocURI("test.tmpl")
+		})).Return(nil).Maybe()
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.MatchedBy(func(p *protocol.PublishDiagnosticsParams) bool {
+			params = p
+			return p.URI == toDocURI("test.tmpl")
+		})).Return(nil).Twice()
+
+		err := server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{
+			Settings: map[string]any{"gotmpls": map[string]any{"functionSets": []string{}}},
+		})
+		require.NoError(t, err, "configuration change should succeed")
+		require.Equal(t, []string{"method b64enc not found"}, errorMessages(params))
+
+		err = server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{
+			Settings: map[string]any{"gotmpls": map[string]any{"functionSets": []string{"sprig"}}},
+		})
+		require.NoError(t, err, "configuration change should succeed")
+		require.Empty(t, errorMessages(params), "sprig functions should be known")
+		require.Equal(t, []string{"sprig"}, server.Config().FunctionSets)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("watched_go_file_change_reloads_packages", func(t *testing.T) {
+
+		files := map[string]string{
+			"go.mod": "module test",
+			"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Person struct {
+	Name string
+}`,
+			"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Age }}`,
+		}
+
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		// the go file is changed on disk, not in the editor
+		err := server.DidClose(ctx, &protocol.DidCloseTextDocumentParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.go")},
+		})
+		require.NoError(t, err)
+
+		var params *protocol.PublishDiagnosticsParams
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.MatchedBy(func(p *protocol.PublishDiagnosticsParams) bool {
+			return p.URI != toDocURI("test.tmpl")
+		})).Return(nil).Maybe()
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.MatchedBy(func(p *protocol.PublishDiagnosticsParams) bool {
+			params = p
+			return p.URI == toDocURI("test.tmpl")
+		})).Return(nil).Twice()
+
+		err = server.DidChangeWatchedFiles(ctx, &protocol.DidChangeWatchedFilesParams{})
+		require.NoError(t, err)
+		require.Len(t, params.Diagnostics, 2, "the missing field should be reported")
+
+		err = os.WriteFile(toDocURI("test.go").Path(), []byte(`package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Person struct {
+	Name string
+	Age  int
+}`), 0644)
+		require.NoError(t, err)
+
+		err = server.DidChangeWatchedFiles(ctx, &protocol.DidChangeWatchedFilesParams{
+			Changes: []protocol.FileEvent{{URI: toDocURI("test.go"), Type: protocol.Changed}},
+		})
+		require.NoError(t, err)
+		require.Len(t, params.Diagnostics, 1, "the field should be found after the packages are reloaded")
+		require.Equal(t, protocol.SeverityInformation, params.Diagnostics[0].Severity)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerCompletion(t *testing.T) {
+
+	t.Run("completion_shows_nested_fields", func(t *testing.T) {
+
+		files := map[string]string{
+			"go.mod": "module test",
+			"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Address struct {
+	Street string
+	City   string
+}
+
+type Person struct {
+	Name    string
+	Address Address
+}`,
+			"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Address. }}`,
+		}
+
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		completionResult, err := server.Completion(ctx, &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{
+					URI: toDocURI("test.tmpl"),
+				},
+				Position: protocol.Position{Line: 1, Character: 12},
+			},
+		})
+		require.NoError(t, err, "completion should succeed")
+		require.NotNil(t, completionResult, "completion result should not be nil")
+		require.Len(t, completionResult.Items, 2, "should have two completion items")
+		require.Equal(t, "City", completionResult.Items[0].Label)
+		require.Equal(t, protocol.FieldCompletion, completionResult.Items[0].Kind)
+		require.Equal(t, "string", completionResult.Items[0].Detail)
+		require.Equal(t, "Street", completionResult.Items[1].Label)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerDefinition(t *testing.T) {
+
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Address struct {
+	Street string
+	City   string
+}
+
+type Person struct {
+	Name    string
+	Address Address
+}`,
+		"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Address.City }}
+{{ template "footer" }}
+{{ define "footer" }}bye{{ end }}`,
+	}
+
+	tests := []struct {
+		name      string
+		position  protocol.Position
+		wantFile  string
+		wantRange protocol.Range
+	}{
+		{
+			name:      "nested_field_resolves_to_struct_field",
+			position:  protocol.Position{Line: 1, Character: 13},
+			wantFile:  "test.go",
+			wantRange: protocol.Range{Start: protocol.Position{Line: 8, Character: 1}, End: protocol.Position{Line: 8, Character: 5}},
+		},
+		{
+			name:      "parent_field_resolves_to_struct_field",
+			position:  protocol.Position{Line: 1, Character: 5},
+			wantFile:  "test.go",
+			wantRange: protocol.Range{Start: protocol.Position{Line: 13, Character: 1}, End: protocol.Position{Line: 13, Character: 8}},
+		},
+		{
+			name:      "type_hint_resolves_to_named_type",
+			position:  protocol.Position{Line: 0, Character: 22},
+			wantFile:  "test.go",
+			wantRange: protocol.Range{Start: protocol.Position{Line: 11, Character: 5}, End: protocol.Position{Line: 11, Character: 11}},
+		},
+		{
+			name:      "template_call_resolves_to_define",
+			position:  protocol.Position{Line: 2, Character: 14},
+			wantFile:  "test.tmpl",
+			wantRange: protocol.Range{Start: protocol.Position{Line: 3, Character: 0}, End: protocol.Position{Line: 3, Character: 21}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+			locs, err := server.Definition(ctx, &protocol.DefinitionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{
+						URI: toDocURI("test.tmpl"),
+					},
+					Position: tt.position,
+				},
+			})
+			require.NoError(t, err, "definition should succeed")
+			require.Len(t, locs, 1, "should have one location")
+			require.Equal(t, toDocURI(tt.wantFile), locs[0].URI)
+			require.Equal(t, tt.wantRange, locs[0].Range)
+
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMockServerReferences(t *testing.T) {
+
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import _ "embed"
+
+//go:embed test.tmpl
+var TestTemplate string
+
+//go:embed other.tmpl
+var OtherTemplate string
+
+type Person struct {
+	Name  string
+	Email string
+}`,
+		"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Email }}`,
+		"other.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Name }} <{{ .Email }}>`,
+	}
+
+	ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+	locs, err := server.References(ctx, &protocol.ReferenceParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: toDocURI("test.tmpl"),
+			},
+			Position: protocol.Position{Line: 1, Character: 5},
+		},
+		Context: protocol.ReferenceContext{IncludeDeclaration: true},
+	})
+	require.NoError(t, err, "references should succeed")
+
+	want := []protocol.Location{
+		{URI: toDocURI("test.go"), Range: protocol.Range{Start: protocol.Position{Line: 12, Character: 1}, End: protocol.Position{Line: 12, Character: 6}}},
+		{URI: toDocURI("other.tmpl"), Range: protocol.Range{Start: protocol.Position{Line: 1, Character: 17}, End: protocol.Position{Line: 1, Character: 22}}},
+		{URI: toDocURI("test.tmpl"), Range: protocol.Range{Start: protocol.Position{Line: 1, Character: 4}, End: protocol.Position{Line: 1, Character: 9}}},
+	}
+	require.Equal(t, want, locs)
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestMockServerRename(t *testing.T) {
+
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import _ "embed"
+
+//go:embed test.tmpl
+var TestTemplate string
+
+//go:embed other.tmpl
+var OtherTemplate string
+
+type Person struct {
+	Name  string
+	Email string
+}
+
+func (p Person) Contact() string {
+	return p.Name + " <" + p.Email + ">"
+}`,
+		"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Email }}`,
+		"other.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Name }} <{{ .Email }}>`,
+	}
+
+	t.Run("rename_updates_go_and_templates", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		edit, err := server.Rename(ctx, &protocol.RenameParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: toDocURI("test.tmpl"),
+			},
+			Position: protocol.Position{Line: 1, Character: 5},
+			NewName:  "EmailAddress",
+		})
+		require.NoError(t, err, "rename should succeed")
+
+		rng := func(line, start, end uint32) protocol.Range {
+			return protocol.Range{Start: protocol.Position{Line: line, Character: start}, End: protocol.Position{Line: line, Character: end}}
+		}
+
+		want := map[protocol.DocumentURI][]protocol.TextEdit{
+			toDocURI("test.go"):    {{Range: rng(12, 1, 6), NewText: "EmailAddress"}, {Range: rng(16, 26, 31), NewText: "EmailAddress"}},
+			toDocURI("test.tmpl"):  {{Range: rng(1, 4, 9), NewText: "EmailAddress"}},
+			toDocURI("other.tmpl"): {{Range: rng(1, 17, 22), NewText: "EmailAddress"}},
+		}
+		require.Equal(t, want, edit.Changes)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("prepare_rename_refuses_builtins", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"go.mod":  files["go.mod"],
+			"test.go": files["test.go"],
+			"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Email | upper }}`,
+			"other.tmpl": files["other.tmpl"],
+		})
+
+		_, err := server.PrepareRename(ctx, &protocol.PrepareRenameParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{
+					URI: toDocURI("test.tmpl"),
+				},
+				Position: protocol.Position{Line: 1, Character: 13},
+			},
+		})
+		require.Error(t, err, "prepare rename should fail for builtins")
+		require.Contains(t, err.Error(), "cannot rename template function upper")
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("rename_refuses_existing_names", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		_, err := server.Rename(ctx, &protocol.RenameParams{
+			TextDocument: protocol.TextDocumentIdentifier{
+				URI: toDocURI("test.tmpl"),
+			},
+			Position: protocol.Position{Line: 1, Character: 5},
+			NewName:  "Contact",
+		})
+		require.Error(t, err, "rename should fail for a name the type already has")
+		require.Contains(t, err.Error(), "Person already has a field or method named Contact")
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerFormatting(t *testing.T) {
+	template := "{{- /*gotype: test.Person*/ -}}\n{{.Name}}\n{{ if .Ready -}}\n{{.Email|upper}}\n{{- end }}"
+
+	t.Run("formatting_formats_the_document", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": template,
+		})
+
+		edits, err := server.Formatting(ctx, &protocol.DocumentFormattingParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Options:      protocol.FormattingOptions{TabSize: 2, InsertSpaces: true},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []protocol.TextEdit{
+			{Range: protocol.Range{Start: protocol.Position{Line: 1, Character: 0}, End: protocol.Position{Line: 1, Character: 9}}, NewText: "{{ .Name }}"},
+			{Range: protocol.Range{Start: protocol.Position{Line: 3, Character: 0}, End: protocol.Position{Line: 3, Character: 0}}, NewText: "  "},
+			{Range: protocol.Range{Start: protocol.Position{Line: 3, Character: 0}, End: protocol.Position{Line: 3, Character: 16}}, NewText: "{{ .Email | upper }}"},
+		}, edits)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("range_formatting_formats_the_selection", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": template,
+		})
+
+		edits, err := server.RangeFormatting(ctx, &protocol.DocumentRangeFormattingParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range:        protocol.Range{Start: protocol.Position{Line: 1, Character: 0}, End: protocol.Position{Line: 1, Character: 4}},
+			Options:      protocol.FormattingOptions{TabSize: 4},
+		})
+		require.NoError(t, err)
+		require.Len(t, edits, 1)
+		require.Equal(t, "{{ .Name }}", edits[0].NewText)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("on_type_formatting_formats_the_line", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": template,
+		})
+
+		edits, err := server.OnTypeFormatting(ctx, &protocol.DocumentOnTypeFormattingParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Position:     protocol.Position{Line: 3, Character: 16},
+			Ch:           "}",
+			Options:      protocol.FormattingOptions{TabSize: 4},
+		})
+		require.NoError(t, err)
+		require.Len(t, edits, 2)
+		require.Equal(t, "\t", edits[0].NewText)
+		require.Equal(t, "{{ .Email | upper }}", edits[1].NewText)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("invalid_template_is_not_formatted", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": "{{ if .Name }}",
+		})
+
+		edits, err := server.Formatting(ctx, &protocol.DocumentFormattingParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+		})
+		require.NoError(t, err)
+		require.Empty(t, edits)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerDocumentSymbol(t *testing.T) {
+	t.Run("document_symbols_outline_defines", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": `{{ define "person" }}{{- /*gotype: test.Person*/ -}}
+{{ range $i, $tag := .Tags }}{{ $tag }}{{ end }}
+{{ end }}`,
+		})
+
+		result, err := server.DocumentSymbol(ctx, &protocol.DocumentSymbolParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+		})
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+
+		define, ok := result[0].(protocol.DocumentSymbol)
+		require.True(t, ok, "result should be a hierarchy of document symbols")
+		require.Equal(t, "person", define.Name)
+		require.Equal(t, "test.Person", define.Detail)
+		require.Equal(t, protocol.Function, define.Kind)
+		require.Equal(t, protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 2, Character: 9}}, define.Range)
+
+		require.Len(t, define.Children, 1)
+		require.Equal(t, "range $i, $tag := .Tags", define.Children[0].Name)
+		require.Equal(t, protocol.Namespace, define.Children[0].Kind)
+		require.Len(t, define.Children[0].Children, 2)
+		require.Equal(t, "$tag", define.Children[0].Children[1].Name)
+		require.Equal(t, protocol.Variable, define.Children[0].Children[1].Kind)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("document_symbols_show_implicit_type_hints", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"go.mod": "module test",
+			"test.go": `package test
+
+//gotmpls:bind "test.tmpl" define="person"
+type Person struct {
+	Name string
+}`,
+			"test.tmpl": `{{ define "person" }}{{ .Name }}{{ end }}`,
+		})
+
+		result, err := server.DocumentSymbol(ctx, &protocol.DocumentSymbolParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+		})
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+
+		define, ok := result[0].(protocol.DocumentSymbol)
+		require.True(t, ok, "result should be a hierarchy of document symbols")
+		require.Equal(t, "person", define.Name)
+		require.Equal(t, "test.Person", define.Detail)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerCodeAction(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Address struct {
+	Street string
+}
+
+type Person struct {
+	Name    string
+	Address Address
+}`,
+		"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Address.Sreet }}
+{{ .Name | uper }}`,
+	}
+
+	t.Run("did_you_mean_replaces_the_misspelled_field", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		actions, err := server.CodeAction(ctx, &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 1, Character: 14},
+				End:   protocol.Position{Line: 1, Character: 14},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, actions, 1)
+
+		action := actions[0]
+		require.Equal(t, "Change to Street", action.Title)
+		require.Equal(t, protocol.QuickFix, action.Kind)
+		require.True(t, action.IsPreferred)
+		require.Len(t, action.Diagnostics, 1)
+		require.Equal(t, "field not found [ Sreet ] in type [ Address ], did you mean Street?", action.Diagnostics[0].Message)
+		require.Equal(t, map[protocol.DocumentURI][]protocol.TextEdit{
+			toDocURI("test.tmpl"): {
+				{
+					Range: protocol.Range{
+						Start: protocol.Position{Line: 1, Character: 12},
+						End:   protocol.Position{Line: 1, Character: 17},
+					},
+					NewText: "Street",
+				},
+			},
+		}, action.Edit.Changes)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("did_you_mean_replaces_the_misspelled_function", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		actions, err := server.CodeAction(ctx, &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 2, Character: 0},
+				End:   protocol.Position{Line: 2, Character: 18},
+			},
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, actions)
+		require.Equal(t, "Change to upper", actions[0].Title)
+		require.Equal(t, []protocol.TextEdit{
+			{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: 2, Character: 11},
+					End:   protocol.Position{Line: 2, Character: 15},
+				},
+				NewText: "upper",
+			},
+		}, actions[0].Edit.Changes[toDocURI("test.tmpl")])
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("no_actions_outside_of_diagnostics", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		actions, err := server.CodeAction(ctx, &protocol.CodeActionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range: protocol.Range{
+				Start: protocol.Position{Line: 0, Character: 0},
+				End:   protocol.Position{Line: 0, Character: 0},
+			},
+		})
+		require.NoError(t, err)
+		require.Empty(t, actions)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerSignatureHelp(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Person struct {
+	Name string
+}
+
+func (p Person) Greet(greeting string, times int) string {
+	return greeting
+}`,
+		"test.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Greet "hello"  }}
+{{ .Name | printf  }}`,
+	}
+
+	t.Run("method_signature_with_active_parameter", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		help, err := server.SignatureHelp(ctx, &protocol.SignatureHelpParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+				Position:     protocol.Position{Line: 1, Character: 18},
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, help)
+		require.Len(t, help.Signatures, 1)
+		require.Equal(t, "Greet(greeting string, times int) string", help.Signatures[0].Label)
+		require.Equal(t, []protocol.ParameterInformation{{Label: "greeting string"}, {Label: "times int"}}, help.Signatures[0].Parameters)
+		require.Equal(t, uint32(1), help.ActiveParameter)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("piped_value_fills_the_last_parameter", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		help, err := server.SignatureHelp(ctx, &protocol.SignatureHelpParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+				Position:     protocol.Position{Line: 2, Character: 18},
+			},
+		})
+		require.NoError(t, err)
+		require.NotNil(t, help)
+		require.Len(t, help.Signatures, 1)
+		require.Equal(t, "printf(arg1 string, arg2 ...interface{}) string", help.Signatures[0].Label)
+		require.Equal(t, "Filled by the piped value `.Name`", help.Signatures[0].Parameters[1].Documentation)
+		require.Equal(t, uint32(0), help.ActiveParameter)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerFoldingAndSelectionRanges(t *testing.T) {
+	template := `{{- /*gotype: test.Person*/ -}}
+{{ if .Name }}
+{{ .Address.Street }}
+{{ else }}
+none
+{{ end }}`
+
+	t.Run("folding_ranges_for_branches", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": template,
+		})
+
+		ranges, err := server.FoldingRange(ctx, &protocol.FoldingRangeParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []protocol.FoldingRange{
+			{StartLine: 1, EndLine: 2, Kind: string(protocol.Region)},
+			{StartLine: 3, EndLine: 4, Kind: string(protocol.Region)},
+		}, ranges)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("selection_ranges_expand_to_enclosing_nodes", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, map[string]string{
+			"test.tmpl": template,
+		})
+
+		ranges, err := server.SelectionRange(ctx, &protocol.SelectionRangeParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Positions:    []protocol.Position{{Line: 2, Character: 5}},
+		})
+		require.NoError(t, err)
+		require.Len(t, ranges, 1)
+
+		field := ranges[0]
+		require.Equal(t, protocol.Range{Start: protocol.Position{Line: 2, Character: 3}, End: protocol.Position{Line: 2, Character: 18}}, field.Range)
+		require.NotNil(t, field.Parent)
+		require.Equal(t, protocol.Range{Start: protocol.Position{Line: 2, Character: 0}, End: protocol.Position{Line: 2, Character: 21}}, field.Parent.Range)
+		require.NotNil(t, field.Parent.Parent)
+		require.Equal(t, protocol.Range{Start: protocol.Position{Line: 1, Character: 0}, End: protocol.Position{Line: 5, Character: 9}}, field.Parent.Parent.Range)
+
+		mockClient.AssertExpectations(t)
+	})
 }
 
 func TestMockServerSemanticTokens(t *testing.T) {
@@ -443,3 +1163,281 @@ func TestMockServerSemanticTokenRegistration(t *testing.T) {
 		mockClient.AssertExpectations(t)
 	})
 }
+
+func TestMockServerInlayHint(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import _ "embed"
+//go:embed test.tmpl
+var TestTemplate string
+
+type Item struct {
+	Price float64
+}
+
+type Order struct {
+	Items []*Item
+}`,
+		"test.tmpl": `{{- /*gotype: test.Order*/ -}}
+{{ range $i, $item := .Items }}{{ $item.Price | printf "%.2f" }}{{ end }}
+{{ $n := len .Items }}`,
+	}
+
+	fullRange := protocol.Range{End: protocol.Position{Line: 3}}
+
+	t.Run("disabled_by_default", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		hints, err := server.InlayHint(ctx, &protocol.InlayHintParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range:        fullRange,
+		})
+		require.NoError(t, err)
+		require.Empty(t, hints)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("enabled_by_configuration", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.Anything).Return(nil).Maybe()
+
+		err := server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{
+			Settings: map[string]any{"gotmpls": map[string]any{"inlayHints": map[string]any{
+				"variableTypes": true,
+				"pipelineTypes": true,
+				"rangeTypes":    true,
+			}}},
+		})
+		require.NoError(t, err)
+
+		hints, err := server.InlayHint(ctx, &protocol.InlayHintParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range:        fullRange,
+		})
+		require.NoError(t, err)
+
+		labels := []string{}
+		for _, hint := range hints {
+			require.Equal(t, protocol.Type, hint.Kind)
+			require.Len(t, hint.Label, 1)
+			labels = append(labels, fmt.Sprintf("%d:%d%s", hint.Position.Line, hint.Position.Character, hint.Label[0].Value))
+		}
+		require.Equal(t, []string{
+			"1:11: int",
+			"1:18: *test.Item",
+			"1:31.: *test.Item",
+			"1:45: float64",
+			"1:61: string",
+			"2:5: int",
+		}, labels)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("only_hints_in_range", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.Anything).Return(nil).Maybe()
+
+		err := server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{
+			Settings: map[string]any{"inlayHints": map[string]any{"variableTypes": true}},
+		})
+		require.NoError(t, err)
+
+		hints, err := server.InlayHint(ctx, &protocol.InlayHintParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("test.tmpl")},
+			Range:        protocol.Range{Start: protocol.Position{Line: 2}, End: protocol.Position{Line: 3}},
+		})
+		require.NoError(t, err)
+		require.Len(t, hints, 1)
+		require.Equal(t, protocol.Position{Line: 2, Character: 5}, hints[0].Position)
+
+		mockClient.AssertExpectations(t)
+	})
+}
+
+func TestMockServerWorkspaceDiagnostics(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module test",
+		"test.go": `package test
+
+import "embed"
+
+//go:embed open.tmpl closed.tmpl
+var Templates embed.FS
+
+type Person struct {
+	Name string
+}`,
+		"open.tmpl": `{{- /*gotype: test.Person*/ -}}
+{{ .Name }}`,
+	}
+
+	closed := `{{- /*gotype: test.Person*/ -}}
+{{ .Age }}`
+
+	withAge := strings.Replace(files["test.go"], "Name string", "Name string\n\tAge  int", 1)
+
+	// setup opens every file, the closed template is only written to disk
+	setup := func(t *testing.T, capabilities protocol.ClientCapabilities) (context.Context, *mockery.MockClient_protocol, *lsp.Server, func(string) protocol.DocumentURI) {
+		ctx, mockClient, server, toDocURI := setupMockServer(t, files)
+		require.NoError(t, os.WriteFile(toDocURI("closed.tmpl").Path(), []byte(closed), 0644))
+
+		_, err := server.Initialize(ctx, &protocol.ParamInitialize{
+			XInitializeParams: protocol.XInitializeParams{
+				Capabilities: capabilities,
+			},
+			WorkspaceFoldersInitializeParams: protocol.WorkspaceFoldersInitializeParams{
+				WorkspaceFolders: []protocol.WorkspaceFolder{{URI: string(toDocURI("")), Name: "test"}},
+			},
+		})
+		require.NoError(t, err)
+
+		return ctx, mockClient, server, toDocURI
+	}
+
+	// changeGoFile adds the Age field to Person, on disk and in the open document
+	changeGoFile := func(t *testing.T, ctx context.Context, server *lsp.Server, toDocURI func(string) protocol.DocumentURI) {
+		require.NoError(t, os.WriteFile(toDocURI("test.go").Path(), []byte(withAge), 0644))
+		server.Documents().Store(toDocURI("test.go"), &lsp.Document{
+			URI:        string(toDocURI("test.go")),
+			LanguageID: "go",
+			Version:    2,
+			Content:    withAge,
+		})
+		require.NoError(t, server.DidChangeWatchedFiles(ctx, &protocol.DidChangeWatchedFilesParams{
+			Changes: []protocol.FileEvent{{URI: toDocURI("test.go"), Type: protocol.Changed}},
+		}))
+	}
+
+	errorMessages := func(diagnostics []protocol.Diagnostic) []string {
+		msgs := []string{}
+		for _, d := range diagnostics {
+			if d.Severity == protocol.SeverityError {
+				msgs = append(msgs, d.Message)
+			}
+		}
+		return msgs
+	}
+
+	t.Run("pull_reports_unopened_templates_with_result_ids", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setup(t, protocol.ClientCapabilities{
+			TextDocument: protocol.TextDocumentClientCapabilities{
+				Diagnostic: &protocol.DiagnosticClientCapabilities{},
+			},
+			Workspace: protocol.WorkspaceClientCapabilities{
+				Diagnostics: &protocol.DiagnosticWorkspaceClientCapabilities{RefreshSupport: true},
+			},
+		})
+
+		report, err := server.DiagnosticWorkspace(ctx, &protocol.WorkspaceDiagnosticParams{})
+		require.NoError(t, err)
+		require.Len(t, report.Items, 2)
+
+		full, ok := report.Items[0].Value.(protocol.WorkspaceFullDocumentDiagnosticReport)
+		require.True(t, ok, "the first report should be full")
+		require.Equal(t, toDocURI("closed.tmpl").Path(), full.URI.Path())
+		require.Equal(t, "full", full.Kind)
+		require.NotEmpty(t, full.ResultID)
+		require.Equal(t, []string{"field not found [ Age ] in type [ Person ]"}, errorMessages(full.Items))
+
+		open, ok := report.Items[1].Value.(protocol.WorkspaceFullDocumentDiagnosticReport)
+		require.True(t, ok, "the second report should be full")
+		require.Equal(t, toDocURI("open.tmpl"), open.URI)
+		require.Equal(t, int32(1), open.Version)
+		require.Empty(t, errorMessages(open.Items))
+
+		previous := []protocol.PreviousResultID{
+			{URI: full.URI, Value: full.ResultID},
+			{URI: open.URI, Value: open.ResultID},
+		}
+
+		report, err = server.DiagnosticWorkspace(ctx, &protocol.WorkspaceDiagnosticParams{PreviousResultIds: previous})
+		require.NoError(t, err)
+		require.Len(t, report.Items, 2)
+		for _, item := range report.Items {
+			unchanged, ok := item.Value.(protocol.WorkspaceUnchangedDocumentDiagnosticReport)
+			require.True(t, ok, "reports should be unchanged")
+			require.Equal(t, "unchanged", unchanged.Kind)
+		}
+
+		mockClient.EXPECT().DiagnosticRefresh(ctx).Return(nil).Once()
+		changeGoFile(t, ctx, server, toDocURI)
+
+		report, err = server.DiagnosticWorkspace(ctx, &protocol.WorkspaceDiagnosticParams{PreviousResultIds: previous})
+		require.NoError(t, err)
+		require.Len(t, report.Items, 2)
+
+		full, ok = report.Items[0].Value.(protocol.WorkspaceFullDocumentDiagnosticReport)
+		require.True(t, ok, "the closed template should be checked against the new type")
+		require.Empty(t, errorMessages(full.Items))
+
+		_, ok = report.Items[1].Value.(protocol.WorkspaceUnchangedDocumentDiagnosticReport)
+		require.True(t, ok, "the open template should be unchanged")
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("document_pull_is_unchanged_for_the_same_result_id", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setup(t, protocol.ClientCapabilities{
+			TextDocument: protocol.TextDocumentClientCapabilities{
+				Diagnostic: &protocol.DiagnosticClientCapabilities{},
+			},
+		})
+
+		report, err := server.Diagnostic(ctx, &protocol.DocumentDiagnosticParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: toDocURI("open.tmpl")},
+		})
+		require.NoError(t, err)
+		full, ok := report.Value.(protocol.RelatedFullDocumentDiagnosticReport)
+		require.True(t, ok, "the first report should be full")
+		require.NotEmpty(t, full.ResultID)
+
+		report, err = server.Diagnostic(ctx, &protocol.DocumentDiagnosticParams{
+			TextDocument:     protocol.TextDocumentIdentifier{URI: toDocURI("open.tmpl")},
+			PreviousResultID: full.ResultID,
+		})
+		require.NoError(t, err)
+		unchanged, ok := report.Value.(protocol.RelatedUnchangedDocumentDiagnosticReport)
+		require.True(t, ok, "the second report should be unchanged")
+		require.Equal(t, full.ResultID, unchanged.ResultID)
+
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("push_publishes_changed_unopened_templates", func(t *testing.T) {
+		ctx, mockClient, server, toDocURI := setup(t, protocol.ClientCapabilities{})
+
+		isClosed := func(p *protocol.PublishDiagnosticsParams) bool {
+			return p.URI.Path() == toDocURI("closed.tmpl").Path()
+		}
+
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.MatchedBy(func(p *protocol.PublishDiagnosticsParams) bool {
+			return !isClosed(p)
+		})).Return(nil).Maybe()
+
+		var published []*protocol.PublishDiagnosticsParams
+		mockClient.EXPECT().PublishDiagnostics(ctx, mock.MatchedBy(isClosed)).Run(func(_ context.Context, p *protocol.PublishDiagnosticsParams) {
+			published = append(published, p)
+		}).Return(nil).Twice()
+
+		err := server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{Settings: map[string]any{}})
+		require.NoError(t, err)
+		require.Len(t, published, 1)
+		require.Equal(t, []string{"field not found [ Age ] in type [ Person ]"}, errorMessages(published[0].Diagnostics))
+
+		err = server.DidChangeConfiguration(ctx, &protocol.DidChangeConfigurationParams{Settings: map[string]any{}})
+		require.NoError(t, err)
+		require.Len(t, published, 1, "unchanged diagnostics should not be published again")
+
+		changeGoFile(t, ctx, server, toDocURI)
+		require.Len(t, published, 2)
+		require.Empty(t, errorMessages(published[1].Diagnostics), "the closed template should be checked against the new type")
+
+		mockClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,163 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/lsp/protocol"
+)
+
+// workspaceTemplate is a template of the workspace, either opened by the client or embedded by a
+// package of a workspace folder
+type workspaceTemplate struct {
+	uri     protocol.DocumentURI
+	version int32
+	content string
+}
+
+// setWorkspaceFolders replaces the folders whose templates are checked as a whole
+func (s *Server) setWorkspaceFolders(folders []string) {
+	s.workspaceMu.Lock()
+	defer s.workspaceMu.Unlock()
+	s.workspaceFolders = folders
+}
+
+// workspaceTemplates returns the open templates and the templates embedded by the packages of the
+// workspace folders, sorted by their URI. Open documents replace the embedded content.
+func (s *Server) workspaceTemplates(ctx context.Context) []workspaceTemplate {
+	logger := zerolog.Ctx(ctx)
+
+	templates := map[string]workspaceTemplate{}
+	overlay := map[string][]byte{}
+
+	for _, doc := range s.documents.Open() {
+		path := normalizeURI(doc.URI)
+		overlay[path] = []byte(doc.Content)
+		if isGoFile(path) {
+			continue
+		}
+		templates[path] = workspaceTemplate{uri: protocol.DocumentURI(doc.URI), version: doc.Version, content: doc.Content}
+	}
+
+	s.workspaceMu.Lock()
+	folders := slices.Clone(s.workspaceFolders)
+	s.workspaceMu.Unlock()
+
+	for _, folder := range folders {
+		reg, err := s.registries.WorkspaceRegistry(ctx, folder, overlay)
+		if err != nil {
+			logger.Debug().Err(err).Str("folder", folder).Msg("failed to load workspace packages")
+			continue
+		}
+		for _, pkg := range reg.Packages {
+			for path, content := range pkg.TemplateFiles {
+				if _, ok := templates[path]; ok || !isWithinFolder(folder, path) {
+					continue
+				}
+				templates[path] = workspaceTemplate{uri: protocol.URIFromPath(path), content: content}
+			}
+		}
+	}
+
+	result := make([]workspaceTemplate, 0, len(templates))
+	for _, tmpl := range templates {
+		result = append(result, tmpl)
+	}
+	slices.SortFunc(result, func(a, b workspaceTemplate) int {
+		return strings.Compare(string(a.uri), string(b.uri))
+	})
+
+	return result
+}
+
+// isWithinFolder reports whether path is folder or inside of it
+func isWithinFolder(folder, path string) bool {
+	rel, err := filepath.Rel(folder, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// pullDiagnostics reports whether the client requests diagnostics, instead of having them published
+func (s *Server) pullDiagnostics() bool {
+	return s.clientCapabilities.TextDocument.Diagnostic != nil
+}
+
+// refreshWorkspaceDiagnostics updates the diagnostics of every template of the workspace after a change
+// that can affect templates which are not open, e.g. to a Go type or to the configuration.
+//
+// Clients that pull diagnostics are asked to pull them again. Otherwise the diagnostics of the open
+// documents are published, and those of the other templates only if they changed.
+func (s *Server) refreshWorkspaceDiagnostics(ctx context.Context) {
+	logger := zerolog.Ctx(ctx)
+
+	if s.pullDiagnostics() {
+		if s.clientCapabilities.Workspace.Diagnostics == nil || !s.clientCapabilities.Workspace.Diagnostics.RefreshSupport || s.callbackClient == nil {
+			return
+		}
+		if err := s.callbackClient.DiagnosticRefresh(ctx); err != nil {
+			logger.Warn().Err(err).Msg("failed to refresh diagnostics")
+		}
+		return
+	}
+
+	open := map[string]bool{}
+	for _, doc := range s.documents.Open() {
+		open[normalizeURI(doc.URI)] = true
+		if err := s.publishDiagnostics(ctx, protocol.DocumentURI(doc.URI), doc.Content); err != nil {
+			logger.Error().Err(err).Str("uri", doc.URI).Msg("failed to publish diagnostics")
+		}
+	}
+
+	for _, tmpl := range s.workspaceTemplates(ctx) {
+		if open[normalizeURI(string(tmpl.uri))] {
+			continue
+		}
+
+		diagnostics, err := s.identifyDiagnosticsForFile(ctx, tmpl.uri, tmpl.content)
+		if err != nil {
+			logger.Error().Err(err).Str("uri", string(tmpl.uri)).Msg("failed to identify diagnostics")
+			continue
+		}
+
+		if s.publishedResultID(tmpl.uri) == diagnosticsResultID(diagnostics) {
+			continue
+		}
+
+		if err := s.sendDiagnostics(ctx, tmpl.uri, diagnostics); err != nil {
+			logger.Error().Err(err).Str("uri", string(tmpl.uri)).Msg("failed to publish diagnostics")
+		}
+	}
+}
+
+// publishedResultID returns the result id of the diagnostics last published for a document
+func (s *Server) publishedResultID(uri protocol.DocumentURI) string {
+	s.workspaceMu.Lock()
+	defer s.workspaceMu.Unlock()
+	return s.publishedResults[normalizeURI(string(uri))]
+}
+
+func (s *Server) setPublishedResultID(uri protocol.DocumentURI, resultID string) {
+	s.workspaceMu.Lock()
+	defer s.workspaceMu.Unlock()
+	if s.publishedResults == nil {
+		s.publishedResults = map[string]string{}
+	}
+	s.publishedResults[normalizeURI(string(uri))] = resultID
+}
+
+// diagnosticsResultID identifies a diagnostic report by its content, so that a client that already
+// has the same diagnostics is told that they are unchanged
+func diagnosticsResultID(diagnostics []protocol.Diagnostic) string {
+	data, err := json.Marshal(diagnostics)
+	if err != nil {
+		return ""
+	}
+	hash := fnv.New64a()
+	hash.Write(data)
+	return strconv.FormatUint(hash.Sum64(), 36)
+}
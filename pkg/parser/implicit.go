@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/position"
+)
+
+// ParseWithRegistry parses a template like Parse, and sets the type hint of the blocks without a
+// gotype comment from the go code of the registry's packages. A nil registry sets no hints.
+func ParseWithRegistry(ctx context.Context, fileName string, content []byte, registry *ast.Registry) (*ParsedTemplateFile, error) {
+	info, err := Parse(ctx, fileName, content)
+	if err != nil {
+		return nil, err
+	}
+	info.applyImplicitTypeHints(ctx, registry)
+	return info, nil
+}
+
+// applyImplicitTypeHints sets the type hint of the blocks without a gotype comment: the type a
+// //gotmpls:bind directive binds the block to, or else the type of the data the block is executed with.
+//
+// A block that is bound to or executed with different types, or with a type that can not be loaded
+// from the registry, keeps no hint.
+func (me *ParsedTemplateFile) applyImplicitTypeHints(ctx context.Context, registry *ast.Registry) {
+	bindings := registry.Bindings(me.Filename)
+	hints := registry.ExecuteHints(me.Filename)
+	if len(bindings) == 0 && len(hints) == 0 {
+		return
+	}
+
+	for i := range me.Blocks {
+		block := &me.Blocks[i]
+		if block.TypeHint != nil {
+			continue
+		}
+
+		if binding := me.blockBinding(ctx, block, bindings); binding != nil {
+			me.setImplicitTypeHint(ctx, block, binding.TypePath, binding.Position.String(), registry)
+			continue
+		}
+
+		var found *ast.ExecuteHint
+		ambiguous := false
+		for _, hint := range hints {
+			name := block.Name
+			if block.Keyword() == "" {
+				// the content of the file outside of any define
+				name = hint.Files[me.Filename]
+			}
+			if hint.Name != name {
+				continue
+			}
+			if found != nil && found.TypePath != hint.TypePath {
+				ambiguous = true
+			}
+			found = hint
+		}
+		if found == nil || ambiguous {
+			continue
+		}
+
+		me.setImplicitTypeHint(ctx, block, found.TypePath, found.Position.String(), registry)
+	}
+}
+
+// blockBinding returns the binding of a block, nil if it is not bound or bound to different types
+func (me *ParsedTemplateFile) blockBinding(ctx context.Context, block *BlockInfo, bindings []*ast.Binding) *ast.Binding {
+	var found *ast.Binding
+	for _, binding := range bindings {
+		if (binding.Define == "" && block.Keyword() != "") || (binding.Define != "" && binding.Define != block.Name) {
+			continue
+		}
+		if found != nil && found.TypePath != binding.TypePath {
+			zerolog.Ctx(ctx).Debug().Str("block", block.Name).Msg("block is bound to different types")
+			return nil
+		}
+		found = binding
+	}
+	return found
+}
+
+func (me *ParsedTemplateFile) setImplicitTypeHint(ctx context.Context, block *BlockInfo, typePath string, origin string, registry *ast.Registry) {
+	if _, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, typePath, registry); err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Str("block", block.Name).Str("origin", origin).Msg("skipping implicit type hint")
+		return
+	}
+
+	block.TypeHint = &TypeHint{
+		TypePath: typePath,
+		Position: position.NewBasicPosition("", -1),
+		Scope:    block.Name,
+		Origin:   origin,
+	}
+}
@@ -7,13 +7,16 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/walteh/gotmpls/pkg/std/text/template"
 	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
 
 	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
 	"github.com/walteh/gotmpls/pkg/position"
 	"gitlab.com/tozd/go/errors"
 )
@@ -21,7 +24,7 @@ import (
 func ParseTree(name string, text []byte) (map[string]*parse.Tree, error) {
 	treeSet := make(map[string]*parse.Tree)
 	t := parse.New(name)
-	t.Mode = parse.ParseComments | parse.SkipFuncCheck
+	t.Mode = parse.ParseComments | parse.SkipFuncCheck | parse.SkipVarCheck
 	_, err := t.Parse(string(text), "{{", "}}", treeSet)
 	return treeSet, err
 }
@@ -29,7 +32,7 @@ func ParseTree(name string, text []byte) (map[string]*parse.Tree, error) {
 func ParseStringToRawTemplate(ctx context.Context, fileName string, content []byte) (*template.Template, error) {
 	tmpl := template.New(fileName)
 	tmpl.Tree = parse.New(fileName)
-	tmpl.Mode = parse.ParseComments | parse.SkipFuncCheck
+	tmpl.Mode = parse.ParseComments | parse.SkipFuncCheck | parse.SkipVarCheck
 
 	treeSet, err := ParseTree(fileName, content)
 	if err != nil {
@@ -46,7 +49,7 @@ func ParseStringToRawTemplate(ctx context.Context, fileName string, content []by
 }
 
 // createVarLocation creates a new variable location and adds it to the seen map
-func createVarLocation(field *parse.FieldNode, scope string, seenVars *position.PositionsSeenMap) *VariableLocation {
+func createVarLocation(field *parse.FieldNode, scope string, dot *DotScope, seenVars *position.PositionsSeenMap) *VariableLocation {
 	pos := position.NewFieldNodePosition(field)
 
 	if seenVars.Has(pos) {
@@ -56,6 +59,7 @@ func createVarLocation(field *parse.FieldNode, scope string, seenVars *position.
 	item := &VariableLocation{
 		Position: pos,
 		Scope:    scope,
+		Dot:      dot,
 	}
 
 	seenVars.Add(pos)
@@ -104,6 +108,34 @@ func extractTypeHint(cmt *parse.CommentNode, scope string) *TypeHint {
 	return th
 }
 
+// extractFunctionSets extracts the function sets enabled by a {{/* gotmpls:funcs sprig, helm */}} comment
+func extractFunctionSets(cmt *parse.CommentNode, scope string) []FunctionSet {
+	text := strings.TrimSpace(cmt.Text)
+	text = strings.TrimPrefix(text, "/*")
+	text = strings.TrimSuffix(text, "*/")
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "gotmpls:funcs") {
+		return nil
+	}
+
+	start := strings.Index(cmt.Text, "gotmpls:funcs") + len("gotmpls:funcs")
+	rest := strings.TrimSuffix(strings.TrimSpace(cmt.Text[start:]), "*/")
+
+	sets := []FunctionSet{}
+	offset := start
+	for _, name := range strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		idx := strings.Index(cmt.Text[offset:], name) + offset
+		sets = append(sets, FunctionSet{
+			Name:     name,
+			Position: position.NewBasicPosition(name, int(cmt.Pos)+idx-1),
+			Scope:    scope,
+		})
+		offset = idx + len(name)
+	}
+
+	return sets
+}
+
 // walkNode processes a single node in the AST
 func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope string, parent parse.Node, seenVars, seenFuncs *position.PositionsSeenMap) error {
 	if node == nil {
@@ -118,12 +150,13 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 			}
 			block.TypeHint = hint
 		}
+		block.FunctionSets = append(block.FunctionSets, extractFunctionSets(n, scope)...)
 	case *parse.ActionNode:
 		if n.Pipe != nil {
 			// Only handle variables that are direct references (not part of a pipe operation)
 			if len(n.Pipe.Cmds) == 1 && len(n.Pipe.Cmds[0].Args) == 1 {
 				if field, ok := n.Pipe.Cmds[0].Args[0].(*parse.FieldNode); ok {
-					if item := createVarLocation(field, scope, seenVars); item != nil {
+					if item := createVarLocation(field, scope, block.currentDot(), seenVars); item != nil {
 						zerolog.Ctx(ctx).Trace().Msgf("adding variable %s in position %s to block %s", item.Name(), item.Position.ID(), block.Name)
 						block.Variables = append(block.Variables, *item)
 					}
@@ -134,12 +167,18 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 			return err
 		}
 	case *parse.IfNode:
+		// Variables declared in the condition or body go out of scope at the end of the if
+		mark := len(block.varStack)
+		defer func() {
+			block.varStack = block.varStack[:mark]
+		}()
+
 		// Handle if condition
 		if n.Pipe != nil {
 			for _, cmd := range n.Pipe.Cmds {
 				for _, arg := range cmd.Args {
 					if field, ok := arg.(*parse.FieldNode); ok {
-						if item := createVarLocation(field, scope, seenVars); item != nil {
+						if item := createVarLocation(field, scope, block.currentDot(), seenVars); item != nil {
 							block.Variables = append(block.Variables, *item)
 						}
 					}
@@ -157,6 +196,14 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 				return err
 			}
 		}
+	case *parse.RangeNode:
+		if err := block.walkDotBranch(ctx, &n.BranchNode, "range", scope, seenVars, seenFuncs); err != nil {
+			return err
+		}
+	case *parse.WithNode:
+		if err := block.walkDotBranch(ctx, &n.BranchNode, "with", scope, seenVars, seenFuncs); err != nil {
+			return err
+		}
 	case *parse.ListNode:
 		if n != nil {
 			for _, z := range n.Nodes {
@@ -167,6 +214,9 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 		}
 	case *parse.PipeNode:
 		if n != nil {
+			block.pipelines = append(block.pipelines, block.newPipeline(n, scope))
+			block.walkPipeVariables(n, scope, parent)
+
 			var lastResult *VariableLocationOrType
 
 			for i, cmd := range n.Cmds {
@@ -181,7 +231,7 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 						}
 						switch v := arg.(type) {
 						case *parse.FieldNode:
-							item := createVarLocation(v, scope, seenVars)
+							item := createVarLocation(v, scope, block.currentDot(), seenVars)
 							if item != nil {
 								ivlt := VariableLocationOrType{Variable: item}
 								block.Variables = append(block.Variables, *item)
@@ -204,7 +254,7 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 							lastResult = &VariableLocationOrType{Variable: item}
 						}
 					} else if field, ok := cmd.Args[0].(*parse.FieldNode); ok {
-						item := createVarLocation(field, scope, seenVars)
+						item := createVarLocation(field, scope, block.currentDot(), seenVars)
 						if item != nil {
 							block.Variables = append(block.Variables, *item)
 							lastResult = &VariableLocationOrType{Variable: item}
@@ -214,9 +264,19 @@ func (block *BlockInfo) walkNode(ctx context.Context, node parse.Node, scope str
 			}
 		}
 	case *parse.TemplateNode:
+		call := TemplateCallLocation{
+			Name:     n.Name,
+			Position: position.NewKeywordPosition(n),
+			Scope:    scope,
+		}
+		next := len(block.pipelines)
 		if err := block.walkNode(ctx, n.Pipe, scope, node, seenVars, seenFuncs); err != nil {
 			return err
 		}
+		if n.Pipe != nil && len(block.pipelines) > next {
+			call.Pipeline = block.pipelines[next]
+		}
+		block.TemplateCalls = append(block.TemplateCalls, call)
 	}
 
 	return nil
@@ -392,6 +452,7 @@ type VariableLocation struct {
 	Position      position.RawPosition
 	PipeArguments []VariableLocationOrType // either a VariableLocation or some other types.Type
 	Scope         string                   // The scope of the variable (e.g., template name or block ID)
+	Dot           *DotScope                // The range or with that `.` is bound to, nil for the block's type hint
 }
 
 func (me *VariableLocation) GetTypePaths(th *TypeHint) []string {
@@ -427,6 +488,53 @@ func (me *VariableLocation) GetTypePathNames(th *TypeHint) []string {
 	return returnd
 }
 
+// PathAtPosition returns the part of the variable's field path up to and including the
+// field that the given position points at.
+//
+// Example:
+//
+//	{{ .Address.City }} with the cursor on "Address" -> ".Address"
+func (v *VariableLocation) PathAtPosition(pos position.RawPosition) position.RawPosition {
+	text := v.Position.Text
+	// variable positions are stored one before the actual offset (see position.NewFieldNodePosition)
+	rel := pos.Offset - (v.Position.Offset + 1)
+	if rel < 0 {
+		rel = 0
+	}
+	if rel >= len(text) {
+		rel = len(text) - 1
+	}
+
+	end := len(text)
+	if rel+1 < len(text) {
+		if idx := strings.Index(text[rel+1:], "."); idx != -1 {
+			end = rel + 1 + idx
+		}
+	}
+
+	return position.NewBasicPosition(text[:end], v.Position.Offset)
+}
+
+// DotTypeHintDefinition returns the type definition that the variable's field path is resolved
+// against: root for the block's type hint, or the type that `.` is bound to by an enclosing range
+// or with. It returns nil if the type of `.` can not be determined statically.
+func (v *VariableLocation) DotTypeHintDefinition(ctx context.Context, root *ast.TypeHintDefinition, methods map[string]*ast.TemplateMethodInfo) (*ast.TypeHintDefinition, error) {
+	if v.Dot == nil {
+		return root, nil
+	}
+
+	if root.Type == nil {
+		return nil, nil
+	}
+
+	typ, err := v.Dot.ResolveType(ctx, root.Type, methods)
+	if err != nil || typ == nil {
+		return nil, err
+	}
+
+	return ast.GenerateTypeHintDefinitionFromType(ctx, typ, v.Dot.Addressable(ctx, root, methods))
+}
+
 // Name returns the short name of the variable (last part after dot)
 func (v *VariableLocation) Name() string {
 	parts := strings.Split(v.Position.Text, ".")
@@ -464,6 +572,17 @@ type TypeHint struct {
 	TypePath string // e.g. "github.com/walteh/minute-api/proto/cmd/protoc-gen-cdk/generator.BuilderConfig"
 	Position position.RawPosition
 	Scope    string // The scope of the type hint (e.g., template name or block ID)
+	// Origin is where a hint that is not written in the template comes from, e.g. the go call that
+	// executes the template. The Position of such a hint is empty.
+	Origin string
+}
+
+// FunctionSet represents a function set (e.g. "sprig") enabled by a comment directive in the template.
+// Function sets apply to the whole template file, regardless of the block they are declared in.
+type FunctionSet struct {
+	Name     string
+	Position position.RawPosition
+	Scope    string
 }
 
 func (me *TypeHint) LocalTypeName() string {
@@ -477,6 +596,33 @@ type ParsedTemplateFile struct {
 	Blocks        []BlockInfo
 }
 
+// FunctionSets returns the names of the function sets enabled by comment directives in any block
+func (me *ParsedTemplateFile) FunctionSets() []string {
+	names := []string{}
+	for _, block := range me.Blocks {
+		for _, set := range block.FunctionSets {
+			if !slices.Contains(names, set.Name) {
+				names = append(names, set.Name)
+			}
+		}
+	}
+	return names
+}
+
+// GetBlockFromPosition returns the innermost block that contains the given position
+func (me *ParsedTemplateFile) GetBlockFromPosition(pos position.RawPosition) *BlockInfo {
+	var found *BlockInfo
+	for i := range me.Blocks {
+		block := &me.Blocks[i]
+		if block.StartPosition.Offset <= pos.Offset && pos.Offset <= block.EndPosition.Offset {
+			if found == nil || block.StartPosition.Offset >= found.StartPosition.Offset {
+				found = block
+			}
+		}
+	}
+	return found
+}
+
 func (me *BlockInfo) GetVariableFromPosition(pos position.RawPosition) *VariableLocation {
 	for _, variable := range me.Variables {
 		if variable.Position.HasRangeOverlapWith(pos) {
@@ -492,8 +638,45 @@ type BlockInfo struct {
 	TypeHint      *TypeHint
 	Variables     []VariableLocation
 	Functions     []VariableLocation
-	EndPosition   position.RawPosition
-	node          *template.Template
+	TemplateCalls []TemplateCallLocation
+	FunctionSets  []FunctionSet // the function sets enabled by comment directives in the block
+	Scopes        []*DotScope   // every range and with in the block, in order of appearance
+	// every $variable declared in the block, in order of appearance
+	VariableDeclarations []*TemplateVariable
+	// every use of, or assignment to, a $variable in the block, in order of appearance
+	VariableReferences []*VariableReference
+	EndPosition        position.RawPosition
+	node               *template.Template
+	dotStack           []*DotScope
+	varStack           []*TemplateVariable
+	pipelines          []*Pipeline
+}
+
+// Keyword returns "define" or "block" for a named template, or an empty string for the content
+// of a file outside of any define
+func (me *BlockInfo) Keyword() string {
+	if me.node == nil || me.node.Tree == nil || !me.node.Tree.CanRelyOnKeyword() {
+		return ""
+	}
+	return me.node.Tree.Keyword().Val()
+}
+
+// NamePosition returns the position of the quoted name of a define or block, or the start of the
+// block for the content of a file outside of any define
+func (me *BlockInfo) NamePosition() position.RawPosition {
+	if me.Keyword() == "" {
+		return me.StartPosition
+	}
+	name := me.node.Tree.DefineName()
+	return position.NewBasicPosition(name.Val(), int(name.Pos())-1)
+}
+
+// TemplateCallLocation represents a {{ template "name" }} invocation in a template
+type TemplateCallLocation struct {
+	Name     string
+	Position position.RawPosition // the position of the quoted template name
+	Scope    string
+	Pipeline *Pipeline // the value passed as `.` to the template, nil if it is called without one
 }
 
 type PipedArgument struct {
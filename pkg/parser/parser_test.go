@@ -850,3 +850,130 @@ func TestParseVariableLocations(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDotScopes(t *testing.T) {
+	ctx := context.Background()
+
+	content := `{{- /*gotype: github.com/example/types.Person*/ -}}
+{{ .Name }}
+{{ range .Items }}{{ .Title }}{{ with .Owner }}{{ .Email }}{{ end }}{{ else }}{{ .Empty }}{{ end }}
+{{ with . }}{{ .Age }}{{ end }}
+{{ range index .Lists 0 }}{{ .Unknown }}{{ end }}`
+
+	info, err := parser.Parse(ctx, "test.tmpl", []byte(content))
+	require.NoError(t, err)
+	require.Len(t, info.Blocks, 1)
+
+	// describe the chain of scopes each variable is resolved in, innermost first
+	chain := func(dot *parser.DotScope) []string {
+		var out []string
+		for ; dot != nil; dot = dot.Parent {
+			pipe := "<unknown>"
+			if dot.Value != nil && dot.Value.Field != nil {
+				pipe = dot.Value.Field.Position.Text
+			}
+			out = append(out, dot.Keyword+" "+pipe)
+		}
+		return out
+	}
+
+	got := map[string][]string{}
+	for _, variable := range info.Blocks[0].Variables {
+		got[variable.LongName()] = chain(variable.Dot)
+	}
+
+	want := map[string][]string{
+		".Name":    nil,
+		".Items":   nil,
+		".Title":   {"range .Items"},
+		".Owner":   {"range .Items"},
+		".Email":   {"with .Owner", "range .Items"},
+		".Empty":   nil,
+		".Age":     {"with ."},
+		".Lists":   nil,
+		".Unknown": {"range <unknown>"},
+	}
+	assert.Equal(t, want, got)
+	assert.Len(t, info.Blocks[0].Scopes, 4)
+}
+
+func TestParseTemplateVariables(t *testing.T) {
+	ctx := context.Background()
+
+	content := `{{- /*gotype: github.com/example/types.Person*/ -}}
+{{ $u := .User }}{{ $u.Email }}
+{{ range $i, $e := .Items }}{{ $e.Title }}{{ $i }}{{ end }}{{ $e }}
+{{ if $ok := .Active }}{{ $ok }}{{ else }}{{ $ok }}{{ end }}{{ $ok }}
+{{ with $v := .User }}{{ $v = .Other }}{{ end }}
+{{ $missing = 1 }}{{ $.Name }}`
+
+	info, err := parser.Parse(ctx, "test.tmpl", []byte(content))
+	require.NoError(t, err, "undefined variables should not fail parsing")
+	require.Len(t, info.Blocks, 1)
+	block := info.Blocks[0]
+
+	decls := []string{}
+	for _, decl := range block.VariableDeclarations {
+		decls = append(decls, decl.Name)
+	}
+	assert.Equal(t, []string{"$u", "$i", "$e", "$ok", "$v"}, decls)
+
+	assert.Equal(t, parser.RangeKey, block.VariableDeclarations[1].Range)
+	assert.Equal(t, parser.RangeValue, block.VariableDeclarations[2].Range)
+	assert.Equal(t, ".Items", block.VariableDeclarations[2].Value.Field.Position.Text)
+
+	// describe each reference as "<text> -> <declaration>"
+	refs := []string{}
+	for _, ref := range block.VariableReferences {
+		decl := "<undefined>"
+		if ref.Declaration != nil {
+			decl = ref.Declaration.Name
+		} else if ref.IsRoot() {
+			decl = "<root>"
+		}
+		if ref.Assign {
+			decl += " (assign)"
+		}
+		refs = append(refs, ref.Position.Text+" -> "+decl)
+	}
+
+	assert.Equal(t, []string{
+		"$u.Email -> $u",
+		"$e.Title -> $e",
+		"$i -> $i",
+		"$e -> <undefined>",
+		"$ok -> $ok",
+		"$ok -> $ok",
+		"$ok -> <undefined>",
+		"$v -> $v (assign)",
+		"$missing -> <undefined> (assign)",
+		"$.Name -> <root>",
+	}, refs)
+
+	// positions cover the variable name and its field chain
+	email := block.VariableReferences[0]
+	assert.Equal(t, "$u.Email", content[email.Position.Offset+1:email.Position.Offset+1+email.Position.Length()])
+}
+
+func TestParseFunctionSets(t *testing.T) {
+	ctx := context.Background()
+
+	content := `{{- /* gotmpls:funcs sprig, helm */ -}}
+{{- /*gotype: github.com/example/types.Person*/ -}}
+{{ define "row" }}{{/* gotmpls:funcs sprig */}}{{ .Name }}{{ end }}
+{{/* not gotmpls:funcs nope */}}`
+
+	info, err := parser.Parse(ctx, "test.tmpl", []byte(content))
+	require.NoError(t, err)
+
+	got := []string{}
+	for _, block := range info.Blocks {
+		for _, set := range block.FunctionSets {
+			got = append(got, set.Name+"@"+set.Position.ID())
+			assert.Equal(t, set.Name, content[set.Position.Offset+1:set.Position.Offset+1+len(set.Name)], "position should point at the name")
+		}
+	}
+
+	assert.Equal(t, []string{"sprig@sprig@20", "helm@helm@27", "sprig@sprig@128"}, got)
+	assert.Equal(t, []string{"sprig", "helm"}, info.FunctionSets())
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"go/types"
+
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+)
+
+// Pipeline represents the commands of a pipeline. The result of each command is passed as the
+// final argument to the next one.
+//
+// Example:
+//
+//	{{ .Name | printf "%s!" | upper }}
+//	// Commands: [.Name] [printf "%s!"] [upper]
+type Pipeline struct {
+	Position position.RawPosition
+	Commands []*Command
+}
+
+// Command represents a single command of a pipeline. The operand is the function or method being
+// called, or the value of the command itself when it is not a call.
+//
+// Example:
+//
+//	{{ .Fmt "x" 3 }} -> Operand: .Fmt, Args: ["x", 3]
+type Command struct {
+	Position position.RawPosition
+	Operand  *Operand
+	Args     []*Operand
+}
+
+// Operand represents a single word of a command. At most one of Function, Field, Variable, Pipeline
+// and Type is set; none are set when the operand can not be checked statically (e.g. a chain like (.A).B).
+type Operand struct {
+	Position position.RawPosition
+	Function string             // The name of a function
+	Field    *VariableLocation  // A field access or `.`, resolved against the `.` of the pipeline
+	Variable *VariableReference // A variable access
+	Pipeline *Pipeline          // A parenthesized pipeline
+	Type     types.Type         // The untyped type of a constant, e.g. untyped string or untyped nil
+}
+
+// Pipelines returns every pipeline in the block, in order of appearance. Parenthesized pipelines
+// are included as operands of the pipeline they appear in.
+func (block *BlockInfo) Pipelines() []*Pipeline {
+	return block.pipelines
+}
+
+// newPipeline records the commands of a pipeline, including any parenthesized pipelines in its arguments.
+// It must be called before the variables declared by the pipeline are in scope.
+func (block *BlockInfo) newPipeline(pipe *parse.PipeNode, scope string) *Pipeline {
+	pipeline := &Pipeline{
+		Position: position.NewGeneralNodePosition(pipe),
+	}
+
+	for _, cmd := range pipe.Cmds {
+		command := &Command{
+			Position: position.NewCommandNodePosition(cmd),
+		}
+
+		for i, arg := range cmd.Args {
+			operand := block.newOperand(arg, scope)
+			if i == 0 {
+				command.Operand = operand
+			} else {
+				command.Args = append(command.Args, operand)
+			}
+		}
+
+		if command.Operand != nil {
+			pipeline.Commands = append(pipeline.Commands, command)
+		}
+	}
+
+	return pipeline
+}
+
+func (block *BlockInfo) newOperand(arg parse.Node, scope string) *Operand {
+	switch a := arg.(type) {
+	case *parse.IdentifierNode:
+		return &Operand{Position: position.NewIdentifierNodePosition(a), Function: a.Ident}
+	case *parse.FieldNode:
+		pos := position.NewFieldNodePosition(a)
+		return &Operand{Position: pos, Field: &VariableLocation{Position: pos, Scope: scope, Dot: block.currentDot()}}
+	case *parse.DotNode:
+		pos := position.NewDotNodePosition(a)
+		return &Operand{Position: pos, Field: &VariableLocation{Position: pos, Scope: scope, Dot: block.currentDot()}}
+	case *parse.VariableNode:
+		pos := position.NewVariableNodePosition(a)
+		return &Operand{Position: pos, Variable: &VariableReference{Position: pos, Declaration: block.lookupVariable(a.Ident[0]), Scope: scope}}
+	case *parse.PipeNode:
+		return &Operand{Position: position.NewGeneralNodePosition(a), Pipeline: block.newPipeline(a, scope)}
+	case *parse.StringNode:
+		return &Operand{Position: position.NewStringNodePosition(a), Type: types.Typ[types.UntypedString]}
+	case *parse.NumberNode:
+		return &Operand{Position: position.NewNumberNodePosition(a), Type: untypedNumberType(a)}
+	case *parse.BoolNode:
+		return &Operand{Position: position.NewBoolNodePosition(a), Type: types.Typ[types.UntypedBool]}
+	case *parse.NilNode:
+		return &Operand{Position: position.NewGeneralNodePosition(a), Type: types.Typ[types.UntypedNil]}
+	}
+
+	return &Operand{Position: position.NewGeneralNodePosition(arg)}
+}
+
+// untypedNumberType returns the type a number constant has before it is assigned to an argument
+func untypedNumberType(n *parse.NumberNode) types.Type {
+	switch {
+	case len(n.Text) > 0 && n.Text[0] == '\'':
+		return types.Typ[types.UntypedRune]
+	case n.IsInt, n.IsUint:
+		return types.Typ[types.UntypedInt]
+	case n.IsFloat:
+		return types.Typ[types.UntypedFloat]
+	}
+	return types.Typ[types.UntypedComplex]
+}
@@ -0,0 +1,493 @@
+package parser
+
+import (
+	"context"
+	"go/types"
+
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+	"gitlab.com/tozd/go/errors"
+)
+
+// DotScope represents a range or with action that rebinds `.` for the actions inside of it
+//
+// Example:
+//
+//	{{ range .Items }}{{ .Name }}{{ end }}
+//	// .Name has Dot{Keyword: "range", Value: .Items, Parent: nil}
+type DotScope struct {
+	Keyword  string               // "range" or "with"
+	Position position.RawPosition // The position of the keyword
+	Value    *PipelineValue       // The value `.` is derived from
+	Parent   *DotScope            // The enclosing range or with, nil for the block's type hint
+}
+
+// ResolveType returns the type that `.` is bound to inside of the scope, given the type of `.` at
+// the root of the block and the functions the template can call (see ast.Registry.TemplateMethods).
+// It returns nil without an error if the type can not be determined statically.
+func (d *DotScope) ResolveType(ctx context.Context, root types.Type, methods map[string]*ast.TemplateMethodInfo) (types.Type, error) {
+	if d == nil {
+		return root, nil
+	}
+
+	typ, err := d.Value.ResolveType(ctx, root, methods)
+	if err != nil {
+		return nil, errors.Errorf("resolving %s pipeline: %w", d.Keyword, err)
+	}
+
+	if typ == nil {
+		return nil, nil
+	}
+
+	if d.Keyword == "range" {
+		return ast.RangeElementType(typ)
+	}
+
+	return typ, nil
+}
+
+// Addressable reports whether the value that `.` is bound to inside of the scope is addressable at
+// execution time, so that the methods with a pointer receiver can be called on it, given the type
+// definition of `.` at the root of the block.
+func (d *DotScope) Addressable(ctx context.Context, root *ast.TypeHintDefinition, methods map[string]*ast.TemplateMethodInfo) bool {
+	if d == nil {
+		return root.Addressable
+	}
+
+	addressable := d.Value.Addressable(ctx, root, methods)
+	if d.Keyword != "range" {
+		return addressable
+	}
+
+	typ, err := d.Value.ResolveType(ctx, root.Type, methods)
+	if err != nil || typ == nil {
+		return false
+	}
+
+	return ast.RangeElementAddressable(typ, addressable)
+}
+
+// PipelineValue represents the value that a pipeline evaluates to, which is the result of its last command.
+// At most one of Field, Variable, Function and Type is set; none are set when the value can not be
+// determined statically.
+//
+// Example:
+//
+//	{{ .User }}             -> Field: .User
+//	{{ $u.Email }}          -> Variable: $u.Email
+//	{{ .Items | len }}      -> Function: len
+//	{{ "hello" }}           -> Type: string
+type PipelineValue struct {
+	Position position.RawPosition // The position of the last command's first argument
+	Field    *VariableLocation    // A field access or `.`, resolved against the `.` of the pipeline
+	Variable *VariableReference   // A variable access
+	Function string               // The name of a called function
+	Type     types.Type           // The type of a literal
+}
+
+// ResolveType returns the type of the pipeline's value, given the type of `.` at the root of the block
+// and the functions the template can call. It returns nil without an error if the type can not be
+// determined statically.
+func (p *PipelineValue) ResolveType(ctx context.Context, root types.Type, methods map[string]*ast.TemplateMethodInfo) (types.Type, error) {
+	typ, err := p.resolveType(ctx, root, methods)
+	if err != nil || typ == nil {
+		return nil, err
+	}
+
+	// values of type any are only known at execution time
+	if iface, ok := typ.Underlying().(*types.Interface); ok && iface.Empty() {
+		return nil, nil
+	}
+
+	return typ, nil
+}
+
+func (p *PipelineValue) resolveType(ctx context.Context, root types.Type, methods map[string]*ast.TemplateMethodInfo) (types.Type, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	switch {
+	case p.Field != nil:
+		dot, err := p.Field.Dot.ResolveType(ctx, root, methods)
+		if err != nil || dot == nil {
+			return nil, err
+		}
+		return ast.FieldPathType(ctx, dot, p.Field.Position.Text)
+	case p.Variable != nil:
+		return p.Variable.ResolveType(ctx, root, methods)
+	case p.Function != "":
+		method, ok := methods[p.Function]
+		if !ok || len(method.Results) == 0 {
+			return nil, nil
+		}
+		return method.Results[0], nil
+	case p.Type != nil:
+		return p.Type, nil
+	}
+
+	return nil, nil
+}
+
+// Addressable reports whether the pipeline's value is addressable at execution time, given the type
+// definition of `.` at the root of the block. The results of functions and methods are not.
+func (p *PipelineValue) Addressable(ctx context.Context, root *ast.TypeHintDefinition, methods map[string]*ast.TemplateMethodInfo) bool {
+	if p == nil {
+		return false
+	}
+
+	switch {
+	case p.Field != nil:
+		dot, err := p.Field.Dot.ResolveType(ctx, root.Type, methods)
+		if err != nil || dot == nil {
+			return false
+		}
+		return ast.FieldPathAddressable(ctx, dot, p.Field.Dot.Addressable(ctx, root, methods), p.Field.Position.Text)
+	case p.Variable != nil:
+		typ, err := p.Variable.VariableType(ctx, root.Type, methods)
+		if err != nil || typ == nil {
+			return false
+		}
+		return ast.FieldPathAddressable(ctx, typ, p.Variable.VariableAddressable(ctx, root, methods), p.Variable.FieldPath())
+	}
+
+	return false
+}
+
+// TemplateVariable represents the declaration of a $variable in a template
+//
+// Example:
+//
+//	{{ $u := .User }}                   -> Name: $u, Value: .User
+//	{{ range $i, $e := .Items }}        -> $i (RangeKey), $e (RangeValue), both with Value: .Items
+type TemplateVariable struct {
+	Name     string
+	Position position.RawPosition // The position of the variable in its declaration
+	Value    *PipelineValue       // The pipeline the variable is initialized from
+	Range    RangeVariableKind    // How the variable is bound by a range, if at all
+	Scope    string
+}
+
+// RangeVariableKind describes which part of a range iteration a variable is bound to
+type RangeVariableKind int
+
+const (
+	NotRangeVariable RangeVariableKind = iota
+	RangeKey                           // the index or key, e.g. $i in {{ range $i, $e := .Items }}
+	RangeValue                         // the element, e.g. $e in {{ range $e := .Items }}
+)
+
+// ResolveType returns the type of the variable, given the type of `.` at the root of the block and
+// the functions the template can call. It returns nil without an error if the type can not be
+// determined statically.
+func (v *TemplateVariable) ResolveType(ctx context.Context, root types.Type, methods map[string]*ast.TemplateMethodInfo) (types.Type, error) {
+	typ, err := v.Value.ResolveType(ctx, root, methods)
+	if err != nil || typ == nil {
+		return nil, err
+	}
+
+	switch v.Range {
+	case RangeKey:
+		return ast.RangeKeyType(typ)
+	case RangeValue:
+		return ast.RangeElementType(typ)
+	}
+
+	return typ, nil
+}
+
+// Addressable reports whether the value of the variable is addressable at execution time, given the
+// type definition of `.` at the root of the block. Variables keep the addressability of their value.
+func (v *TemplateVariable) Addressable(ctx context.Context, root *ast.TypeHintDefinition, methods map[string]*ast.TemplateMethodInfo) bool {
+	addressable := v.Value.Addressable(ctx, root, methods)
+
+	switch v.Range {
+	case RangeKey:
+		return false
+	case RangeValue:
+		typ, err := v.Value.ResolveType(ctx, root.Type, methods)
+		if err != nil || typ == nil {
+			return false
+		}
+		return ast.RangeElementAddressable(typ, addressable)
+	}
+
+	return addressable
+}
+
+// VariableReference represents a use of a $variable, optionally followed by a field chain
+//
+// Example:
+//
+//	{{ $u.Email }} -> Position.Text: $u.Email, Declaration: $u
+type VariableReference struct {
+	Position    position.RawPosition
+	Declaration *TemplateVariable // The variable in scope with the same name, nil for `$` and undefined variables
+	Assign      bool              // Whether the variable is being assigned to with `=`
+	Scope       string
+}
+
+// Name returns the name of the variable without the field chain, e.g. "$u" for "$u.Email"
+func (r *VariableReference) Name() string {
+	name, _, _ := cutField(r.Position.Text)
+	return name
+}
+
+// FieldPath returns the field chain after the variable name, e.g. ".Email" for "$u.Email"
+func (r *VariableReference) FieldPath() string {
+	_, path, _ := cutField(r.Position.Text)
+	return path
+}
+
+// IsRoot returns true for references to `$`, which is bound to the block's type hint
+func (r *VariableReference) IsRoot() bool {
+	return r.Name() == "$"
+}
+
+// IsUndefined returns true if the reference does not refer to a variable in scope
+func (r *VariableReference) IsUndefined() bool {
+	return r.Declaration == nil && !r.IsRoot()
+}
+
+// VariableType returns the type of the referenced variable, without the field chain. It returns nil
+// without an error if the type can not be determined statically.
+func (r *VariableReference) VariableType(ctx context.Context, root types.Type, methods map[string]*ast.TemplateMethodInfo) (types.Type, error) {
+	if r.IsRoot() {
+		return root, nil
+	}
+
+	if r.Declaration == nil {
+		return nil, nil
+	}
+
+	return r.Declaration.ResolveType(ctx, root, methods)
+}
+
+// VariableAddressable reports whether the value of the referenced variable, without the field chain,
+// is addressable at execution time. `$` is bound to the root of the block.
+func (r *VariableReference) VariableAddressable(ctx context.Context, root *ast.TypeHintDefinition, methods map[string]*ast.TemplateMethodInfo) bool {
+	if r.IsRoot() {
+		return root.Addressable
+	}
+
+	if r.Declaration == nil {
+		return false
+	}
+
+	return r.Declaration.Addressable(ctx, root, methods)
+}
+
+// ResolveType returns the type that the reference, including its field chain, evaluates to.
+// It returns nil without an error if the type can not be determined statically.
+func (r *VariableReference) ResolveType(ctx context.Context, root types.Type, methods map[string]*ast.TemplateMethodInfo) (types.Type, error) {
+	typ, err := r.VariableType(ctx, root, methods)
+	if err != nil || typ == nil {
+		return nil, err
+	}
+
+	return ast.FieldPathType(ctx, typ, r.FieldPath())
+}
+
+func cutField(text string) (string, string, bool) {
+	for i := 1; i < len(text); i++ {
+		if text[i] == '.' {
+			return text[:i], text[i:], true
+		}
+	}
+	return text, "", false
+}
+
+// walkDotBranch processes a range or with node, whose body is evaluated with `.` rebound to
+// (an element of) the value of its pipeline. The pipeline and else branch keep the outer `.`.
+// Variables declared in the pipeline or body go out of scope at the end of the node.
+func (block *BlockInfo) walkDotBranch(ctx context.Context, n *parse.BranchNode, keyword string, scope string, seenVars, seenFuncs *position.PositionsSeenMap) error {
+	mark := len(block.varStack)
+	defer func() {
+		block.varStack = block.varStack[:mark]
+	}()
+
+	if n.Pipe != nil {
+		for _, cmd := range n.Pipe.Cmds {
+			for _, arg := range cmd.Args {
+				if field, ok := arg.(*parse.FieldNode); ok {
+					if item := createVarLocation(field, scope, block.currentDot(), seenVars); item != nil {
+						block.Variables = append(block.Variables, *item)
+					}
+				}
+			}
+		}
+	}
+	if err := block.walkNode(ctx, n.Pipe, scope, n, seenVars, seenFuncs); err != nil {
+		return err
+	}
+
+	dot := &DotScope{
+		Keyword:  keyword,
+		Position: position.NewBasicPosition(keyword, int(n.Pos)),
+		Value:    block.pipelineValue(n.Pipe, scope),
+		Parent:   block.currentDot(),
+	}
+	block.Scopes = append(block.Scopes, dot)
+
+	block.dotStack = append(block.dotStack, dot)
+	err := block.walkNode(ctx, n.List, scope, n, seenVars, seenFuncs)
+	block.dotStack = block.dotStack[:len(block.dotStack)-1]
+	if err != nil {
+		return err
+	}
+
+	if n.ElseList != nil {
+		if err := block.walkNode(ctx, n.ElseList, scope, n, seenVars, seenFuncs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walkPipeVariables records the variables used in a pipeline, followed by the variables it
+// declares or assigns. The parent is used to detect range declarations.
+func (block *BlockInfo) walkPipeVariables(pipe *parse.PipeNode, scope string, parent parse.Node) {
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			block.walkArgVariables(arg, scope)
+		}
+	}
+
+	isRange := parent != nil && parent.Type() == parse.NodeRange
+
+	for i, decl := range pipe.Decl {
+		pos := position.NewVariableNodePosition(decl)
+
+		if pipe.IsAssign {
+			block.VariableReferences = append(block.VariableReferences, &VariableReference{
+				Position:    pos,
+				Declaration: block.lookupVariable(pos.Text),
+				Assign:      true,
+				Scope:       scope,
+			})
+			continue
+		}
+
+		variable := &TemplateVariable{
+			Name:     pos.Text,
+			Position: pos,
+			Value:    block.pipelineValue(pipe, scope),
+			Scope:    scope,
+		}
+
+		if isRange {
+			variable.Range = RangeValue
+			if len(pipe.Decl) == 2 && i == 0 {
+				variable.Range = RangeKey
+			}
+		}
+
+		block.VariableDeclarations = append(block.VariableDeclarations, variable)
+		block.varStack = append(block.varStack, variable)
+	}
+}
+
+func (block *BlockInfo) walkArgVariables(arg parse.Node, scope string) {
+	switch a := arg.(type) {
+	case *parse.VariableNode:
+		pos := position.NewVariableNodePosition(a)
+		block.VariableReferences = append(block.VariableReferences, &VariableReference{
+			Position:    pos,
+			Declaration: block.lookupVariable(a.Ident[0]),
+			Scope:       scope,
+		})
+	case *parse.PipeNode:
+		block.walkPipeVariables(a, scope, nil)
+	case *parse.ChainNode:
+		block.walkArgVariables(a.Node, scope)
+	}
+}
+
+// pipelineValue returns the value of a pipeline, based on its last command
+func (block *BlockInfo) pipelineValue(pipe *parse.PipeNode, scope string) *PipelineValue {
+	if pipe == nil || len(pipe.Cmds) == 0 {
+		return nil
+	}
+
+	cmd := pipe.Cmds[len(pipe.Cmds)-1]
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+
+	switch arg := cmd.Args[0].(type) {
+	case *parse.FieldNode:
+		pos := position.NewFieldNodePosition(arg)
+		return &PipelineValue{Position: pos, Field: &VariableLocation{Position: pos, Scope: scope, Dot: block.currentDot()}}
+	case *parse.DotNode:
+		pos := position.NewDotNodePosition(arg)
+		return &PipelineValue{Position: pos, Field: &VariableLocation{Position: pos, Scope: scope, Dot: block.currentDot()}}
+	case *parse.VariableNode:
+		pos := position.NewVariableNodePosition(arg)
+		return &PipelineValue{Position: pos, Variable: &VariableReference{Position: pos, Declaration: block.lookupVariable(arg.Ident[0]), Scope: scope}}
+	case *parse.IdentifierNode:
+		return &PipelineValue{Position: position.NewIdentifierNodePosition(arg), Function: arg.Ident}
+	case *parse.StringNode:
+		if len(cmd.Args) == 1 {
+			return &PipelineValue{Position: position.NewStringNodePosition(arg), Type: types.Typ[types.String]}
+		}
+	case *parse.NumberNode:
+		if len(cmd.Args) == 1 {
+			return &PipelineValue{Position: position.NewNumberNodePosition(arg), Type: numberType(arg)}
+		}
+	case *parse.BoolNode:
+		if len(cmd.Args) == 1 {
+			return &PipelineValue{Position: position.NewBoolNodePosition(arg), Type: types.Typ[types.Bool]}
+		}
+	case *parse.PipeNode:
+		if len(cmd.Args) == 1 {
+			return block.pipelineValue(arg, scope)
+		}
+	}
+
+	return nil
+}
+
+// numberType returns the type a number constant has when it is used as a value
+func numberType(n *parse.NumberNode) types.Type {
+	switch {
+	case len(n.Text) > 0 && n.Text[0] == '\'':
+		return types.Typ[types.Rune]
+	case n.IsInt, n.IsUint:
+		return types.Typ[types.Int]
+	case n.IsFloat:
+		return types.Typ[types.Float64]
+	}
+	return types.Typ[types.Complex128]
+}
+
+// LookupVariable returns the declaration of a variable that is closest before an offset in the block,
+// e.g. to resolve a variable that is being typed and so is not parsed as a reference yet
+func (block *BlockInfo) LookupVariable(name string, offset int) *TemplateVariable {
+	var found *TemplateVariable
+	for _, variable := range block.VariableDeclarations {
+		if variable.Name == name && variable.Position.Offset < offset {
+			if found == nil || variable.Position.Offset > found.Position.Offset {
+				found = variable
+			}
+		}
+	}
+	return found
+}
+
+func (block *BlockInfo) lookupVariable(name string) *TemplateVariable {
+	for i := len(block.varStack) - 1; i >= 0; i-- {
+		if block.varStack[i].Name == name {
+			return block.varStack[i]
+		}
+	}
+	return nil
+}
+
+func (block *BlockInfo) currentDot() *DotScope {
+	if len(block.dotStack) == 0 {
+		return nil
+	}
+	return block.dotStack[len(block.dotStack)-1]
+}
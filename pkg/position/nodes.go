@@ -42,6 +42,24 @@ func NewFieldNodePosition(node *parse.FieldNode) RawPosition {
 	}
 }
 
+// NewVariableNodePosition creates a RawPosition from a template parser's VariableNode.
+// The parser positions variables with a field chain at their first field, so the offset is
+// moved back to the start of the variable name.
+//
+// Example:
+//
+//	{{$user.Name}} -> covers "$user.Name"
+func NewVariableNodePosition(node *parse.VariableNode) RawPosition {
+	start := int(node.Pos)
+	if len(node.Ident) > 1 {
+		start -= len(node.Ident[0])
+	}
+	return RawPosition{
+		Text:   node.String(),
+		Offset: start - 1,
+	}
+}
+
 // NewStringNodePosition creates a new position from a string node
 func NewStringNodePosition(node *parse.StringNode) RawPosition {
 	// Handle escaped quotes in the text
@@ -63,26 +81,30 @@ func NewGeneralNodePosition(node parse.Node) RawPosition {
 	}
 }
 
-// NewBranchEndPosition creates a RawPosition for an end keyword at the end of a branch node
+// NewBranchEndPosition creates a RawPosition for the end keyword that closes a branch node.
+// For else if and else with chains, this is the end keyword that closes the whole chain.
 func NewBranchEndPosition(node *parse.BranchNode) RawPosition {
-	// The end position is after the last node in the list
+	// The end node is the last node in the list
 	// If there's an else list, use that, otherwise use the main list
 	list := node.List
 	if node.ElseList != nil {
 		list = node.ElseList
 	}
 
-	// Find the last node's position
-	var lastPos parse.Pos
 	if len(list.Nodes) > 0 {
-		lastPos = list.Nodes[len(list.Nodes)-1].Position()
-	} else {
-		lastPos = list.Position()
+		switch last := list.Nodes[len(list.Nodes)-1].(type) {
+		case *parse.EndNode:
+			return NewKeywordPosition(last)
+		case *parse.IfNode:
+			return NewBranchEndPosition(&last.BranchNode)
+		case *parse.WithNode:
+			return NewBranchEndPosition(&last.BranchNode)
+		}
 	}
 
 	return RawPosition{
 		Text:   "end",
-		Offset: int(lastPos),
+		Offset: int(list.Position()),
 	}
 }
 
@@ -160,3 +182,70 @@ func NewEndNodePosition(node *parse.EndNode) RawPosition {
 		Offset: int(node.Pos),
 	}
 }
+
+// OperandSpan returns the offsets of the start and end of an argument of a command in the
+// content, e.g. from the opening to the closing parenthesis of a parenthesized pipeline.
+// The position of a field or variable with several identifiers is the position of its last
+// identifier, so its start is computed from its text.
+func OperandSpan(content string, node parse.Node) (int, int) {
+	pos := int(node.Position())
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		end := pos + 1 + len(n.Ident[len(n.Ident)-1])
+		return end - len(n.String()), end
+	case *parse.VariableNode:
+		if len(n.Ident) == 1 {
+			return pos, pos + len(n.Ident[0])
+		}
+		end := pos + 1 + len(n.Ident[len(n.Ident)-1])
+		return end - len(n.String()), end
+	case *parse.ChainNode:
+		end := pos
+		for _, field := range n.Field {
+			end += 1 + len(field)
+		}
+		start, _ := OperandSpan(content, n.Node)
+		return start, end
+	case *parse.PipeNode:
+		// a parenthesized pipeline
+		start, end := PipeSpan(content, n)
+		start = strings.LastIndex(content[:start], "(")
+		if idx := strings.IndexByte(content[end:], ')'); idx != -1 {
+			end += idx + 1
+		}
+		return start, end
+	case *parse.StringNode:
+		return pos, pos + len(n.Quoted)
+	case *parse.NumberNode:
+		return pos, pos + len(n.Text)
+	case *parse.IdentifierNode:
+		return pos, pos + len(n.Ident)
+	default:
+		return pos, pos + len(node.String())
+	}
+}
+
+// PipeSpan returns the offsets of the start and end of the declarations and commands of a
+// pipeline in the content, without the parentheses of a parenthesized pipeline
+func PipeSpan(content string, pipe *parse.PipeNode) (int, int) {
+	start, end := int(pipe.Position()), int(pipe.Position())
+	if len(pipe.Decl) > 0 {
+		start, _ = OperandSpan(content, pipe.Decl[0])
+	} else if len(pipe.Cmds) > 0 {
+		start, _ = CommandSpan(content, pipe.Cmds[0])
+	}
+	if len(pipe.Cmds) > 0 {
+		_, end = CommandSpan(content, pipe.Cmds[len(pipe.Cmds)-1])
+	}
+	return start, end
+}
+
+// CommandSpan returns the offsets of the start and end of a command of a pipeline in the content
+func CommandSpan(content string, cmd *parse.CommandNode) (int, int) {
+	if len(cmd.Args) == 0 {
+		return int(cmd.Pos), int(cmd.Pos)
+	}
+	start, _ := OperandSpan(content, cmd.Args[0])
+	_, end := OperandSpan(content, cmd.Args[len(cmd.Args)-1])
+	return start, end
+}
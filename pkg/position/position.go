@@ -324,6 +324,30 @@ func (me RawPositionArray) ToStrings() []string {
 	return texts
 }
 
+// ToLSPRange converts a Range to an LSP range
+func (r Range) ToLSPRange() protocol.Range {
+	return protocol.Range{
+		Start: protocol.Position{Line: uint32(r.Start.Line), Character: uint32(r.Start.Character)},
+		End:   protocol.Position{Line: uint32(r.End.Line), Character: uint32(r.End.Character)},
+	}
+}
+
+// OffsetToPlace converts a byte offset into a Place.
+// Unlike GetLineAndColumn, the offset is used exactly as given, which makes it suitable
+// for offsets that come straight from the source text (e.g. regex matches).
+//
+// Example:
+//
+//	text := "Hello\nWorld"
+//	OffsetToPlace(text, 6) // Place{Line: 1, Character: 0}
+func OffsetToPlace(text string, offset int) Place {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	line := strings.Count(text[:offset], "\n")
+	return Place{Line: line, Character: offset - (strings.LastIndex(text[:offset], "\n") + 1)}
+}
+
 func NewRangeFromLSPRange(ranged protocol.Range) Range {
 	return Range{
 		Start: Place{Line: int(ranged.Start.Line), Character: int(ranged.Start.Character)},
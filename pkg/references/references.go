@@ -0,0 +1,221 @@
+// Package references provides a reverse index from go objects to the templates that use them.
+package references
+
+import (
+	"context"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/definition"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Reference represents a single template usage of a go object
+type Reference struct {
+	// Object is the struct field (*types.Var), method (*types.Func) or type (*types.TypeName) being used
+	Object types.Object
+	// Owner is the named type that declares the field or method, nil for type hints
+	Owner *types.TypeName
+	// Location is the location of the usage in the template
+	Location definition.Location
+}
+
+// Key returns the name used to look up the reference with Index.ReferencesByName
+func (r Reference) Key() string {
+	if r.Owner == nil {
+		return ObjectKey(r.Object.Pkg().Path(), r.Object.Name(), "")
+	}
+	return ObjectKey(r.Owner.Pkg().Path(), r.Owner.Name(), r.Object.Name())
+}
+
+// ObjectKey returns the lookup key for a member of a go type, or for the type itself when member is empty
+//
+// Example:
+//
+//	ObjectKey("github.com/example/types", "Person", "Email") // "github.com/example/types.Person.Email"
+func ObjectKey(pkgPath, typeName, member string) string {
+	if member == "" {
+		return pkgPath + "." + typeName
+	}
+	return pkgPath + "." + typeName + "." + member
+}
+
+// Index is a reverse index from go objects to the template locations that use them
+type Index struct {
+	references []Reference
+	byKey      map[string][]int
+}
+
+// BuildIndex parses every template file in the registry and resolves each field and method
+// usage against the type hint of its block.
+//
+// Templates that fail to parse and fields that do not resolve are skipped, as they are already
+// reported as diagnostics.
+func BuildIndex(ctx context.Context, registry *ast.Registry) (*Index, error) {
+	if registry == nil {
+		return nil, errors.New("registry cannot be nil")
+	}
+
+	idx := &Index{
+		byKey: make(map[string][]int),
+	}
+
+	for _, pkg := range registry.Packages {
+		files := make([]string, 0, len(pkg.TemplateFiles))
+		for file := range pkg.TemplateFiles {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			info, err := parser.ParseWithRegistry(ctx, file, []byte(pkg.TemplateFiles[file]), registry)
+			if err != nil {
+				zerolog.Ctx(ctx).Debug().Err(err).Str("file", file).Msg("skipping template that failed to parse")
+				continue
+			}
+
+			for _, ref := range FindReferencesInTemplate(ctx, info, registry) {
+				idx.add(ref)
+			}
+		}
+	}
+
+	return idx, nil
+}
+
+func (idx *Index) add(ref Reference) {
+	idx.references = append(idx.references, ref)
+	key := ref.Key()
+	idx.byKey[key] = append(idx.byKey[key], len(idx.references)-1)
+}
+
+// All returns every reference in the index
+func (idx *Index) All() []Reference {
+	return idx.references
+}
+
+// References returns the template locations that use the given go object
+func (idx *Index) References(obj types.Object) []definition.Location {
+	locs := []definition.Location{}
+	for _, ref := range idx.references {
+		if ref.Object == obj {
+			locs = append(locs, ref.Location)
+		}
+	}
+	return locs
+}
+
+// ReferencesByName returns the template locations that use a member of a go type, or the type
+// itself when member is empty. Unlike References, it can be used with objects that were loaded
+// outside of the registry the index was built from (e.g. by gopls).
+func (idx *Index) ReferencesByName(pkgPath, typeName, member string) []definition.Location {
+	locs := []definition.Location{}
+	for _, i := range idx.byKey[ObjectKey(pkgPath, typeName, member)] {
+		locs = append(locs, idx.references[i].Location)
+	}
+	return locs
+}
+
+// FindReferencesInTemplate returns every go object usage in a template parsed with parser.ParseWithRegistry
+func FindReferencesInTemplate(ctx context.Context, info *parser.ParsedTemplateFile, registry *ast.Registry) []Reference {
+	refs := []Reference{}
+	seen := make(map[int]bool)
+
+	for _, block := range info.Blocks {
+		if block.TypeHint == nil {
+			continue
+		}
+
+		thd, err := ast.BuildTypeHintDefinitionFromRegistry(ctx, block.TypeHint.TypePath, registry)
+		if err != nil {
+			zerolog.Ctx(ctx).Debug().Err(err).Str("file", info.Filename).Msg("skipping block with unresolved type hint")
+			continue
+		}
+
+		methods := registry.TemplateMethods(info.Filename, info.FunctionSets()...)
+
+		// implicit type hints are declared by the go code, they have no location in the template
+		if root := thd.TypeName(); root != nil && block.TypeHint.Origin == "" {
+			refs = append(refs, Reference{
+				Object:   root,
+				Location: newLocation(info, block.TypeHint.Position),
+			})
+		}
+
+		for _, variable := range block.Variables {
+			if seen[variable.Position.Offset] {
+				continue
+			}
+			seen[variable.Position.Offset] = true
+
+			dot, err := variable.DotTypeHintDefinition(ctx, thd, methods)
+			if err != nil || dot == nil {
+				continue
+			}
+
+			refs = append(refs, resolveVariable(ctx, info, dot, variable.Position)...)
+		}
+
+		for _, ref := range block.VariableReferences {
+			if ref.FieldPath() == "" {
+				continue
+			}
+
+			varType, err := ref.VariableType(ctx, thd.Type, methods)
+			if err != nil || varType == nil {
+				continue
+			}
+
+			variable, err := ast.GenerateTypeHintDefinitionFromType(ctx, varType, ref.VariableAddressable(ctx, thd, methods))
+			if err != nil {
+				continue
+			}
+
+			path := position.NewBasicPosition(ref.FieldPath(), ref.Position.Offset+len(ref.Name()))
+			refs = append(refs, resolveVariable(ctx, info, variable, path)...)
+		}
+	}
+
+	return refs
+}
+
+// resolveVariable walks a field path like ".Address.City" from the root value, returning a
+// reference for each field or method along the way.
+func resolveVariable(ctx context.Context, info *parser.ParsedTemplateFile, thd *ast.TypeHintDefinition, pos position.RawPosition) []Reference {
+	if !strings.HasPrefix(pos.Text, ".") {
+		return nil
+	}
+
+	// the fields up to a part that does not resolve are still referenced
+	fields, _ := ast.GenerateFieldInfosFromPosition(ctx, thd, pos)
+
+	refs := []Reference{}
+	offset := pos.Offset + 1
+	for _, field := range fields {
+		obj := field.Type.Obj()
+		name := obj.Name()
+		// the keys of maps are not go objects
+		if obj.Pkg() != nil {
+			refs = append(refs, Reference{
+				Object:   obj,
+				Owner:    field.Owner,
+				Location: newLocation(info, position.NewBasicPosition(name, offset)),
+			})
+		}
+		offset += len(name) + 1
+	}
+
+	return refs
+}
+
+func newLocation(info *parser.ParsedTemplateFile, pos position.RawPosition) definition.Location {
+	return definition.Location{
+		File:  info.Filename,
+		Range: pos.GetRange(info.SourceContent),
+	}
+}
@@ -0,0 +1,185 @@
+package references_test
+
+import (
+	"context"
+	"go/types"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/definition"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/references"
+)
+
+func createMockRegistry(t *testing.T) (*ast.Registry, *types.Named, *types.Named) {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+	address := pkgd.AddStruct("Address", map[string]types.Type{
+		"Street": types.Typ[types.String],
+		"City":   types.Typ[types.String],
+	})
+
+	person := pkgd.AddStruct("Person", map[string]types.Type{
+		"Name":    types.Typ[types.String],
+		"Email":   types.Typ[types.String],
+		"Address": types.NewPointer(address),
+	})
+
+	sig := types.NewSignature(
+		types.NewVar(0, pkgd.Package.Types, "p", person),
+		types.NewTuple(),
+		types.NewTuple(types.NewVar(0, pkgd.Package.Types, "", address)),
+		false,
+	)
+	person.AddMethod(types.NewFunc(0, pkgd.Package.Types, "Home", sig))
+
+	pkgd.AddTemplateFile("a.tmpl", "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Email }} {{ .Address.City }}")
+	pkgd.AddTemplateFile("b.tmpl", "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ if .Email }}{{ .Home.City }}{{ end }}")
+	pkgd.AddTemplateFile("c.tmpl", "no type hint {{ .Email }}")
+	pkgd.AddTemplateFile("d.tmpl", "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ $a := .Address }}{{ $a.City }}")
+
+	return registry, person, address
+}
+
+func loc(file string, line, start, end int) definition.Location {
+	return definition.Location{
+		File: file,
+		Range: position.Range{
+			Start: position.Place{Line: line, Character: start},
+			End:   position.Place{Line: line, Character: end},
+		},
+	}
+}
+
+func TestIndexReferences(t *testing.T) {
+	ctx := context.Background()
+	registry, person, address := createMockRegistry(t)
+
+	idx, err := references.BuildIndex(ctx, registry)
+	require.NoError(t, err)
+
+	field := func(named *types.Named, name string) types.Object {
+		obj, _, _ := types.LookupFieldOrMethod(named, true, named.Obj().Pkg(), name)
+		require.NotNil(t, obj, "field %s not found", name)
+		return obj
+	}
+
+	tests := []struct {
+		name string
+		obj  types.Object
+		want []definition.Location
+	}{
+		{
+			name: "field used in multiple templates",
+			obj:  field(person, "Email"),
+			want: []definition.Location{loc("a.tmpl", 1, 4, 9), loc("b.tmpl", 1, 7, 12)},
+		},
+		{
+			name: "nested field through pointer and method",
+			obj:  field(address, "City"),
+			want: []definition.Location{loc("a.tmpl", 1, 25, 29), loc("b.tmpl", 1, 24, 28), loc("d.tmpl", 1, 26, 30)},
+		},
+		{
+			name: "method",
+			obj:  field(person, "Home"),
+			want: []definition.Location{loc("b.tmpl", 1, 19, 23)},
+		},
+		{
+			name: "type hint",
+			obj:  person.Obj(),
+			want: []definition.Location{loc("a.tmpl", 0, 14, 45), loc("b.tmpl", 0, 14, 45), loc("d.tmpl", 0, 14, 45)},
+		},
+		{
+			name: "unused field",
+			obj:  field(person, "Name"),
+			want: []definition.Location{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, idx.References(tt.obj))
+		})
+	}
+}
+
+func TestIndexReferencesByName(t *testing.T) {
+	ctx := context.Background()
+	registry, _, _ := createMockRegistry(t)
+
+	idx, err := references.BuildIndex(ctx, registry)
+	require.NoError(t, err)
+
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 1, 25, 29), loc("b.tmpl", 1, 24, 28), loc("d.tmpl", 1, 26, 30)}, idx.ReferencesByName("github.com/example/types", "Address", "City"))
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 1, 17, 24), loc("d.tmpl", 1, 10, 17)}, idx.ReferencesByName("github.com/example/types", "Person", "Address"))
+	assert.Empty(t, idx.ReferencesByName("github.com/example/types", "Person", "Street"))
+}
+
+func TestIndexPromotedAndMapFields(t *testing.T) {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+	pkg := pkgd.Package.Types
+
+	address := pkgd.AddStruct("Address", map[string]types.Type{
+		"City": types.Typ[types.String],
+	})
+
+	office := types.NewNamed(types.NewTypeName(0, pkg, "Office", nil), types.NewStruct([]*types.Var{
+		types.NewField(0, pkg, "Address", address, true),
+		types.NewField(0, pkg, "Rooms", types.NewMap(types.Typ[types.String], types.NewPointer(address)), false),
+	}, nil), nil)
+	pkg.Scope().Insert(office.Obj())
+
+	pkgd.AddTemplateFile("a.tmpl", "{{- /*gotype: github.com/example/types.Office*/ -}}\n{{ .City }} {{ with .Rooms.lobby }}{{ .City }}{{ end }}")
+
+	idx, err := references.BuildIndex(ctx, registry)
+	require.NoError(t, err)
+
+	// promoted fields are referenced through the type that declares them, and map keys are skipped
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 1, 4, 8), loc("a.tmpl", 1, 39, 43)}, idx.ReferencesByName("github.com/example/types", "Address", "City"))
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 1, 21, 26)}, idx.ReferencesByName("github.com/example/types", "Office", "Rooms"))
+}
+
+func TestIndexImplicitTypeHints(t *testing.T) {
+	ctx := context.Background()
+	registry, person, _ := createMockRegistry(t)
+
+	pkgd := registry.Packages[0]
+	pkgd.AddTemplateFile("/templates/e.tmpl", "{{ .Name }}")
+	pkgd.ExecuteHints = []*ast.ExecuteHint{{
+		Name:     "e.tmpl",
+		Files:    map[string]string{"/templates/e.tmpl": "e.tmpl"},
+		TypePath: "github.com/example/types.Person",
+	}}
+
+	idx, err := references.BuildIndex(ctx, registry)
+	require.NoError(t, err)
+
+	// the type of an implicit hint is declared by the go code, so it is not referenced by the template
+	assert.Equal(t, []definition.Location{loc("/templates/e.tmpl", 0, 4, 8)}, idx.ReferencesByName("github.com/example/types", "Person", "Name"))
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 0, 14, 45), loc("b.tmpl", 0, 14, 45), loc("d.tmpl", 0, 14, 45)}, idx.References(person.Obj()))
+}
+
+func TestIndexCompositeTypeHints(t *testing.T) {
+	ctx := context.Background()
+	registry, person, _ := createMockRegistry(t)
+
+	pkgd := registry.Packages[0]
+	pkgd.AddTemplateFile("e.tmpl", "{{- /*gotype: []github.com/example/types.Person*/ -}}\n{{ range . }}{{ .Email }}{{ end }}")
+	pkgd.AddTemplateFile("f.tmpl", "{{- /*gotype: map[string]*github.com/example/types.Person*/ -}}\n{{ .ann.Email }}")
+	pkgd.AddTemplateFile("g.tmpl", "{{- /*gotype: struct{Email string}*/ -}}\n{{ .Email }}")
+
+	idx, err := references.BuildIndex(ctx, registry)
+	require.NoError(t, err)
+
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 1, 4, 9), loc("b.tmpl", 1, 7, 12), loc("e.tmpl", 1, 17, 22), loc("f.tmpl", 1, 8, 13)}, idx.ReferencesByName("github.com/example/types", "Person", "Email"))
+	assert.Equal(t, []definition.Location{loc("a.tmpl", 0, 14, 45), loc("b.tmpl", 0, 14, 45), loc("d.tmpl", 0, 14, 45), loc("e.tmpl", 0, 14, 47), loc("f.tmpl", 0, 14, 57)}, idx.References(person.Obj()))
+}
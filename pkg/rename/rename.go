@@ -0,0 +1,180 @@
+// Package rename provides functionality for renaming go struct fields and methods across go code and templates.
+package rename
+
+import (
+	"context"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/definition"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/references"
+	"gitlab.com/tozd/go/errors"
+)
+
+// TextEdit represents a replacement of a range of text in a file
+type TextEdit struct {
+	Range   position.Range
+	NewText string
+}
+
+// Target represents the field or method that a rename request applies to
+type Target struct {
+	// Object is the go struct field or method being renamed
+	Object types.Object
+	// Range is the range of the reference under the cursor in the current template
+	Range position.Range
+	// Owner is the named type that declares the field or method, nil for the fields of unnamed structs
+	Owner *types.TypeName
+}
+
+// PrepareRename checks that the reference at the given position can be renamed.
+//
+// Template functions (builtins, function sets and the functions of FuncMaps), type hints and paths
+// that fail to resolve against the block's type hint cannot be renamed.
+func PrepareRename(ctx context.Context, info *parser.ParsedTemplateFile, pos position.RawPosition, registry *ast.Registry) (*Target, error) {
+	methods := registry.TemplateMethods(info.Filename, info.FunctionSets()...)
+	for _, block := range info.Blocks {
+		for _, fn := range block.Functions {
+			if !pos.HasRangeOverlapWith(fn.Position) {
+				continue
+			}
+			if _, ok := methods[fn.Position.Text]; ok {
+				return nil, errors.Errorf("cannot rename template function %s", fn.Position.Text)
+			}
+		}
+	}
+
+	cursor := position.OffsetToPlace(info.SourceContent, pos.Offset)
+
+	for _, ref := range references.FindReferencesInTemplate(ctx, info, registry) {
+		if !contains(ref.Location.Range, cursor) {
+			continue
+		}
+
+		if _, ok := ref.Object.(*types.TypeName); ok {
+			return nil, errors.Errorf("cannot rename type %s from a type hint", ref.Object.Name())
+		}
+
+		return &Target{
+			Object: ref.Object,
+			Range:  ref.Location.Range,
+			Owner:  ref.Owner,
+		}, nil
+	}
+
+	return nil, errors.Errorf("no field or method that can be renamed at %s", pos.ID())
+}
+
+// Rename returns the edits, keyed by file, that rename the field or method at the given position
+// to newName. The go declaration and its uses in the go code of the registry's packages are renamed
+// along with every template reference in the registry. A name that the type already has for another
+// field or method is refused.
+//
+// The current template is resolved from info rather than the registry, so unsaved changes are included.
+func Rename(ctx context.Context, info *parser.ParsedTemplateFile, pos position.RawPosition, registry *ast.Registry, newName string) (map[string][]TextEdit, error) {
+	if !token.IsIdentifier(newName) {
+		return nil, errors.Errorf("%q is not a valid identifier", newName)
+	}
+
+	if !token.IsExported(newName) {
+		return nil, errors.Errorf("%q must be exported to be used in a template", newName)
+	}
+
+	target, err := PrepareRename(ctx, info, pos, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.Owner != nil {
+		if obj, _, _ := types.LookupFieldOrMethod(target.Owner.Type(), true, target.Owner.Pkg(), newName); obj != nil && obj != target.Object {
+			return nil, errors.Errorf("%s already has a field or method named %s", target.Owner.Name(), newName)
+		}
+	}
+
+	locs := []definition.Location{}
+
+	decl, err := definition.NewLocationFromObject(registry, target.Object)
+	if err != nil {
+		return nil, errors.Errorf("finding declaration of %s: %w", target.Object.Name(), err)
+	}
+	locs = append(locs, decl)
+	locs = append(locs, goUses(registry, target.Object)...)
+
+	idx, err := references.BuildIndex(ctx, registry)
+	if err != nil {
+		return nil, errors.Errorf("building references index: %w", err)
+	}
+
+	for _, loc := range idx.References(target.Object) {
+		if loc.File != info.Filename {
+			locs = append(locs, loc)
+		}
+	}
+
+	for _, ref := range references.FindReferencesInTemplate(ctx, info, registry) {
+		if ref.Object == target.Object {
+			locs = append(locs, ref.Location)
+		}
+	}
+
+	edits := make(map[string][]TextEdit)
+	for _, loc := range locs {
+		edits[loc.File] = append(edits[loc.File], TextEdit{Range: loc.Range, NewText: newName})
+	}
+
+	for file := range edits {
+		sort.Slice(edits[file], func(i, j int) bool {
+			a, b := edits[file][i].Range.Start, edits[file][j].Range.Start
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Character < b.Character
+		})
+	}
+
+	return edits, nil
+}
+
+// goUses returns the uses of a field or method in the go code of the registry's packages, including
+// the uses through instantiations of generic types
+func goUses(registry *ast.Registry, obj types.Object) []definition.Location {
+	locs := []definition.Location{}
+	for _, pkg := range registry.Packages {
+		if pkg.Package.TypesInfo == nil || pkg.Package.Fset == nil {
+			continue
+		}
+		for id, used := range pkg.Package.TypesInfo.Uses {
+			if origin(used) == obj {
+				locs = append(locs, definition.NewLocationFromTokenPosition(pkg.Package.Fset.Position(id.Pos()), id.Name))
+			}
+		}
+	}
+	return locs
+}
+
+func origin(obj types.Object) types.Object {
+	switch o := obj.(type) {
+	case *types.Var:
+		return o.Origin()
+	case *types.Func:
+		return o.Origin()
+	}
+	return obj
+}
+
+func contains(r position.Range, p position.Place) bool {
+	if p.Line < r.Start.Line || p.Line > r.End.Line {
+		return false
+	}
+	if p.Line == r.Start.Line && p.Character < r.Start.Character {
+		return false
+	}
+	if p.Line == r.End.Line && p.Character > r.End.Character {
+		return false
+	}
+	return true
+}
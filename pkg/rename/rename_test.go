@@ -0,0 +1,129 @@
+package rename_test
+
+import (
+	"context"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/ast"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/rename"
+)
+
+func createMockRegistry(t *testing.T) *ast.Registry {
+	ctx := context.Background()
+
+	registry := ast.NewEmptyRegistry()
+
+	pkgd := registry.AddInMemoryPackageForTesting(ctx, "github.com/example/types")
+
+	address := pkgd.AddStruct("Address", map[string]types.Type{
+		"City": types.Typ[types.String],
+	})
+
+	pkgd.AddStruct("Person", map[string]types.Type{
+		"Name":    types.Typ[types.String],
+		"Address": address,
+	})
+
+	pkgd.AddFunction("shout", types.NewSignature(
+		nil,
+		types.NewTuple(types.NewVar(0, pkgd.Package.Types, "s", types.Typ[types.String])),
+		types.NewTuple(types.NewVar(0, pkgd.Package.Types, "", types.Typ[types.String])),
+		false,
+	))
+
+	return registry
+}
+
+func TestPrepareRename(t *testing.T) {
+	tests := []struct {
+		name string
+		// the cursor is placed at the "^" character, which is removed from the template
+		template  string
+		wantName  string
+		wantRange position.Range
+		wantErr   string
+	}{
+		{
+			name:      "field",
+			template:  "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Na^me }}",
+			wantName:  "Name",
+			wantRange: position.Range{Start: position.Place{Line: 1, Character: 4}, End: position.Place{Line: 1, Character: 8}},
+		},
+		{
+			name:      "nested field",
+			template:  "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Address.Ci^ty }}",
+			wantName:  "City",
+			wantRange: position.Range{Start: position.Place{Line: 1, Character: 12}, End: position.Place{Line: 1, Character: 16}},
+		},
+		{
+			name:     "builtin function",
+			template: "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Name | up^per }}",
+			wantErr:  "cannot rename template function upper",
+		},
+		{
+			name:     "funcmap function",
+			template: "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Name | sh^out }}",
+			wantErr:  "cannot rename template function shout",
+		},
+		{
+			name:     "sprig function",
+			template: "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{- /*gotmpls:funcs sprig*/ -}}\n{{ .Name | tr^unc 3 }}",
+			wantErr:  "cannot rename template function trunc",
+		},
+		{
+			name:     "unresolved path",
+			template: "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .No^pe }}",
+			wantErr:  "no field or method that can be renamed",
+		},
+		{
+			name:     "type hint",
+			template: "{{- /*gotype: github.com/example/types.Per^son*/ -}}\n{{ .Name }}",
+			wantErr:  "cannot rename type Person",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			offset := strings.Index(tt.template, "^")
+			content := tt.template[:offset] + tt.template[offset+1:]
+
+			info, err := parser.Parse(ctx, "test.tmpl", []byte(content))
+			require.NoError(t, err)
+
+			got, err := rename.PrepareRename(ctx, info, position.NewBasicPosition("", offset), createMockRegistry(t))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, got.Object.Name())
+			assert.Equal(t, tt.wantRange, got.Range)
+		})
+	}
+}
+
+func TestRenameInvalidName(t *testing.T) {
+	ctx := context.Background()
+
+	content := "{{- /*gotype: github.com/example/types.Person*/ -}}\n{{ .Name }}"
+	info, err := parser.Parse(ctx, "test.tmpl", []byte(content))
+	require.NoError(t, err)
+
+	_, err = rename.Rename(ctx, info, position.NewBasicPosition("", 57), createMockRegistry(t), "fullName")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must be exported")
+
+	_, err = rename.Rename(ctx, info, position.NewBasicPosition("", 57), createMockRegistry(t), "Full Name")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a valid identifier")
+}
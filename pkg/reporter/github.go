@@ -0,0 +1,50 @@
+package reporter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/walteh/gotmpls/pkg/checker"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"gitlab.com/tozd/go/errors"
+)
+
+// GitHubReporter writes GitHub Actions workflow commands, which annotate the problems in pull requests
+type GitHubReporter struct{}
+
+func (r *GitHubReporter) Report(w io.Writer, result *checker.Result) error {
+	for _, problem := range result.Problems {
+		command := "notice"
+		switch problem.Severity {
+		case diagnostic.SeverityError:
+			command = "error"
+		case diagnostic.SeverityWarning:
+			command = "warning"
+		}
+
+		_, err := fmt.Fprintf(w, "::%s file=%s,line=%d,col=%d,endLine=%d,endColumn=%d,title=%s::%s\n",
+			command,
+			escapeGitHubProperty(problem.File),
+			problem.Line, problem.Column, problem.EndLine, problem.EndColumn,
+			escapeGitHubProperty("gotmpls "+problem.Rule),
+			escapeGitHubData(problem.Message),
+		)
+		if err != nil {
+			return errors.Errorf("writing problem: %w", err)
+		}
+	}
+	return nil
+}
+
+var gitHubDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+var gitHubPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+func escapeGitHubData(s string) string {
+	return gitHubDataEscaper.Replace(s)
+}
+
+func escapeGitHubProperty(s string) string {
+	return gitHubPropertyEscaper.Replace(s)
+}
@@ -0,0 +1,51 @@
+package reporter
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/walteh/gotmpls/pkg/checker"
+	"gitlab.com/tozd/go/errors"
+)
+
+// JSONLReporter writes one JSON object per problem and line
+type JSONLReporter struct{}
+
+type jsonlRecord struct {
+	File     string     `json:"file"`
+	Range    jsonlRange `json:"range"`
+	Severity string     `json:"severity"`
+	Message  string     `json:"message"`
+	Rule     string     `json:"rule"`
+}
+
+type jsonlRange struct {
+	Start jsonlPlace `json:"start"`
+	End   jsonlPlace `json:"end"`
+}
+
+// jsonlPlace is a 1-based line and column
+type jsonlPlace struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (r *JSONLReporter) Report(w io.Writer, result *checker.Result) error {
+	enc := json.NewEncoder(w)
+	for _, problem := range result.Problems {
+		record := jsonlRecord{
+			File: problem.File,
+			Range: jsonlRange{
+				Start: jsonlPlace{Line: problem.Line, Column: problem.Column},
+				End:   jsonlPlace{Line: problem.EndLine, Column: problem.EndColumn},
+			},
+			Severity: severityName(problem.Severity),
+			Message:  problem.Message,
+			Rule:     problem.Rule,
+		}
+		if err := enc.Encode(record); err != nil {
+			return errors.Errorf("encoding problem: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package reporter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/walteh/gotmpls/pkg/checker"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"gitlab.com/tozd/go/errors"
+)
+
+// JUnitReporter writes a JUnit XML report with a test case per template, which fails if the template has errors
+type JUnitReporter struct{}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (r *JUnitReporter) Report(w io.Writer, result *checker.Result) error {
+	suite := junitTestSuite{
+		Name:  "gotmpls",
+		Tests: len(result.Files),
+	}
+
+	for _, file := range result.Files {
+		tc := junitTestCase{
+			Name:      file,
+			ClassName: "gotmpls",
+		}
+
+		errs, warnings := []string{}, []string{}
+		rule := ""
+		for _, problem := range result.Problems {
+			if problem.File != file {
+				continue
+			}
+			if problem.Severity == diagnostic.SeverityError {
+				errs = append(errs, problem.String())
+				if rule == "" {
+					rule = problem.Rule
+				}
+			} else {
+				warnings = append(warnings, problem.String())
+			}
+		}
+
+		if len(errs) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d errors", len(errs)),
+				Type:    rule,
+				Text:    strings.Join(errs, "\n"),
+			}
+		}
+		if len(warnings) > 0 {
+			tc.SystemOut = strings.Join(warnings, "\n")
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Errorf("writing header: %w", err)
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return errors.Errorf("encoding report: %w", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
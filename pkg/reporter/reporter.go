@@ -0,0 +1,58 @@
+// Package reporter writes the problems found by the checker in machine readable formats, for code
+// scanning dashboards, test result viewers and CI annotations.
+package reporter
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/walteh/gotmpls/pkg/checker"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Reporter writes the result of a check in a specific format
+type Reporter interface {
+	Report(w io.Writer, result *checker.Result) error
+}
+
+var reporters = map[string]Reporter{
+	"github": &GitHubReporter{},
+	"jsonl":  &JSONLReporter{},
+	"junit":  &JUnitReporter{},
+	"sarif":  &SARIFReporter{},
+}
+
+// New returns the reporter for a format, one of Formats()
+func New(format string) (Reporter, error) {
+	reporter, ok := reporters[format]
+	if !ok {
+		return nil, errors.Errorf("unknown format %q, expected one of: %s", format, strings.Join(Formats(), ", "))
+	}
+	return reporter, nil
+}
+
+// Formats returns the names of the supported formats
+func Formats() []string {
+	formats := make([]string, 0, len(reporters))
+	for name := range reporters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// severityName returns the lowercase name of a diagnostic severity
+func severityName(severity int) string {
+	switch severity {
+	case diagnostic.SeverityError:
+		return "error"
+	case diagnostic.SeverityWarning:
+		return "warning"
+	case diagnostic.SeverityInformation:
+		return "info"
+	default:
+		return "hint"
+	}
+}
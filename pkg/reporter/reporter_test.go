@@ -0,0 +1,222 @@
+package reporter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	goast "go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/checker"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"github.com/walteh/gotmpls/pkg/reporter"
+)
+
+var result = &checker.Result{
+	Files: []string{"a.tmpl", "b.tmpl", "c.tmpl"},
+	Problems: []checker.Problem{
+		{File: "a.tmpl", Line: 2, Column: 4, EndLine: 2, EndColumn: 8, Message: "field not found [ Nme ] in type [ P ]", Severity: diagnostic.SeverityError, Rule: diagnostic.RuleUnknownField},
+		{File: "a.tmpl", Line: 3, Column: 1, EndLine: 3, EndColumn: 1, Message: "missing value for if", Severity: diagnostic.SeverityError, Rule: checker.RuleSyntax},
+		{File: "b.tmpl", Line: 1, Column: 5, EndLine: 1, EndColumn: 9, Message: "deprecated,\nuse: other", Severity: diagnostic.SeverityWarning, Rule: "custom"},
+	},
+}
+
+func TestReporters(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "github",
+			want: `::error file=a.tmpl,line=2,col=4,endLine=2,endColumn=8,title=gotmpls unknown-field::field not found [ Nme ] in type [ P ]
+::error file=a.tmpl,line=3,col=1,endLine=3,endColumn=1,title=gotmpls syntax::missing value for if
+::warning file=b.tmpl,line=1,col=5,endLine=1,endColumn=9,title=gotmpls custom::deprecated,%0Ause: other
+`,
+		},
+		{
+			format: "jsonl",
+			want: `{"file":"a.tmpl","range":{"start":{"line":2,"column":4},"end":{"line":2,"column":8}},"severity":"error","message":"field not found [ Nme ] in type [ P ]","rule":"unknown-field"}
+{"file":"a.tmpl","range":{"start":{"line":3,"column":1},"end":{"line":3,"column":1}},"severity":"error","message":"missing value for if","rule":"syntax"}
+{"file":"b.tmpl","range":{"start":{"line":1,"column":5},"end":{"line":1,"column":9}},"severity":"warning","message":"deprecated,\nuse: other","rule":"custom"}
+`,
+		},
+		{
+			format: "junit",
+			want: `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="gotmpls" tests="3" failures="1">
+    <testcase name="a.tmpl" classname="gotmpls">
+      <failure message="2 errors" type="unknown-field">a.tmpl:2:4: field not found [ Nme ] in type [ P ]&#xA;a.tmpl:3:1: missing value for if</failure>
+    </testcase>
+    <testcase name="b.tmpl" classname="gotmpls">
+      <system-out>b.tmpl:1:5: deprecated,&#xA;use: other</system-out>
+    </testcase>
+    <testcase name="c.tmpl" classname="gotmpls"></testcase>
+  </testsuite>
+</testsuites>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			rep, err := reporter.New(tt.format)
+			require.NoError(t, err)
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, rep.Report(buf, result))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestSARIFReporter(t *testing.T) {
+	rep, err := reporter.New("sarif")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, rep.Report(buf, result))
+
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				RuleIndex int    `json:"ruleIndex"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+						Region struct {
+							StartLine   int `json:"startLine"`
+							StartColumn int `json:"startColumn"`
+							EndLine     int `json:"endLine"`
+							EndColumn   int `json:"endColumn"`
+						} `json:"region"`
+					} `json:"physicalLocation"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+
+	rules := []string{}
+	for _, rule := range run.Tool.Driver.Rules {
+		rules = append(rules, rule.ID)
+	}
+	assert.Equal(t, []string{"unknown-field", "syntax", "custom"}, rules)
+
+	require.Len(t, run.Results, 3)
+	assert.Equal(t, "unknown-field", run.Results[0].RuleID)
+	assert.Equal(t, "error", run.Results[0].Level)
+	assert.Equal(t, "a.tmpl", run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	region := run.Results[0].Locations[0].PhysicalLocation.Region
+	assert.Equal(t, []int{2, 4, 2, 8}, []int{region.StartLine, region.StartColumn, region.EndLine, region.EndColumn})
+	assert.Equal(t, 2, run.Results[2].RuleIndex)
+	assert.Equal(t, "warning", run.Results[2].Level)
+}
+
+// TestSARIFRuleDescriptions checks that every rule declared by the diagnostic and checker packages
+// is described in the tool section of the log
+func TestSARIFRuleDescriptions(t *testing.T) {
+	rules := []string{}
+	for _, dir := range []string{"../diagnostic", "../checker"} {
+		rules = append(rules, declaredRules(t, dir)...)
+	}
+	require.Contains(t, rules, diagnostic.RuleAmbiguousPackage)
+	require.Contains(t, rules, checker.RuleSyntax)
+
+	problems := []checker.Problem{}
+	for _, rule := range rules {
+		problems = append(problems, checker.Problem{File: "a.tmpl", Line: 1, Column: 1, EndLine: 1, EndColumn: 1, Message: rule, Severity: diagnostic.SeverityError, Rule: rule})
+	}
+
+	rep, err := reporter.New("sarif")
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, rep.Report(buf, &checker.Result{Files: []string{"a.tmpl"}, Problems: problems}))
+
+	var log struct {
+		Runs []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID               string `json:"id"`
+						ShortDescription struct {
+							Text string `json:"text"`
+						} `json:"shortDescription"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &log))
+	require.Len(t, log.Runs, 1)
+	require.Len(t, log.Runs[0].Tool.Driver.Rules, len(rules))
+
+	for _, rule := range log.Runs[0].Tool.Driver.Rules {
+		assert.NotEqual(t, rule.ID, rule.ShortDescription.Text, "rule %s has no description", rule.ID)
+	}
+}
+
+// declaredRules returns the values of the Rule* constants declared in the package of a directory
+func declaredRules(t *testing.T, dir string) []string {
+	t.Helper()
+
+	pkgs, err := parser.ParseDir(token.NewFileSet(), dir, func(info fs.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	require.NoError(t, err)
+
+	rules := []string{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*goast.GenDecl)
+				if !ok || gen.Tok != token.CONST {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					vs := spec.(*goast.ValueSpec)
+					for i, name := range vs.Names {
+						if !strings.HasPrefix(name.Name, "Rule") || i >= len(vs.Values) {
+							continue
+						}
+						lit, ok := vs.Values[i].(*goast.BasicLit)
+						require.True(t, ok && lit.Kind == token.STRING, "rule %s should be a string literal", name.Name)
+						value, err := strconv.Unquote(lit.Value)
+						require.NoError(t, err)
+						rules = append(rules, value)
+					}
+				}
+			}
+		}
+	}
+	return rules
+}
+
+func TestNewUnknownFormat(t *testing.T) {
+	_, err := reporter.New("xml")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected one of: github, jsonl, junit, sarif")
+}
@@ -0,0 +1,170 @@
+package reporter
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+
+	"github.com/walteh/gotmpls/pkg/checker"
+	"github.com/walteh/gotmpls/pkg/diagnostic"
+	"gitlab.com/tozd/go/errors"
+)
+
+// SARIFReporter writes a SARIF 2.1.0 log, the format of code scanning tools
+type SARIFReporter struct{}
+
+// ruleDescriptions describe the rules in the tool section of the log
+var ruleDescriptions = map[string]string{
+	diagnostic.RuleTypeHint:           "The type hint of the template was loaded",
+	diagnostic.RuleUnknownFunctionSet: "A gotmpls:funcs directive names an unknown function set",
+	diagnostic.RuleUnknownField:       "A field or method does not exist on the type",
+	diagnostic.RuleInvalidRange:       "A range pipeline can not be iterated over",
+	diagnostic.RuleUndefinedVariable:  "A variable is used or assigned before it is declared",
+	diagnostic.RuleInvalidCall:        "A value is called that can not be called from a template",
+	diagnostic.RuleInvalidArgument:    "The number or types of the arguments do not match the function",
+	diagnostic.RuleUnknownFunction:    "A function is not a builtin or declared in an enabled FuncMap",
+	diagnostic.RuleUndefinedTemplate:  "A template call names a template that is not defined",
+	diagnostic.RuleDuplicateTemplate:  "A template is defined by more than one file of a package",
+	diagnostic.RuleAmbiguousPackage:   "The package of a type hint matches more than one package",
+	checker.RuleSyntax:                "The template can not be parsed",
+	checker.RuleAnalysis:              "The template can not be analyzed",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func (r *SARIFReporter) Report(w io.Writer, result *checker.Result) error {
+	run := sarifRun{
+		Tool: sarifTool{
+			Driver: sarifDriver{
+				Name:           "gotmpls",
+				InformationURI: "https://github.com/walteh/gotmpls",
+				Rules:          []sarifRule{},
+			},
+		},
+		Results: []sarifResult{},
+	}
+
+	ruleIndex := map[string]int{}
+
+	for _, problem := range result.Problems {
+		index, ok := ruleIndex[problem.Rule]
+		if !ok {
+			description, ok := ruleDescriptions[problem.Rule]
+			if !ok {
+				description = problem.Rule
+			}
+			index = len(run.Tool.Driver.Rules)
+			ruleIndex[problem.Rule] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:               problem.Rule,
+				ShortDescription: sarifMessage{Text: description},
+			})
+		}
+
+		artifact := sarifArtifactLocation{URI: filepath.ToSlash(problem.File)}
+		if !filepath.IsAbs(problem.File) {
+			// relative paths are relative to the root of the repository
+			artifact.URIBaseID = "%SRCROOT%"
+		}
+
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    problem.Rule,
+			RuleIndex: index,
+			Level:     sarifLevel(problem.Severity),
+			Message:   sarifMessage{Text: problem.Message},
+			Locations: []sarifLocation{
+				{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: artifact,
+						Region: sarifRegion{
+							StartLine:   problem.Line,
+							StartColumn: problem.Column,
+							EndLine:     problem.EndLine,
+							EndColumn:   problem.EndColumn,
+						},
+					},
+				},
+			},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}); err != nil {
+		return errors.Errorf("encoding report: %w", err)
+	}
+
+	return nil
+}
+
+func sarifLevel(severity int) string {
+	switch severity {
+	case diagnostic.SeverityError:
+		return "error"
+	case diagnostic.SeverityWarning:
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,229 @@
+// Package selection provides expand and shrink selection ranges for go templates.
+package selection
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+	"gitlab.com/tozd/go/errors"
+)
+
+// SelectionRange is a range that can be selected, with the next larger range as its parent
+type SelectionRange struct {
+	Range  position.Range
+	Parent *SelectionRange
+}
+
+// span is a range of offsets in the content
+type span struct {
+	start, end int
+}
+
+func (s span) contains(offset int) bool {
+	return s.start <= offset && offset <= s.end
+}
+
+// GetSelectionRanges returns a selection range for each of the positions.
+//
+// Selections expand from the operand under the cursor (e.g. a field), to its command, to its
+// pipeline (parenthesized pipelines first), to the action, to each enclosing if, range or with
+// up to its {{ end }}, to the enclosing define or block, and finally to the whole template.
+func GetSelectionRanges(ctx context.Context, info *parser.ParsedTemplateFile, positions []position.Place) ([]*SelectionRange, error) {
+	content := info.SourceContent
+
+	trees, err := parser.ParseTree(info.Filename, []byte(content))
+	if err != nil {
+		return nil, errors.Errorf("parsing template: %w", err)
+	}
+
+	result := make([]*SelectionRange, 0, len(positions))
+	for _, place := range positions {
+		offset := position.NewRawPositionFromLineAndColumn(place.Line, place.Character, "", content).Offset
+
+		s := &selector{content: content, offset: offset, spans: []span{{start: 0, end: len(content)}}}
+
+		for _, block := range info.Blocks {
+			tree, ok := trees[block.Name]
+			if !ok || tree.Root == nil {
+				continue
+			}
+			if tree.CanRelyOnKeyword() {
+				define := span{start: block.StartPosition.Offset, end: block.EndPosition.Offset + len("}}")}
+				if !define.contains(offset) {
+					continue
+				}
+				s.push(define)
+			}
+			s.list(tree.Root)
+		}
+
+		result = append(result, s.selectionRange())
+	}
+
+	zerolog.Ctx(ctx).Trace().Int("positions", len(positions)).Str("file", info.Filename).Msg("built selection ranges")
+
+	return result, nil
+}
+
+type selector struct {
+	content string
+	offset  int
+	spans   []span // from the outermost to the innermost
+}
+
+// push adds a span inside of the previous ones, duplicates and spans that are not nested are skipped
+func (s *selector) push(sp span) {
+	last := s.spans[len(s.spans)-1]
+	if last == sp || sp.start < last.start || sp.end > last.end {
+		return
+	}
+	s.spans = append(s.spans, sp)
+}
+
+func (s *selector) selectionRange() *SelectionRange {
+	var current *SelectionRange
+	for _, sp := range s.spans {
+		current = &SelectionRange{
+			Range: position.Range{
+				Start: position.OffsetToPlace(s.content, sp.start),
+				End:   position.OffsetToPlace(s.content, sp.end),
+			},
+			Parent: current,
+		}
+	}
+	return current
+}
+
+func (s *selector) list(list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			s.action(n.Pipe, int(n.Pipe.Position()))
+		case *parse.TemplateNode:
+			s.action(n.Pipe, int(n.Keyword().Pos()))
+		case *parse.IfNode:
+			s.branch(&n.BranchNode)
+		case *parse.RangeNode:
+			s.branch(&n.BranchNode)
+		case *parse.WithNode:
+			s.branch(&n.BranchNode)
+		}
+	}
+}
+
+// branch selects the whole branch, then the action or list the offset is in
+func (s *selector) branch(n *parse.BranchNode) {
+	end := position.NewBranchEndPosition(n)
+	// node positions are one before the offset in the content
+	whole := span{start: s.actionStart(int(n.Keyword().Pos())), end: s.actionEnd(end.Offset + 1)}
+	if !whole.contains(s.offset) {
+		return
+	}
+	s.push(whole)
+
+	s.action(n.Pipe, int(n.Keyword().Pos()))
+	s.list(n.List)
+	s.list(n.ElseList)
+}
+
+// action selects the action of a pipeline, then the pipeline and the operand the offset is in.
+// The start is an offset inside of the action, before the pipeline.
+func (s *selector) action(pipe *parse.PipeNode, start int) {
+	if pipe == nil {
+		// e.g. {{ template "name" }}
+		if whole := (span{start: s.actionStart(start), end: s.actionEnd(start)}); whole.contains(s.offset) {
+			s.push(whole)
+		}
+		return
+	}
+
+	inner := s.pipe(pipe)
+	whole := span{start: s.actionStart(min(start, inner.start)), end: s.actionEnd(inner.end)}
+	if !whole.contains(s.offset) {
+		return
+	}
+	s.push(whole)
+
+	if inner.contains(s.offset) {
+		s.push(inner)
+		s.pipeline(pipe)
+	}
+}
+
+// pipeline selects the command or declared variable the offset is in
+func (s *selector) pipeline(pipe *parse.PipeNode) {
+	for _, decl := range pipe.Decl {
+		if sp := s.node(decl); sp.contains(s.offset) {
+			s.push(sp)
+			return
+		}
+	}
+
+	for _, cmd := range pipe.Cmds {
+		sp := s.command(cmd)
+		if !sp.contains(s.offset) {
+			continue
+		}
+		s.push(sp)
+
+		for _, arg := range cmd.Args {
+			argSpan := s.node(arg)
+			if !argSpan.contains(s.offset) {
+				continue
+			}
+			s.push(argSpan)
+
+			switch a := arg.(type) {
+			case *parse.PipeNode:
+				s.push(s.pipe(a))
+				s.pipeline(a)
+			case *parse.ChainNode:
+				if inner, ok := a.Node.(*parse.PipeNode); ok && s.node(inner).contains(s.offset) {
+					s.push(s.node(inner))
+					s.push(s.pipe(inner))
+					s.pipeline(inner)
+				}
+			}
+			return
+		}
+		return
+	}
+}
+
+// pipe returns the span of the declarations and commands of a pipeline, without parentheses
+func (s *selector) pipe(pipe *parse.PipeNode) span {
+	start, end := position.PipeSpan(s.content, pipe)
+	return span{start: start, end: end}
+}
+
+func (s *selector) command(cmd *parse.CommandNode) span {
+	start, end := position.CommandSpan(s.content, cmd)
+	return span{start: start, end: end}
+}
+
+func (s *selector) node(node parse.Node) span {
+	start, end := position.OperandSpan(s.content, node)
+	return span{start: start, end: end}
+}
+
+// actionStart returns the offset of the left delimiter of the action that contains offset
+func (s *selector) actionStart(offset int) int {
+	return strings.LastIndex(s.content[:offset], "{{")
+}
+
+// actionEnd returns the offset after the right delimiter of the action that contains offset
+func (s *selector) actionEnd(offset int) int {
+	idx := strings.Index(s.content[offset:], "}}")
+	if idx == -1 {
+		return len(s.content)
+	}
+	return offset + idx + len("}}")
+}
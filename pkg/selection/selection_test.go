@@ -0,0 +1,102 @@
+package selection_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/selection"
+)
+
+func TestGetSelectionRanges(t *testing.T) {
+	template := `{{ define "row" }}
+{{ range .Items }}{{ $x := .A.B | printf "%s" (len $.Name) }}{{ end }}
+{{ end }}
+{{ template "row" . }}`
+
+	info, err := parser.Parse(context.Background(), "test.tmpl", []byte(template))
+	require.NoError(t, err)
+
+	// texts returns the selected text of every range, from the innermost to the outermost
+	texts := func(rng *selection.SelectionRange) []string {
+		result := []string{}
+		for ; rng != nil; rng = rng.Parent {
+			start := position.NewRawPositionFromLineAndColumn(rng.Range.Start.Line, rng.Range.Start.Character, "", template).Offset
+			end := position.NewRawPositionFromLineAndColumn(rng.Range.End.Line, rng.Range.End.Character, "", template).Offset
+			result = append(result, template[start:end])
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		place position.Place
+		want  []string
+	}{
+		{
+			name:  "field_in_pipeline",
+			place: position.Place{Line: 1, Character: 29},
+			want: []string{
+				".A.B",
+				`$x := .A.B | printf "%s" (len $.Name)`,
+				`{{ $x := .A.B | printf "%s" (len $.Name) }}`,
+				`{{ range .Items }}{{ $x := .A.B | printf "%s" (len $.Name) }}{{ end }}`,
+				"{{ define \"row\" }}\n{{ range .Items }}{{ $x := .A.B | printf \"%s\" (len $.Name) }}{{ end }}\n{{ end }}",
+				template,
+			},
+		},
+		{
+			name:  "variable_in_parenthesized_pipeline",
+			place: position.Place{Line: 1, Character: 56},
+			want: []string{
+				"$.Name",
+				"len $.Name",
+				"(len $.Name)",
+				`printf "%s" (len $.Name)`,
+				`$x := .A.B | printf "%s" (len $.Name)`,
+				`{{ $x := .A.B | printf "%s" (len $.Name) }}`,
+				`{{ range .Items }}{{ $x := .A.B | printf "%s" (len $.Name) }}{{ end }}`,
+				"{{ define \"row\" }}\n{{ range .Items }}{{ $x := .A.B | printf \"%s\" (len $.Name) }}{{ end }}\n{{ end }}",
+				template,
+			},
+		},
+		{
+			name:  "range_pipeline",
+			place: position.Place{Line: 1, Character: 11},
+			want: []string{
+				".Items",
+				"{{ range .Items }}",
+				`{{ range .Items }}{{ $x := .A.B | printf "%s" (len $.Name) }}{{ end }}`,
+				"{{ define \"row\" }}\n{{ range .Items }}{{ $x := .A.B | printf \"%s\" (len $.Name) }}{{ end }}\n{{ end }}",
+				template,
+			},
+		},
+		{
+			name:  "template_call",
+			place: position.Place{Line: 3, Character: 18},
+			want: []string{
+				".",
+				`{{ template "row" . }}`,
+				template,
+			},
+		},
+	}
+
+	places := []position.Place{}
+	for _, tt := range tests {
+		places = append(places, tt.place)
+	}
+
+	ranges, err := selection.GetSelectionRanges(context.Background(), info, places)
+	require.NoError(t, err)
+	require.Len(t, ranges, len(tests))
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, texts(ranges[i]))
+		})
+	}
+}
@@ -56,7 +56,7 @@ func GetTokensForText(ctx context.Context, text []byte) ([]Token, error) {
 
 	// Parse with standard parser
 	tree := parse.New("")
-	tree.Mode = parse.ParseComments | parse.SkipFuncCheck
+	tree.Mode = parse.ParseComments | parse.SkipFuncCheck | parse.SkipVarCheck
 	treeSet := make(map[string]*parse.Tree)
 	_, err = tree.Parse(string(text), "{{", "}}", treeSet)
 	if err != nil {
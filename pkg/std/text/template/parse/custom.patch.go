@@ -1,5 +1,23 @@
 package parse
 
+import "fmt"
+
+// Error is an error of parsing a template, at the token the parser stopped at
+type Error struct {
+	// Name is the name of the template being parsed
+	Name string
+	// Line is the line of the token, starting at 1
+	Line int
+	// Pos is the byte offset of the token in the text of the template
+	Pos Pos
+	// Message describes the error, without the name and line of the template
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("template: %s:%d: %s", e.Name, e.Line, e.Message)
+}
+
 type KeywordNode interface {
 	Keyword() item
 }
@@ -44,3 +62,6 @@ func (me *EndNode) Keyword() item       { return me.keyword }
 func (me *NilNode) Keyword() item       { return me.keyword }
 func (me *Tree) Keyword() item          { return me.defineNodeKeyword }
 func (me *Tree) CanRelyOnKeyword() bool { return me.hasDefineNode }
+
+// DefineName returns the quoted name of a define or block, only valid if CanRelyOnKeyword is true
+func (me *Tree) DefineName() item { return me.defineNodeValue }
@@ -47,6 +47,7 @@ type Mode uint
 const (
 	ParseComments Mode = 1 << iota // parse comments and add them to AST
 	SkipFuncCheck                  // do not check that functions are defined
+	SkipVarCheck                   // do not check that variables are defined
 )
 
 // Copy returns a copy of the [Tree]. Any parsing state is discarded.
@@ -167,8 +168,7 @@ func (t *Tree) ErrorContext(n Node) (location, context string) {
 // errorf formats the error and terminates processing.
 func (t *Tree) errorf(format string, args ...any) {
 	t.Root = nil
-	format = fmt.Sprintf("template: %s:%d: %s", t.ParseName, t.token[0].line, format)
-	panic(fmt.Errorf(format, args...))
+	panic(&Error{Name: t.ParseName, Line: t.token[0].line, Pos: t.token[0].pos, Message: fmt.Sprintf(format, args...)})
 }
 
 // error terminates processing.
@@ -857,6 +857,9 @@ func (t *Tree) popVars(n int) {
 // variable is not defined.
 func (t *Tree) useVar(pos Pos, name string) Node {
 	v := t.newVariable(pos, name)
+	if t.Mode&SkipVarCheck != 0 {
+		return v
+	}
 	for _, varName := range t.vars {
 		if varName == v.Ident[0] {
 			return v
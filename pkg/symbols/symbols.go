@@ -0,0 +1,217 @@
+// Package symbols provides the outline of a go template: its templates, control structures and variables.
+package symbols
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/std/text/template/parse"
+	"gitlab.com/tozd/go/errors"
+)
+
+// Kinds of symbols
+const (
+	KindTemplate = "template" // a define or block
+	KindControl  = "control"  // an if, else if, else with, range or with
+	KindVariable = "variable" // a $variable declaration
+)
+
+// Symbol represents a node of the outline of a template
+type Symbol struct {
+	Name   string
+	Detail string
+	Kind   string
+	// Range is the range of the whole symbol, e.g. from {{ define }} to its {{ end }}
+	Range position.Range
+	// SelectionRange is the range of the name of the symbol, e.g. the quoted name of a define
+	SelectionRange position.Range
+	Children       []Symbol
+}
+
+// GetDocumentSymbols returns the outline of a template.
+//
+// Every define and block is a top level symbol, with the type of its gotype hint as detail.
+// The if, range and with structures are nested under the template they appear in, and the
+// variables declared by an action are nested under the structure that scopes them. The
+// structures and variables outside of any define are top level symbols as well.
+func GetDocumentSymbols(ctx context.Context, info *parser.ParsedTemplateFile) ([]Symbol, error) {
+	content := info.SourceContent
+
+	trees, err := parser.ParseTree(info.Filename, []byte(content))
+	if err != nil {
+		return nil, errors.Errorf("parsing template: %w", err)
+	}
+
+	b := &builder{content: content}
+
+	symbols := []Symbol{}
+	for _, block := range info.Blocks {
+		tree, ok := trees[block.Name]
+		if !ok || tree.Root == nil {
+			continue
+		}
+
+		children := b.list(tree.Root)
+
+		if !tree.CanRelyOnKeyword() {
+			// the content outside of any define
+			symbols = append(symbols, children...)
+			continue
+		}
+
+		name := tree.DefineName()
+		symbol := Symbol{
+			Name:           block.Name,
+			Kind:           KindTemplate,
+			Range:          b.rangeOf(block.StartPosition.Offset, block.EndPosition.Offset+len("}}")),
+			SelectionRange: b.rangeOf(int(name.Pos()), int(name.Pos())+len(name.Val())),
+			Children:       children,
+		}
+		if block.TypeHint != nil {
+			symbol.Detail = block.TypeHint.TypePath
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return before(symbols[i].Range.Start, symbols[j].Range.Start)
+	})
+
+	zerolog.Ctx(ctx).Trace().Int("symbols", len(symbols)).Str("file", info.Filename).Msg("built document symbols")
+
+	return symbols, nil
+}
+
+type builder struct {
+	content string
+}
+
+// list returns the symbols of the nodes of a list
+func (b *builder) list(list *parse.ListNode) []Symbol {
+	symbols := []Symbol{}
+	if list == nil {
+		return symbols
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			symbols = append(symbols, b.variables(n.Pipe)...)
+		case *parse.IfNode:
+			symbols = append(symbols, b.branch(&n.BranchNode))
+		case *parse.RangeNode:
+			symbols = append(symbols, b.branch(&n.BranchNode))
+		case *parse.WithNode:
+			symbols = append(symbols, b.branch(&n.BranchNode))
+		}
+	}
+
+	return symbols
+}
+
+// branch returns the symbol of an if, range or with, from its keyword to its {{ end }}
+func (b *builder) branch(n *parse.BranchNode) Symbol {
+	keyword := n.Keyword()
+	start := strings.LastIndex(b.content[:keyword.Pos()], "{{")
+
+	children := b.variables(n.Pipe)
+	children = append(children, b.list(n.List)...)
+	children = append(children, b.list(n.ElseList)...)
+
+	return Symbol{
+		Name:           keyword.Val() + " " + pipeString(n.Pipe, true),
+		Kind:           KindControl,
+		Range:          b.rangeOf(start, branchEnd(n)),
+		SelectionRange: b.rangeOf(int(keyword.Pos()), int(keyword.Pos())+len(keyword.Val())),
+		Children:       children,
+	}
+}
+
+// variables returns the symbols of the variables declared by a pipeline
+func (b *builder) variables(pipe *parse.PipeNode) []Symbol {
+	symbols := []Symbol{}
+	if pipe == nil || pipe.IsAssign {
+		return symbols
+	}
+
+	for _, decl := range pipe.Decl {
+		rng := b.rangeOf(int(decl.Pos), int(decl.Pos)+len(decl.Ident[0]))
+		symbols = append(symbols, Symbol{
+			Name:           decl.Ident[0],
+			Detail:         pipeString(pipe, false),
+			Kind:           KindVariable,
+			Range:          rng,
+			SelectionRange: rng,
+		})
+	}
+
+	return symbols
+}
+
+func (b *builder) rangeOf(start, end int) position.Range {
+	return position.Range{
+		Start: position.OffsetToPlace(b.content, start),
+		End:   position.OffsetToPlace(b.content, end),
+	}
+}
+
+// branchEnd returns the offset after the {{ end }} of a branch. The end of an if with an
+// else if is the end of the nested if.
+func branchEnd(n *parse.BranchNode) int {
+	list := n.List
+	if n.ElseList != nil {
+		list = n.ElseList
+	}
+	if list == nil || len(list.Nodes) == 0 {
+		return int(n.Position())
+	}
+
+	switch last := list.Nodes[len(list.Nodes)-1].(type) {
+	case *parse.EndNode:
+		// the position of an end node is the position of its right delimiter
+		return int(last.Pos) + len("}}")
+	case *parse.IfNode:
+		return branchEnd(&last.BranchNode)
+	case *parse.WithNode:
+		return branchEnd(&last.BranchNode)
+	}
+
+	return int(list.Nodes[len(list.Nodes)-1].Position())
+}
+
+// pipeString returns the commands of a pipeline, including its declarations if decls is true
+func pipeString(pipe *parse.PipeNode, decls bool) string {
+	if pipe == nil {
+		return ""
+	}
+
+	var sb strings.Builder
+	if decls && len(pipe.Decl) > 0 {
+		for i, decl := range pipe.Decl {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(decl.String())
+		}
+		if pipe.IsAssign {
+			sb.WriteString(" = ")
+		} else {
+			sb.WriteString(" := ")
+		}
+	}
+	for i, cmd := range pipe.Cmds {
+		if i > 0 {
+			sb.WriteString(" | ")
+		}
+		sb.WriteString(cmd.String())
+	}
+	return sb.String()
+}
+
+func before(a, b position.Place) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
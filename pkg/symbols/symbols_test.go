@@ -0,0 +1,105 @@
+package symbols_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/walteh/gotmpls/pkg/parser"
+	"github.com/walteh/gotmpls/pkg/position"
+	"github.com/walteh/gotmpls/pkg/symbols"
+)
+
+// outline is a symbol without its ranges, for comparing structures
+type outline struct {
+	Name     string
+	Detail   string
+	Kind     string
+	Children []outline
+}
+
+func toOutline(syms []symbols.Symbol) []outline {
+	result := []outline{}
+	for _, sym := range syms {
+		result = append(result, outline{Name: sym.Name, Detail: sym.Detail, Kind: sym.Kind, Children: toOutline(sym.Children)})
+	}
+	return result
+}
+
+func TestGetDocumentSymbols(t *testing.T) {
+	template := `{{- /*gotype: test.Page*/ -}}
+{{ $title := .Title }}
+{{ define "header" }}
+{{- /*gotype: test.Header*/ -}}
+{{ if .Logo }}<img src="{{ .Logo }}">{{ else if .Text }}{{ .Text }}{{ else }}none{{ end }}
+{{ end }}
+{{ define "list" -}}
+{{ range $i, $item := .Items }}
+{{ with $name := $item.Name | printf "%s" }}{{ $name }}{{ end }}
+{{ end }}
+{{- end }}
+{{ template "header" .Header }}`
+
+	info, err := parser.Parse(context.Background(), "page.tmpl", []byte(template))
+	require.NoError(t, err)
+
+	syms, err := symbols.GetDocumentSymbols(context.Background(), info)
+	require.NoError(t, err)
+
+	assert.Equal(t, []outline{
+		{Name: "$title", Detail: ".Title", Kind: symbols.KindVariable, Children: []outline{}},
+		{Name: "header", Detail: "test.Header", Kind: symbols.KindTemplate, Children: []outline{
+			{Name: "if .Logo", Kind: symbols.KindControl, Children: []outline{
+				{Name: "else if .Text", Kind: symbols.KindControl, Children: []outline{}},
+			}},
+		}},
+		{Name: "list", Kind: symbols.KindTemplate, Children: []outline{
+			{Name: "range $i, $item := .Items", Kind: symbols.KindControl, Children: []outline{
+				{Name: "$i", Detail: ".Items", Kind: symbols.KindVariable, Children: []outline{}},
+				{Name: "$item", Detail: ".Items", Kind: symbols.KindVariable, Children: []outline{}},
+				{Name: `with $name := $item.Name | printf "%s"`, Kind: symbols.KindControl, Children: []outline{
+					{Name: "$name", Detail: `$item.Name | printf "%s"`, Kind: symbols.KindVariable, Children: []outline{}},
+				}},
+			}},
+		}},
+	}, toOutline(syms))
+
+	rng := func(startLine, startChar, endLine, endChar int) position.Range {
+		return position.Range{
+			Start: position.Place{Line: startLine, Character: startChar},
+			End:   position.Place{Line: endLine, Character: endChar},
+		}
+	}
+
+	assert.Equal(t, rng(1, 3, 1, 9), syms[0].Range, "variables span their name")
+	assert.Equal(t, rng(2, 0, 5, 9), syms[1].Range, "templates span from define to end")
+	assert.Equal(t, rng(2, 10, 2, 18), syms[1].SelectionRange, "templates are selected by their name")
+
+	ifSymbol := syms[1].Children[0]
+	assert.Equal(t, rng(4, 0, 4, 90), ifSymbol.Range, "if spans to the end of its else if chain")
+	assert.Equal(t, rng(4, 3, 4, 5), ifSymbol.SelectionRange)
+	assert.Equal(t, rng(4, 37, 4, 90), ifSymbol.Children[0].Range)
+
+	rangeSymbol := syms[2].Children[0]
+	assert.Equal(t, rng(7, 0, 9, 9), rangeSymbol.Range)
+	assert.Equal(t, rng(7, 9, 7, 11), rangeSymbol.Children[0].Range)
+}
+
+func TestGetDocumentSymbolsBlock(t *testing.T) {
+	template := `<main>{{ block "content" . }}{{ range .Items }}{{ . }}{{ end }}{{ end }}</main>`
+
+	info, err := parser.Parse(context.Background(), "layout.tmpl", []byte(template))
+	require.NoError(t, err)
+
+	syms, err := symbols.GetDocumentSymbols(context.Background(), info)
+	require.NoError(t, err)
+
+	require.Len(t, syms, 1)
+	assert.Equal(t, "content", syms[0].Name)
+	assert.Equal(t, symbols.KindTemplate, syms[0].Kind)
+	assert.Equal(t, position.Place{Line: 0, Character: 6}, syms[0].Range.Start)
+	assert.Equal(t, position.Place{Line: 0, Character: 72}, syms[0].Range.End)
+	require.Len(t, syms[0].Children, 1)
+	assert.Equal(t, "range .Items", syms[0].Children[0].Name)
+}